@@ -0,0 +1,363 @@
+// Package credstore keeps gateway credentials in the Secret Service keyring
+// or in a passphrase-encrypted file.
+package credstore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	CREDENTIALS_FILE  = "credentials.enc"
+	KEYRING_ATTRIBUTE = "gateway"
+
+	// Credential store backends
+	STORE_AUTO    = "auto"
+	STORE_KEYRING = "keyring"
+	STORE_FILE    = "file"
+
+	// scrypt parameters for the encrypted file (interactive-login strength)
+	SCRYPT_N       = 1 << 15
+	SCRYPT_R       = 8
+	SCRYPT_P       = 1
+	SCRYPT_KEY_LEN = 32
+)
+
+var ErrNoCredentials = errors.New("no stored credentials")
+
+// Credentials for one gateway. Nokia IDU gateways log in with a
+// browser-captured payload rather than the password itself.
+type Credentials struct {
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	BrowserPayload string `json:"browser_payload,omitempty"`
+}
+
+// Store keeps credentials keyed by gateway address.
+type Store interface {
+	Get(gateway string) (Credentials, error)
+	Set(gateway string, creds Credentials) error
+	Delete(gateway string) error
+	Name() string
+}
+
+// PassphraseFunc supplies the file store passphrase; confirm is set when a
+// new file is about to be created.
+type PassphraseFunc func(confirm bool) ([]byte, error)
+
+// DefaultPath is the credentials file in app's directory under the user
+// config directory.
+func DefaultPath(app string) string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return CREDENTIALS_FILE
+	}
+	return filepath.Join(configDir, app, CREDENTIALS_FILE)
+}
+
+// Open picks the Secret Service keyring when it is reachable and the
+// encrypted file otherwise, unless backend forces one of them.
+func Open(backend string, keyring *KeyringStore, file *FileStore) (Store, error) {
+	switch strings.ToLower(backend) {
+	case STORE_AUTO, "":
+		if KeyringAvailable() {
+			return keyring, nil
+		}
+		return file, nil
+	case STORE_KEYRING:
+		if !KeyringAvailable() {
+			return nil, fmt.Errorf("secret service keyring is not available (needs secret-tool and a D-Bus session)")
+		}
+		return keyring, nil
+	case STORE_FILE:
+		return file, nil
+	default:
+		return nil, fmt.Errorf("unknown credential store %q (expected %s, %s or %s)", backend, STORE_AUTO, STORE_KEYRING, STORE_FILE)
+	}
+}
+
+// KeyringAvailable reports whether the Secret Service can be reached through
+// libsecret's secret-tool.
+func KeyringAvailable() bool {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return false
+	}
+	_, err := exec.LookPath("secret-tool")
+	return err == nil
+}
+
+// KeyringStore keeps each gateway's credentials as one JSON secret in the
+// Secret Service, via secret-tool. Entries are looked up by Service and by
+// the gateway address under Attribute (KEYRING_ATTRIBUTE if empty).
+type KeyringStore struct {
+	Service   string
+	Attribute string
+}
+
+func (k *KeyringStore) Name() string {
+	return "keyring"
+}
+
+func (k *KeyringStore) attributes(gateway string) []string {
+	attribute := k.Attribute
+	if attribute == "" {
+		attribute = KEYRING_ATTRIBUTE
+	}
+	return []string{"service", k.Service, attribute, gateway}
+}
+
+func (k *KeyringStore) Get(gateway string) (Credentials, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", append([]string{"lookup"}, k.attributes(gateway)...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// secret-tool exits 1 without output when nothing matches
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() == 0 && stdout.Len() == 0 {
+			return Credentials{}, ErrNoCredentials
+		}
+		return Credentials{}, fmt.Errorf("failed to read keyring: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return Credentials{}, fmt.Errorf("invalid keyring entry for %s: %w", gateway, err)
+	}
+	return creds, nil
+}
+
+func (k *KeyringStore) Set(gateway string, creds Credentials) error {
+	secret, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{"store", "--label", fmt.Sprintf("%s %s", k.Service, gateway)}, k.attributes(gateway)...)
+	cmd := exec.Command("secret-tool", args...)
+	cmd.Stdin = bytes.NewReader(secret)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to write keyring: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (k *KeyringStore) Delete(gateway string) error {
+	cmd := exec.Command("secret-tool", append([]string{"clear"}, k.attributes(gateway)...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clear keyring: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// FileStore keeps every gateway's credentials in one file encrypted with
+// AES-256-GCM under a scrypt-derived key. The passphrase is asked for once
+// and the decrypted contents are cached for the life of the store.
+type FileStore struct {
+	Path       string
+	Passphrase PassphraseFunc
+
+	mu         sync.Mutex
+	passphrase []byte
+	entries    map[string]Credentials
+	exists     bool
+}
+
+// encryptedFile is the on-disk format.
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func (f *FileStore) Name() string {
+	return "file " + f.Path
+}
+
+func (f *FileStore) Get(gateway string) (Credentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.load(); err != nil {
+		return Credentials{}, err
+	}
+	creds, ok := f.entries[gateway]
+	if !ok {
+		return Credentials{}, ErrNoCredentials
+	}
+	return creds, nil
+}
+
+func (f *FileStore) Set(gateway string, creds Credentials) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.load(); err != nil {
+		return err
+	}
+	// A new file needs its passphrase chosen (and confirmed) before writing
+	if err := f.askPassphrase(!f.exists); err != nil {
+		return err
+	}
+	f.entries[gateway] = creds
+	return f.save()
+}
+
+func (f *FileStore) Delete(gateway string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.load(); err != nil {
+		return err
+	}
+	if _, ok := f.entries[gateway]; !ok {
+		return ErrNoCredentials
+	}
+	delete(f.entries, gateway)
+	return f.save()
+}
+
+// load decrypts the file on first use. A missing file is an empty store and
+// does not ask for a passphrase.
+func (f *FileStore) load() error {
+	if f.entries != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		f.entries = make(map[string]Credentials)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	var file encryptedFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid credentials file %s: %w", f.Path, err)
+	}
+	if file.Version != 1 || file.KDF != "scrypt" {
+		return fmt.Errorf("unsupported credentials file version %d (%s)", file.Version, file.KDF)
+	}
+
+	if err := f.askPassphrase(false); err != nil {
+		return err
+	}
+	aead, err := newFileCipher(f.passphrase, file.Salt, file.N, file.R, file.P)
+	if err != nil {
+		return err
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		f.passphrase = nil
+		return fmt.Errorf("failed to decrypt credentials: wrong passphrase or corrupted file")
+	}
+
+	entries := make(map[string]Credentials)
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		return fmt.Errorf("invalid credentials payload: %w", err)
+	}
+	f.entries = entries
+	f.exists = true
+	return nil
+}
+
+func (f *FileStore) askPassphrase(confirm bool) error {
+	if f.passphrase != nil {
+		return nil
+	}
+	if f.Passphrase == nil {
+		return fmt.Errorf("credentials file %s needs a passphrase", f.Path)
+	}
+	passphrase, err := f.Passphrase(confirm)
+	if err != nil {
+		return err
+	}
+	if len(passphrase) == 0 {
+		return fmt.Errorf("empty passphrase")
+	}
+	f.passphrase = passphrase
+	return nil
+}
+
+// save re-encrypts the whole store with a fresh salt and nonce and replaces
+// the file atomically.
+func (f *FileStore) save() error {
+	plaintext, err := json.Marshal(f.entries)
+	if err != nil {
+		return err
+	}
+
+	file := encryptedFile{Version: 1, KDF: "scrypt", N: SCRYPT_N, R: SCRYPT_R, P: SCRYPT_P}
+	file.Salt = make([]byte, 16)
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	aead, err := newFileCipher(f.passphrase, file.Salt, file.N, file.R, file.P)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Ciphertext = aead.Seal(nil, file.Nonce, plaintext, nil)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(f.Path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create credentials directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".credentials-*")
+	if err != nil {
+		return fmt.Errorf("failed to write credentials file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write credentials file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write credentials file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.Path); err != nil {
+		return fmt.Errorf("failed to replace credentials file: %w", err)
+	}
+	f.exists = true
+	return nil
+}
+
+func newFileCipher(passphrase, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, n, r, p, SCRYPT_KEY_LEN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
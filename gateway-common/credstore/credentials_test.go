@@ -0,0 +1,86 @@
+package credstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func staticPassphrase(passphrase string) PassphraseFunc {
+	return func(bool) ([]byte, error) { return []byte(passphrase), nil }
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app", CREDENTIALS_FILE)
+	store := &FileStore{Path: path, Passphrase: staticPassphrase("correct horse")}
+
+	if _, err := store.Get("192.168.0.1"); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials from an empty store, got %v", err)
+	}
+
+	want := Credentials{Username: "admin", Password: "hunter2-odu"}
+	if err := store.Set("192.168.0.1", want); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("192.168.1.1", Credentials{Username: "admin", Password: "x", BrowserPayload: "encrypted=1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2-odu") || strings.Contains(string(data), "admin") {
+		t.Fatal("credentials file contains plaintext")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Fatalf("credentials file has mode %v, want 0600", info.Mode().Perm())
+	}
+
+	// A fresh store must decrypt what the first one wrote
+	reopened := &FileStore{Path: path, Passphrase: staticPassphrase("correct horse")}
+	got, err := reopened.Get("192.168.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if err := reopened.Delete("192.168.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&FileStore{Path: path, Passphrase: staticPassphrase("correct horse")}).Get("192.168.0.1"); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected deleted credentials to be gone, got %v", err)
+	}
+}
+
+func TestFileStoreWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), CREDENTIALS_FILE)
+	if err := (&FileStore{Path: path, Passphrase: staticPassphrase("right")}).Set("gw", Credentials{Password: "p"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := (&FileStore{Path: path, Passphrase: staticPassphrase("wrong")}).Get("gw")
+	if err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Fatalf("expected a decryption failure, got %v", err)
+	}
+}
+
+func TestOpenFallsBackToFile(t *testing.T) {
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+	keyring := &KeyringStore{Service: "test"}
+	file := &FileStore{Path: filepath.Join(t.TempDir(), CREDENTIALS_FILE)}
+
+	if store, err := Open(STORE_AUTO, keyring, file); err != nil || store != Store(file) {
+		t.Fatalf("Open(%q) = %v, %v; want the file store", STORE_AUTO, store, err)
+	}
+	if _, err := Open(STORE_KEYRING, keyring, file); err == nil {
+		t.Fatalf("Open(%q) succeeded without a keyring", STORE_KEYRING)
+	}
+	if _, err := Open("vault", keyring, file); err == nil {
+		t.Fatal("Open accepted an unknown backend")
+	}
+}
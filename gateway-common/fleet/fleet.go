@@ -0,0 +1,133 @@
+// Package fleet reads the fleet file shared by fastmile-go and
+// netgear-orbi-go and merges what each of them polled into one health per
+// site.
+package fleet
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	FILE        = "fleet.json"
+	DIR         = "gateway-fleet"
+	CONCURRENCY = 8
+
+	TYPE_ODU  = "odu"
+	TYPE_IDU  = "idu"
+	TYPE_ORBI = "orbi"
+)
+
+// Gateway is one box at a site. fastmile-go polls the odu and idu gateways,
+// netgear-orbi-go the orbi routers.
+type Gateway struct {
+	Address string `json:"address"`
+	Type    string `json:"type"` // odu, idu or orbi
+}
+
+type Site struct {
+	Name     string    `json:"name"`
+	Tags     []string  `json:"tags,omitempty"`
+	Gateways []Gateway `json:"gateways"`
+}
+
+// Fleet is the set of sites managed together, read from a file like
+//
+//	{"sites": [{"name": "home", "tags": ["residential"], "gateways": [
+//	  {"address": "192.168.0.1", "type": "odu"},
+//	  {"address": "192.168.1.1", "type": "idu"},
+//	  {"address": "192.168.1.254", "type": "orbi"}]}]}
+type Fleet struct {
+	Sites []Site `json:"sites"`
+}
+
+// DefaultPath is the fleet file both tools read unless -fleet says otherwise.
+func DefaultPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return FILE
+	}
+	return filepath.Join(configDir, DIR, FILE)
+}
+
+func Load(path string) (*Fleet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fleet: %w", err)
+	}
+
+	var fleet Fleet
+	if err := json.Unmarshal(data, &fleet); err != nil {
+		return nil, fmt.Errorf("failed to parse fleet %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, site := range fleet.Sites {
+		if site.Name == "" {
+			return nil, fmt.Errorf("fleet %s has a site without a name", path)
+		}
+		if seen[strings.ToLower(site.Name)] {
+			return nil, fmt.Errorf("fleet %s lists site %q twice", path, site.Name)
+		}
+		seen[strings.ToLower(site.Name)] = true
+
+		for _, gw := range site.Gateways {
+			switch strings.ToLower(gw.Type) {
+			case TYPE_ODU, TYPE_IDU, TYPE_ORBI:
+			default:
+				return nil, fmt.Errorf("site %q: gateway %s has unknown type %q, expected odu, idu or orbi", site.Name, gw.Address, gw.Type)
+			}
+			if gw.Address == "" {
+				return nil, fmt.Errorf("site %q has a gateway without an address", site.Name)
+			}
+		}
+	}
+	return &fleet, nil
+}
+
+// Select returns the sites named in sites (comma-separated, empty for all)
+// that carry every tag in tags.
+func (f *Fleet) Select(sites, tags string) []Site {
+	names := splitList(sites)
+	wanted := splitList(tags)
+
+	var selected []Site
+	for _, site := range f.Sites {
+		if len(names) > 0 && !containsFold(names, site.Name) {
+			continue
+		}
+		matches := true
+		for _, tag := range wanted {
+			if !containsFold(site.Tags, tag) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			selected = append(selected, site)
+		}
+	}
+	return selected
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
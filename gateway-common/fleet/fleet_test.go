@@ -0,0 +1,117 @@
+package fleet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFleet(t *testing.T, fleet string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), FILE)
+	if err := os.WriteFile(path, []byte(fleet), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAndSelect(t *testing.T) {
+	fleet, err := Load(writeFleet(t, `{"sites": [
+		{"name": "Home", "tags": ["residential"], "gateways": [{"address": "192.168.0.1", "type": "odu"}]},
+		{"name": "office-berlin", "tags": ["office", "eu"], "gateways": [{"address": "10.1.0.1", "type": "IDU"}]},
+		{"name": "office-austin", "tags": ["office"], "gateways": [{"address": "10.2.0.1", "type": "orbi"}]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(sites []Site) string {
+		var n []string
+		for _, site := range sites {
+			n = append(n, site.Name)
+		}
+		return strings.Join(n, ",")
+	}
+	for _, tt := range []struct{ site, tag, want string }{
+		{"", "", "Home,office-berlin,office-austin"},
+		{"home", "", "Home"},
+		{"", "office", "office-berlin,office-austin"},
+		{"", "office,eu", "office-berlin"},
+		{"home,office-austin", "office", "office-austin"},
+	} {
+		if got := names(fleet.Select(tt.site, tt.tag)); got != tt.want {
+			t.Errorf("Select(%q, %q) = %s, want %s", tt.site, tt.tag, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{
+		`{"sites": [{"name": "", "gateways": []}]}`,
+		`{"sites": [{"name": "a"}, {"name": "A"}]}`,
+		`{"sites": [{"name": "a", "gateways": [{"address": "10.0.0.1", "type": "cable"}]}]}`,
+	} {
+		if _, err := Load(writeFleet(t, bad)); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+}
+
+func TestRecordMergesBothToolsIntoSiteHealth(t *testing.T) {
+	sites := []Site{
+		{Name: "home", Gateways: []Gateway{{"192.168.0.1", "odu"}, {"192.168.1.1", "idu"}, {"192.168.1.254", "orbi"}}},
+		{Name: "branch", Gateways: []Gateway{{"10.0.0.1", "odu"}, {"10.0.0.254", "orbi"}}},
+		{Name: "cabin", Gateways: []Gateway{{"10.9.0.254", "orbi"}}},
+		{Name: "lake", Gateways: []Gateway{{"10.8.0.1", "odu"}}},
+	}
+	path := StatusPath(filepath.Join(t.TempDir(), "config", FILE))
+	now := time.Now()
+
+	// netgear-orbi-go ran a few minutes ago; the cabin result is too old to count
+	orbis := []Result{
+		{Address: "192.168.1.254", Type: "orbi", Up: true, Detail: "3 devices", PolledBy: Poller("orbi"), PolledAt: now.Add(-3 * time.Minute)},
+		{Address: "10.0.0.254", Type: "orbi", Detail: "connection refused", PolledBy: Poller("orbi"), PolledAt: now.Add(-3 * time.Minute)},
+		{Address: "10.9.0.254", Type: "orbi", Up: true, PolledBy: Poller("orbi"), PolledAt: now.Add(-STATUS_MAX_AGE - time.Minute)},
+	}
+	if err := SaveStatus(path, orbis); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("status file not saved with mode 0600: %v, %v", info, err)
+	}
+
+	fastmile := []Result{
+		{Address: "192.168.0.1", Type: "odu", Up: true, PolledBy: Poller("odu"), PolledAt: now},
+		{Address: "192.168.1.1", Type: "idu", Up: true, PolledBy: Poller("idu"), PolledAt: now},
+		{Address: "10.0.0.1", Type: "odu", Up: true, PolledBy: Poller("odu"), PolledAt: now},
+	}
+	merged, err := Record(path, sites, fastmile, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(merged) != 7 || merged[2].Address != "192.168.1.254" || merged[2].Site != "home" || merged[2].Detail != "3 devices" {
+		t.Fatalf("orbi result not merged in fleet order: %+v", merged)
+	}
+	order, bySite := GroupBySite(merged)
+	if strings.Join(order, ",") != "home,branch,cabin,lake" {
+		t.Fatalf("sites out of fleet order: %v", order)
+	}
+	for site, want := range map[string]string{"home": HEALTH_HEALTHY, "branch": HEALTH_DEGRADED, "cabin": HEALTH_UNKNOWN, "lake": HEALTH_UNKNOWN} {
+		if got := SiteHealth(bySite[site]); got != want {
+			t.Errorf("%s health = %s, want %s", site, got, want)
+		}
+	}
+	if cabin := bySite["cabin"][0]; cabin.Polled() || !strings.Contains(cabin.Detail, "netgear-orbi-go -cmd fleet") {
+		t.Errorf("stale result should be listed without one: %+v", cabin)
+	}
+
+	// The FastMile results are there for netgear-orbi-go to read back
+	saved, err := LoadStatus(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 6 || !saved[statusKey("odu", "10.0.0.1")].Up {
+		t.Fatalf("unexpected saved status: %+v", saved)
+	}
+}
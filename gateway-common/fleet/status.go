@@ -0,0 +1,221 @@
+package fleet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	STATUS_FILE = "status.json"
+
+	// How long a saved result still counts towards its site's health
+	STATUS_MAX_AGE = 15 * time.Minute
+
+	HEALTH_HEALTHY  = "healthy"
+	HEALTH_DEGRADED = "degraded"
+	HEALTH_DOWN     = "down"
+
+	// Health of a site none of whose gateways has a recent result
+	HEALTH_UNKNOWN = "unknown"
+)
+
+// Result is the latest poll of one gateway. Each tool saves the gateways it
+// polls next to the fleet file so the other can fold them into its summary.
+type Result struct {
+	Site     string    `json:"site"`
+	Address  string    `json:"address"`
+	Type     string    `json:"type"`
+	Up       bool      `json:"up"`
+	Detail   string    `json:"detail"` // what the poll saw, or why it failed
+	PolledBy string    `json:"polled_by"`
+	PolledAt time.Time `json:"polled_at"`
+}
+
+// Polled reports whether the gateway has a result at all.
+func (r Result) Polled() bool {
+	return !r.PolledAt.IsZero()
+}
+
+// Source says which tool polled the gateway and how long ago.
+func (r Result) Source(now time.Time) string {
+	if !r.Polled() {
+		return ""
+	}
+	return fmt.Sprintf("%s, %s ago", r.PolledBy, now.Sub(r.PolledAt).Round(time.Second))
+}
+
+// Poller names the tool that polls gatewayType.
+func Poller(gatewayType string) string {
+	if strings.EqualFold(gatewayType, TYPE_ORBI) {
+		return "netgear-orbi-go"
+	}
+	return "fastmile-go"
+}
+
+// StatusPath is the shared status file kept beside the fleet file.
+func StatusPath(fleetPath string) string {
+	return filepath.Join(filepath.Dir(fleetPath), STATUS_FILE)
+}
+
+type statusFile struct {
+	Gateways []Result `json:"gateways"`
+}
+
+func statusKey(gatewayType, address string) string {
+	return strings.ToLower(gatewayType) + " " + address
+}
+
+// LoadStatus reads the saved results keyed by gateway. A missing file holds
+// no results.
+func LoadStatus(path string) (map[string]Result, error) {
+	saved := make(map[string]Result)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return saved, nil
+	}
+	if err != nil {
+		return saved, fmt.Errorf("failed to read fleet status: %w", err)
+	}
+
+	var file statusFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return saved, fmt.Errorf("failed to parse fleet status %s: %w", path, err)
+	}
+	for _, result := range file.Gateways {
+		saved[statusKey(result.Type, result.Address)] = result
+	}
+	return saved, nil
+}
+
+// SaveStatus records results over the saved ones for the same gateways. A
+// damaged file is started over, and the new one replaces it in a single
+// rename so the other tool never reads half of it.
+func SaveStatus(path string, results []Result) error {
+	saved, _ := LoadStatus(path)
+	for _, result := range results {
+		saved[statusKey(result.Type, result.Address)] = result
+	}
+
+	var file statusFile
+	for _, result := range saved {
+		file.Gateways = append(file.Gateways, result)
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode fleet status: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create fleet status directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".status-*")
+	if err != nil {
+		return fmt.Errorf("failed to save fleet status: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save fleet status: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save fleet status: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save fleet status: %w", err)
+	}
+	return nil
+}
+
+// Merge lists every gateway of the sites in fleet order with its result from
+// polled, or else from saved when that is no older than maxAge. A gateway
+// with neither is listed without a result.
+func Merge(sites []Site, polled []Result, saved map[string]Result, now time.Time, maxAge time.Duration) []Result {
+	fresh := make(map[string]Result)
+	for _, result := range polled {
+		fresh[statusKey(result.Type, result.Address)] = result
+	}
+
+	var merged []Result
+	for _, site := range sites {
+		for _, gw := range site.Gateways {
+			key := statusKey(gw.Type, gw.Address)
+			result, ok := fresh[key]
+			if !ok {
+				result, ok = saved[key]
+				ok = ok && now.Sub(result.PolledAt) <= maxAge
+			}
+			if !ok {
+				result = Result{
+					Address: gw.Address,
+					Type:    strings.ToLower(gw.Type),
+					Detail:  fmt.Sprintf("no recent result; run %s -cmd fleet", Poller(gw.Type)),
+				}
+			}
+			result.Site = site.Name
+			merged = append(merged, result)
+		}
+	}
+	return merged
+}
+
+// Record saves what this tool polled to the status file at path and merges
+// it with the other tool's recent results. When the file cannot be written
+// or read the summary is still returned, with the error.
+func Record(path string, sites []Site, polled []Result, now time.Time) ([]Result, error) {
+	err := SaveStatus(path, polled)
+	saved, loadErr := LoadStatus(path)
+	if err == nil {
+		err = loadErr
+	}
+	return Merge(sites, polled, saved, now, STATUS_MAX_AGE), err
+}
+
+// SiteHealth is healthy when every gateway of the site answered its latest
+// poll and down when none did. A gateway without a recent result counts
+// against the site; a site with no results at all is unknown.
+func SiteHealth(results []Result) string {
+	up, polled := CountUp(results)
+	switch {
+	case polled == 0:
+		return HEALTH_UNKNOWN
+	case up == len(results):
+		return HEALTH_HEALTHY
+	case up == 0:
+		return HEALTH_DOWN
+	default:
+		return HEALTH_DEGRADED
+	}
+}
+
+// CountUp returns how many gateways answered and how many have a result.
+func CountUp(results []Result) (int, int) {
+	up, polled := 0, 0
+	for _, result := range results {
+		if !result.Polled() {
+			continue
+		}
+		polled++
+		if result.Up {
+			up++
+		}
+	}
+	return up, polled
+}
+
+// GroupBySite splits results by site, keeping fleet order.
+func GroupBySite(results []Result) ([]string, map[string][]Result) {
+	var order []string
+	bySite := make(map[string][]Result)
+	for _, result := range results {
+		if _, ok := bySite[result.Site]; !ok {
+			order = append(order, result.Site)
+		}
+		bySite[result.Site] = append(bySite[result.Site], result)
+	}
+	return order, bySite
+}
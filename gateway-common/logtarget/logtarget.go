@@ -0,0 +1,274 @@
+// Package logtarget sends a charmbracelet logger to stderr, a file, syslog
+// or journald, scrubbing registered secrets on the way.
+package logtarget
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"gateway-common/redact"
+)
+
+const (
+	LOG_TARGET_STDERR   = "stderr"
+	LOG_TARGET_SYSLOG   = "syslog"
+	LOG_TARGET_JOURNALD = "journald"
+	LOG_TARGET_FILE     = "file"
+
+	LOG_FORMAT_TEXT   = "text"
+	LOG_FORMAT_JSON   = "json"
+	LOG_FORMAT_LOGFMT = "logfmt"
+
+	JOURNALD_SOCKET = "/run/systemd/journal/socket"
+)
+
+// Local syslog sockets on Linux, macOS and the BSDs
+var SYSLOG_SOCKETS = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// Configure points logger at the selected target and format. Syslog and
+// journald receive every record with its key/value fields intact, tagged
+// with identifier. The returned closer releases the target's file or socket.
+func Configure(logger *log.Logger, target, format, path, identifier string) (io.Closer, error) {
+	formatter, err := parseLogFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(target) {
+	case "", LOG_TARGET_STDERR:
+		logger.SetFormatter(formatter)
+		return nopCloser{}, nil
+	case LOG_TARGET_FILE:
+		if path == "" {
+			return nil, fmt.Errorf("the file log target needs -log-file")
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		logger.SetOutput(redact.Writer{W: f})
+		logger.SetFormatter(formatter)
+		logger.SetReportTimestamp(true)
+		return f, nil
+	case LOG_TARGET_SYSLOG:
+		conn, err := dialLogSocket(SYSLOG_SOCKETS...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		logger.SetOutput(redact.Writer{W: &syslogWriter{conn: conn, format: formatter, tag: identifier, pid: os.Getpid()}})
+		logger.SetFormatter(log.JSONFormatter)
+		return conn, nil
+	case LOG_TARGET_JOURNALD:
+		conn, err := dialLogSocket(JOURNALD_SOCKET)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to journald: %w", err)
+		}
+		logger.SetOutput(redact.Writer{W: &journaldWriter{conn: conn, identifier: identifier}})
+		logger.SetFormatter(log.JSONFormatter)
+		return conn, nil
+	default:
+		return nil, fmt.Errorf("unknown log target %q, expected %s, %s, %s or %s", target, LOG_TARGET_STDERR, LOG_TARGET_SYSLOG, LOG_TARGET_JOURNALD, LOG_TARGET_FILE)
+	}
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+func parseLogFormat(format string) (log.Formatter, error) {
+	switch strings.ToLower(format) {
+	case "", LOG_FORMAT_TEXT:
+		return log.TextFormatter, nil
+	case LOG_FORMAT_JSON:
+		return log.JSONFormatter, nil
+	case LOG_FORMAT_LOGFMT:
+		return log.LogfmtFormatter, nil
+	default:
+		return log.TextFormatter, fmt.Errorf("unknown log format %q, expected %s, %s or %s", format, LOG_FORMAT_TEXT, LOG_FORMAT_JSON, LOG_FORMAT_LOGFMT)
+	}
+}
+
+func dialLogSocket(paths ...string) (net.Conn, error) {
+	var lastErr error
+	for _, path := range paths {
+		conn, err := net.Dial("unixgram", path)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// logRecord is one JSON-formatted log line split into its parts, with the
+// fields in the order the formatter wrote them.
+type logRecord struct {
+	Level   string
+	Message string
+	Fields  [][2]string
+	raw     []byte
+}
+
+func parseLogRecord(line []byte) (logRecord, error) {
+	record := logRecord{raw: bytes.TrimSpace(line)}
+
+	dec := json.NewDecoder(bytes.NewReader(line))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return record, fmt.Errorf("log record is not a JSON object")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return record, err
+		}
+		key, _ := tok.(string)
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return record, err
+		}
+		value := string(raw)
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			value = s
+		}
+
+		switch key {
+		case "level":
+			record.Level = value
+		case "msg":
+			record.Message = value
+		case "time":
+		default:
+			record.Fields = append(record.Fields, [2]string{key, value})
+		}
+	}
+	return record, nil
+}
+
+// severity maps a log level to its syslog severity.
+func (r logRecord) severity() int {
+	switch r.Level {
+	case "debug":
+		return 7
+	case "warn":
+		return 4
+	case "error":
+		return 3
+	case "fatal":
+		return 2
+	default:
+		return 6
+	}
+}
+
+// logfmt renders the message followed by the fields as key=value pairs.
+func (r logRecord) logfmt() string {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	for _, field := range r.Fields {
+		value := field[1]
+		if value == "" || strings.ContainsAny(value, " =\"\t\n") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", field[0], value)
+	}
+	return b.String()
+}
+
+// syslogWriter sends records to the local syslog daemon in the BSD format
+// it expects on its socket, using the user facility.
+type syslogWriter struct {
+	conn   net.Conn
+	format log.Formatter
+	tag    string
+	pid    int
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	record, err := parseLogRecord(p)
+	if err != nil {
+		return 0, err
+	}
+
+	message := record.logfmt()
+	if w.format == log.JSONFormatter {
+		message = string(record.raw)
+	}
+	priority := 1*8 + record.severity()
+	if _, err := fmt.Fprintf(w.conn, "<%d>%s %s[%d]: %s", priority, time.Now().Format(time.Stamp), w.tag, w.pid, message); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// journaldWriter sends records using journald's native protocol, so every
+// logged key becomes a journal field, e.g. gateway-type as GATEWAY_TYPE.
+type journaldWriter struct {
+	conn       net.Conn
+	identifier string
+}
+
+func (w *journaldWriter) Write(p []byte) (int, error) {
+	record, err := parseLogRecord(p)
+	if err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", record.Message)
+	writeJournalField(&buf, "PRIORITY", strconv.Itoa(record.severity()))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", w.identifier)
+	for _, field := range record.Fields {
+		writeJournalField(&buf, journalFieldName(field[0]), field[1])
+	}
+	if _, err := w.conn.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// journalFieldName turns a log key into a valid journal field name:
+// uppercase letters, digits and underscores, not starting with either of
+// the latter.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	name = strings.TrimLeft(name, "_")
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "FIELD_" + name
+	}
+	return name
+}
+
+// writeJournalField encodes one field, switching to the length-prefixed
+// form for values that contain newlines.
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(buf, "%s=%s\n", name, value)
+		return
+	}
+	buf.WriteString(name)
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,119 @@
+package logtarget
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"gateway-common/redact"
+)
+
+// listenLogSocket stands in for journald or syslogd and returns the next
+// datagram written to it.
+func listenLogSocket(t *testing.T) (string, func() string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skipf("unix datagram sockets unavailable: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return path, func() string {
+		buf := make([]byte, 64*1024)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("no log record received: %v", err)
+		}
+		return string(buf[:n])
+	}
+}
+
+func TestJournaldKeepsStructuredFields(t *testing.T) {
+	path, next := listenLogSocket(t)
+	conn, err := dialLogSocket(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	logger := log.New(&journaldWriter{conn: conn, identifier: "fastmile-go"})
+	logger.SetFormatter(log.JSONFormatter)
+
+	logger.Warn("Initializing Session", "gateway-type", "ODU", "ip", "192.168.0.1", "step", "1", "detail", "two\nlines")
+	record := next()
+
+	for _, field := range []string{
+		"MESSAGE=Initializing Session\n",
+		"PRIORITY=4\n",
+		"SYSLOG_IDENTIFIER=fastmile-go\n",
+		"GATEWAY_TYPE=ODU\n",
+		"IP=192.168.0.1\n",
+		"STEP=1\n",
+		"DETAIL\n\x09\x00\x00\x00\x00\x00\x00\x00two\nlines\n",
+	} {
+		if !strings.Contains(record, field) {
+			t.Errorf("journal record is missing %q:\n%q", field, record)
+		}
+	}
+}
+
+func TestSyslogMessagesUseLogfmtOrJSON(t *testing.T) {
+	path, next := listenLogSocket(t)
+	conn, err := dialLogSocket(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w := &syslogWriter{conn: conn, format: log.LogfmtFormatter, tag: "fastmile-go", pid: 42}
+	logger := log.New(w)
+	logger.SetFormatter(log.JSONFormatter)
+
+	logger.Info("Login Successful", "gateway-type", "IDU", "user", "admin user")
+	if record := next(); !strings.HasPrefix(record, "<14>") || !strings.HasSuffix(record, ` fastmile-go[42]: Login Successful gateway-type=IDU user="admin user"`) {
+		t.Fatalf("unexpected syslog line %q", record)
+	}
+
+	w.format = log.JSONFormatter
+	logger.Error("Reboot Failed", "gateway-type", "ODU")
+	if record := next(); !strings.HasPrefix(record, "<11>") || !strings.HasSuffix(record, `: {"gateway-type":"ODU","level":"error","msg":"Reboot Failed"}`) {
+		t.Fatalf("unexpected syslog line %q", record)
+	}
+}
+
+func TestFileLogTarget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fastmile.log")
+	logger := log.New(os.Stderr)
+
+	closer, err := Configure(logger, LOG_TARGET_FILE, LOG_FORMAT_LOGFMT, path, "fastmile-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redact.Register("file-target-secret")
+	logger.Info("Session Initialized", "gateway-type", "ODU", "step", "1")
+	logger.Warn("Login Failed", "password", "file-target-secret")
+	closer.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := string(data); !strings.Contains(line, "level=info msg=\"Session Initialized\" gateway-type=ODU step=1") || !strings.HasPrefix(line, "time=") {
+		t.Fatalf("unexpected log file contents %q", line)
+	}
+	if strings.Contains(string(data), "file-target-secret") || !strings.Contains(string(data), redact.REDACTED) {
+		t.Fatalf("registered secret reached the log file: %q", data)
+	}
+
+	if _, err := Configure(logger, "eventlog", LOG_FORMAT_TEXT, "", "fastmile-go"); err == nil {
+		t.Fatal("expected an unknown log target to be rejected")
+	}
+}
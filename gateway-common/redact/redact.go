@@ -0,0 +1,111 @@
+// Package redact masks secrets in log lines and terminal output.
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// REDACTED replaces a masked secret, followed by a short hash of it.
+const REDACTED = "REDACTED"
+
+// Secrets are masked in every log line and terminal output unless
+// SetShowSecrets(true) is called (the -show-secrets flag).
+var secrets = &secretRegistry{}
+
+type secretRegistry struct {
+	mu     sync.RWMutex
+	show   bool
+	values []string
+}
+
+func SetShowSecrets(show bool) {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	secrets.show = show
+}
+
+func ShowSecrets() bool {
+	secrets.mu.RLock()
+	defer secrets.mu.RUnlock()
+	return secrets.show
+}
+
+// Register remembers a value so that Writer can scrub it from
+// output that was not masked at its call site. Very short values are ignored
+// since they would match ordinary text.
+func Register(value string) {
+	if len(value) < 6 {
+		return
+	}
+
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	for _, known := range secrets.values {
+		if known == value {
+			return
+		}
+	}
+	secrets.values = append(secrets.values, value)
+	// Longest first so a secret containing another is replaced whole
+	sort.Slice(secrets.values, func(i, j int) bool { return len(secrets.values[i]) > len(secrets.values[j]) })
+}
+
+// Mask returns value unchanged when secrets are shown, otherwise a
+// placeholder with a short hash so different values can still be told apart.
+func Mask(value string) string {
+	if value == "" || ShowSecrets() {
+		return value
+	}
+	sum := sha256.Sum256([]byte(value))
+	return REDACTED + "#" + hex.EncodeToString(sum[:3])
+}
+
+// Scrub replaces every registered secret in text with its mask.
+func Scrub(text string) string {
+	secrets.mu.RLock()
+	defer secrets.mu.RUnlock()
+	if secrets.show {
+		return text
+	}
+	for _, value := range secrets.values {
+		if strings.Contains(text, value) {
+			sum := sha256.Sum256([]byte(value))
+			text = strings.ReplaceAll(text, value, REDACTED+"#"+hex.EncodeToString(sum[:3]))
+		}
+	}
+	return text
+}
+
+// Writer scrubs registered secrets from everything written through
+// it. Loggers write whole lines, so secrets are never split across writes.
+type Writer struct {
+	W io.Writer
+}
+
+func (r Writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.W, Scrub(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Read and Fd let terminal detection see through the wrapper, so loggers
+// keep their colors.
+func (r Writer) Read(p []byte) (int, error) {
+	if reader, ok := r.W.(io.Reader); ok {
+		return reader.Read(p)
+	}
+	return 0, io.EOF
+}
+
+func (r Writer) Fd() uintptr {
+	if f, ok := r.W.(interface{ Fd() uintptr }); ok {
+		return f.Fd()
+	}
+	return ^uintptr(0)
+}
@@ -0,0 +1,39 @@
+package redact
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestWriterScrubsRegisteredSecrets(t *testing.T) {
+	SetShowSecrets(false)
+	Register("s3ss10n-1d-value")
+	Register("short")
+
+	var buf bytes.Buffer
+	log.New(Writer{W: &buf}).Error("Request Failed", "error", "cookie sid=s3ss10n-1d-value rejected", "user", "short")
+
+	if strings.Contains(buf.String(), "s3ss10n-1d-value") || !strings.Contains(buf.String(), REDACTED) {
+		t.Fatalf("secret not scrubbed: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "user=short") {
+		t.Fatalf("a value too short to be a secret was scrubbed: %s", buf.String())
+	}
+}
+
+func TestMaskTellsValuesApart(t *testing.T) {
+	SetShowSecrets(false)
+	a, b := Mask("token-one"), Mask("token-two")
+	if !strings.HasPrefix(a, REDACTED+"#") || a == b || Mask("token-one") != a {
+		t.Fatalf("masks %q and %q should be stable, distinct and redacted", a, b)
+	}
+
+	SetShowSecrets(true)
+	t.Cleanup(func() { SetShowSecrets(false) })
+	if Mask("token-one") != "token-one" || Scrub("token-one") != "token-one" {
+		t.Fatal("shown secrets should pass through unchanged")
+	}
+}
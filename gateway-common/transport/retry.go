@@ -0,0 +1,225 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retry defaults
+const (
+	RETRY_ATTEMPTS   = 3
+	RETRY_BASE_DELAY = 500 * time.Millisecond
+	RETRY_MAX_DELAY  = 5 * time.Second
+	RETRY_JITTER     = 0.2
+)
+
+var DEFAULT_RETRYABLE_STATUSES = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy retries transient failures with exponential backoff.
+//
+// Only idempotent requests are retried after they may have reached the
+// gateway: GET, HEAD, OPTIONS and TRACE, requests whose context came from
+// WithIdempotent, and requests carrying an Idempotency-Key or
+// X-Idempotency-Key header. Any request, including a reboot POST, is retried
+// when the connection could not be established at all, because nothing was
+// sent. A request whose own context is done is never retried.
+type RetryPolicy struct {
+	Attempts          int           // total tries including the first; 1 disables retries
+	BaseDelay         time.Duration // delay before the first retry, doubled each time
+	MaxDelay          time.Duration // cap for the backoff and for Retry-After
+	Jitter            float64       // fraction of each delay that is randomized, 0 to 1
+	RetryableStatuses []int
+
+	// OnRetry, if set, is called before each retry.
+	OnRetry func(req *http.Request, attempt int, delay time.Duration, reason string)
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:          RETRY_ATTEMPTS,
+		BaseDelay:         RETRY_BASE_DELAY,
+		MaxDelay:          RETRY_MAX_DELAY,
+		Jitter:            RETRY_JITTER,
+		RetryableStatuses: DEFAULT_RETRYABLE_STATUSES,
+	}
+}
+
+// ParseStatusList parses a comma-separated list of HTTP status codes.
+func ParseStatusList(list string) ([]int, error) {
+	var statuses []int
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		code, err := strconv.Atoi(field)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid HTTP status %q", field)
+		}
+		statuses = append(statuses, code)
+	}
+	return statuses, nil
+}
+
+// Wrap returns a transport that applies the policy to next.
+func (p RetryPolicy) Wrap(next http.RoundTripper) http.RoundTripper {
+	if p.Attempts <= 1 {
+		return next
+	}
+	return &retryTransport{next: next, policy: p}
+}
+
+// Delay is the backoff before retry number attempt (1-based), with jitter.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 && delay > 0 {
+		spread := float64(delay) * min(p.Jitter, 1)
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+	}
+	return delay
+}
+
+func (p RetryPolicy) retryableStatus(code int) bool {
+	for _, status := range p.RetryableStatuses {
+		if status == code {
+			return true
+		}
+	}
+	return false
+}
+
+type retryTransport struct {
+	next   http.RoundTripper
+	policy RetryPolicy
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent marks requests made with the returned context as safe to
+// resend, for POSTs that change nothing on the gateway.
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	if marked, _ := req.Context().Value(idempotentKey{}).(bool); marked {
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// notSent reports whether err happened before the request could be written,
+// i.e. while dialing.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// permanent errors are never worth retrying. Timeouts are not among them:
+// a dial timeout also matches context.DeadlineExceeded, so whether the
+// caller gave up is decided from the request's own context instead.
+func permanent(err error) bool {
+	var pinErr *PinMismatchError
+	var certErr *tls.CertificateVerificationError
+	return errors.As(err, &pinErr) || errors.As(err, &certErr)
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	idempotent := isIdempotent(req)
+	current := req
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(current)
+
+		var reason string
+		switch {
+		case err != nil && (req.Context().Err() != nil || permanent(err)):
+			return nil, err
+		case err != nil && (idempotent || notSent(err)):
+			reason = err.Error()
+		case err != nil:
+			return nil, err
+		case idempotent && t.policy.retryableStatus(resp.StatusCode):
+			reason = resp.Status
+		default:
+			return resp, nil
+		}
+
+		if attempt >= t.policy.Attempts {
+			return resp, err
+		}
+
+		delay := t.policy.Delay(attempt)
+		if resp != nil {
+			if after := retryAfter(resp); after > 0 {
+				delay = after
+				if t.policy.MaxDelay > 0 {
+					delay = min(after, t.policy.MaxDelay)
+				}
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return nil, fmt.Errorf("cannot retry request without GetBody: %s", reason)
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, bodyErr
+			}
+			current = req.Clone(req.Context())
+			current.Body = body
+		}
+
+		if t.policy.OnRetry != nil {
+			t.policy.OnRetry(req, attempt, delay, reason)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryAfter parses a Retry-After header given in seconds.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
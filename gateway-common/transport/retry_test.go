@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func fastRetryPolicy(retries *int32) RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.BaseDelay = time.Millisecond
+	policy.MaxDelay = 5 * time.Millisecond
+	policy.OnRetry = func(*http.Request, int, time.Duration, string) {
+		atomic.AddInt32(retries, 1)
+	}
+	return policy
+}
+
+// dropConnection makes the client see a transport error, like a lost packet.
+func dropConnection(w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+func TestRetryNeverResendsRebootPost(t *testing.T) {
+	for _, failure := range []string{"dropped", "503"} {
+		t.Run(failure, func(t *testing.T) {
+			var posts int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&posts, 1)
+				if failure == "dropped" {
+					dropConnection(w)
+					return
+				}
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+			}))
+			t.Cleanup(ts.Close)
+
+			var retries int32
+			client := &http.Client{Transport: fastRetryPolicy(&retries).Wrap(http.DefaultTransport)}
+			resp, err := client.Post(ts.URL+"/reboot_web_app.cgi", "application/x-www-form-urlencoded", strings.NewReader("csrf_token=x"))
+			if err == nil {
+				resp.Body.Close()
+			}
+
+			if posts != 1 || retries != 0 {
+				t.Fatalf("reboot POST sent %d times with %d retries, want exactly once", posts, retries)
+			}
+		})
+	}
+}
+
+func TestRetryPostWhenConnectionRefused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var retries int32
+	client := &http.Client{Transport: fastRetryPolicy(&retries).Wrap(http.DefaultTransport)}
+	if _, err := client.Post("http://"+addr+"/reboot_web_app.cgi", "text/plain", strings.NewReader("x")); err == nil {
+		t.Fatal("expected connection refused")
+	}
+	if retries != RETRY_ATTEMPTS-1 {
+		t.Fatalf("a POST that was never sent should be retried %d times, got %d", RETRY_ATTEMPTS-1, retries)
+	}
+}
+
+func TestRetryPostAfterConnectTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	// A deadline that has passed before dialing fails the way a dropped SYN
+	// does: "dial tcp ...: i/o timeout"
+	dialer := &net.Dialer{Timeout: time.Nanosecond}
+	var retries int32
+	client := &http.Client{Transport: fastRetryPolicy(&retries).Wrap(&http.Transport{DialContext: dialer.DialContext})}
+	if _, err := client.Post("http://"+ln.Addr().String()+"/reboot_web_app.cgi", "text/plain", strings.NewReader("x")); err == nil {
+		t.Fatal("expected a connect timeout")
+	}
+	if retries != RETRY_ATTEMPTS-1 {
+		t.Fatalf("a connect timeout should be retried %d times, got %d", RETRY_ATTEMPTS-1, retries)
+	}
+}
+
+func TestRetryStopsWhenRequestContextEnds(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(50 * time.Millisecond)
+	}))
+	t.Cleanup(ts.Close)
+
+	var retries int32
+	client := &http.Client{Transport: fastRetryPolicy(&retries).Wrap(http.DefaultTransport), Timeout: 10 * time.Millisecond}
+	if _, err := client.Get(ts.URL); err == nil {
+		t.Fatal("expected the client timeout to end the request")
+	}
+	if retries != 0 {
+		t.Fatalf("a request whose deadline passed was retried %d times", retries)
+	}
+}
+
+func TestRetryHonoursIdempotencyKeyAndAttempts(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Retry-After", "120")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	t.Cleanup(ts.Close)
+
+	var retries int32
+	policy := fastRetryPolicy(&retries)
+	policy.Attempts = 4
+	client := &http.Client{Transport: policy.Wrap(http.DefaultTransport)}
+
+	marked, _ := http.NewRequestWithContext(WithIdempotent(context.Background()), http.MethodPost, ts.URL, strings.NewReader("body"))
+	keyed, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader("body"))
+	keyed.Header.Set("X-Idempotency-Key", "request-1")
+	plain, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader("body"))
+
+	for _, tt := range []struct {
+		name     string
+		req      *http.Request
+		attempts int32
+	}{
+		{"context", marked, 4},
+		{"header", keyed, 4},
+		{"neither", plain, 1},
+	} {
+		atomic.StoreInt32(&hits, 0)
+		start := time.Now()
+		resp, err := client.Do(tt.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusTooManyRequests || hits != tt.attempts {
+			t.Fatalf("%s: expected %d attempts ending in 429, got %d attempts and %d", tt.name, tt.attempts, hits, resp.StatusCode)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("%s: Retry-After was not capped by MaxDelay: took %v", tt.name, elapsed)
+		}
+	}
+}
+
+func TestRetryDelayBackoffAndJitter(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 5: time.Second, 30: time.Second} {
+		if got := policy.Delay(attempt); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.Delay(2); got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("jittered delay %v outside ±50%% of 200ms", got)
+		}
+	}
+}
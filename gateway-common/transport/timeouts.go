@@ -0,0 +1,205 @@
+package transport
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Default per-phase deadlines
+const (
+	CONNECT_TIMEOUT         = 10 * time.Second
+	TLS_HANDSHAKE_TIMEOUT   = 10 * time.Second
+	RESPONSE_HEADER_TIMEOUT = 20 * time.Second
+	OVERALL_TIMEOUT         = 30 * time.Second
+)
+
+// Timeouts bounds each phase of a request separately, so that a dead
+// gateway fails fast at connect while a slow one still gets to answer.
+// Zero disables a phase's deadline.
+type Timeouts struct {
+	Connect        time.Duration // TCP connect
+	TLSHandshake   time.Duration // TLS handshake after connecting
+	ResponseHeader time.Duration // from request written to response headers
+	Overall        time.Duration // whole request including retries and body
+}
+
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Connect:        CONNECT_TIMEOUT,
+		TLSHandshake:   TLS_HANDSHAKE_TIMEOUT,
+		ResponseHeader: RESPONSE_HEADER_TIMEOUT,
+		Overall:        OVERALL_TIMEOUT,
+	}
+}
+
+// ParseTimeouts applies a spec such as "connect=3s,header=45s" on top of
+// base. Keys are connect, tls, header and overall.
+func ParseTimeouts(spec string, base Timeouts) (Timeouts, error) {
+	timeouts := base
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return base, fmt.Errorf("invalid timeout %q (expected phase=duration)", field)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d < 0 {
+			return base, fmt.Errorf("invalid duration for %s: %q", key, value)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "connect":
+			timeouts.Connect = d
+		case "tls":
+			timeouts.TLSHandshake = d
+		case "header":
+			timeouts.ResponseHeader = d
+		case "overall":
+			timeouts.Overall = d
+		default:
+			return base, fmt.Errorf("unknown timeout phase %q (expected connect, tls, header or overall)", key)
+		}
+	}
+	return timeouts, nil
+}
+
+func (t Timeouts) String() string {
+	return fmt.Sprintf("connect=%s,tls=%s,header=%s,overall=%s", t.Connect, t.TLSHandshake, t.ResponseHeader, t.Overall)
+}
+
+// GatewayTimeouts is a repeatable flag of "GATEWAY/phase=duration,..."
+// overrides, keyed by gateway address.
+type GatewayTimeouts map[string]string
+
+func (g GatewayTimeouts) String() string {
+	var parts []string
+	for gateway, spec := range g {
+		parts = append(parts, gateway+"/"+spec)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (g GatewayTimeouts) Set(value string) error {
+	gateway, spec, ok := strings.Cut(value, "/")
+	if !ok || gateway == "" {
+		return fmt.Errorf("expected GATEWAY/phase=duration,..., got %q", value)
+	}
+	if _, err := ParseTimeouts(spec, Timeouts{}); err != nil {
+		return err
+	}
+	g[gateway] = spec
+	return nil
+}
+
+// For returns base with any overrides for gateway applied.
+func (g GatewayTimeouts) For(gateway string, base Timeouts) Timeouts {
+	spec, ok := g[gateway]
+	if !ok {
+		return base
+	}
+	timeouts, err := ParseTimeouts(spec, base)
+	if err != nil {
+		return base
+	}
+	return timeouts
+}
+
+// TimingTransport logs a per-phase timing breakdown of every request at
+// debug level, including how far a failed request got.
+type TimingTransport struct {
+	Logger *log.Logger
+}
+
+func (tt TimingTransport) Wrap(next http.RoundTripper) http.RoundTripper {
+	return &timingTransport{next: next, logger: tt.Logger}
+}
+
+type timingTransport struct {
+	next   http.RoundTripper
+	logger *log.Logger
+}
+
+type requestTiming struct {
+	mu     sync.Mutex
+	start  time.Time
+	marks  map[string]time.Time
+	phase  string
+	reused bool
+}
+
+func (r *requestTiming) mark(name, phase string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.marks[name] = time.Now()
+	if phase != "" {
+		r.phase = phase
+	}
+}
+
+func (r *requestTiming) between(from, to string) time.Duration {
+	start, ok1 := r.marks[from]
+	end, ok2 := r.marks[to]
+	if !ok1 || !ok2 {
+		return 0
+	}
+	return end.Sub(start).Round(time.Millisecond)
+}
+
+func (t *timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timing := &requestTiming{start: time.Now(), marks: make(map[string]time.Time), phase: "connect"}
+	timing.marks["start"] = timing.start
+
+	trace := &httptrace.ClientTrace{
+		GetConn:              func(string) { timing.mark("get-conn", "connect") },
+		DNSStart:             func(httptrace.DNSStartInfo) { timing.mark("dns-start", "dns") },
+		DNSDone:              func(httptrace.DNSDoneInfo) { timing.mark("dns-done", "") },
+		ConnectStart:         func(string, string) { timing.mark("connect-start", "connect") },
+		ConnectDone:          func(string, string, error) { timing.mark("connect-done", "") },
+		TLSHandshakeStart:    func() { timing.mark("tls-start", "tls") },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { timing.mark("tls-done", "") },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { timing.mark("wrote", "header") },
+		GotFirstResponseByte: func() { timing.mark("first-byte", "body") },
+		GotConn: func(info httptrace.GotConnInfo) {
+			timing.mark("got-conn", "request")
+			timing.mu.Lock()
+			timing.reused = info.Reused
+			timing.mu.Unlock()
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	resp, err := t.next.RoundTrip(req)
+
+	timing.mu.Lock()
+	defer timing.mu.Unlock()
+
+	total := time.Since(timing.start).Round(time.Millisecond)
+	fields := []any{
+		"method", req.Method,
+		"host", req.URL.Host,
+		"path", req.URL.Path,
+		"reused", timing.reused,
+		"dns", timing.between("dns-start", "dns-done"),
+		"connect", timing.between("connect-start", "connect-done"),
+		"tls", timing.between("tls-start", "tls-done"),
+		"wait", timing.between("wrote", "first-byte"),
+		"total", total,
+	}
+
+	if err != nil {
+		t.logger.Debug("Request Failed", append(fields, "phase", timing.phase, "error", err)...)
+		return nil, err
+	}
+	t.logger.Debug("Request Timing", append(fields, "status", resp.StatusCode)...)
+	return resp, nil
+}
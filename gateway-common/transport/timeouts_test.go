@@ -0,0 +1,54 @@
+package transport
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeouts(t *testing.T) {
+	got, err := ParseTimeouts("connect=2s, header=45s", DefaultTimeouts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultTimeouts()
+	want.Connect = 2 * time.Second
+	want.ResponseHeader = 45 * time.Second
+	if got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	roundTrip, err := ParseTimeouts(want.String(), Timeouts{})
+	if err != nil || roundTrip != want {
+		t.Fatalf("String() does not parse back: %v, %v", roundTrip, err)
+	}
+
+	for _, bad := range []string{"connect", "connect=fast", "dns=1s", "overall=-1s"} {
+		if _, err := ParseTimeouts(bad, DefaultTimeouts()); err == nil {
+			t.Errorf("ParseTimeouts(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestGatewayTimeoutsOverrideOnlyTheirGateway(t *testing.T) {
+	overrides := GatewayTimeouts{}
+	if err := overrides.Set("192.168.1.1/header=60s,overall=90s"); err != nil {
+		t.Fatal(err)
+	}
+	if err := overrides.Set("127.0.0.1:8443/connect=1s"); err != nil {
+		t.Fatal(err)
+	}
+	if err := overrides.Set("header=60s"); err == nil {
+		t.Fatal("an override without a gateway should be rejected")
+	}
+
+	base := DefaultTimeouts()
+	if lan := overrides.For("192.168.1.1", base); lan.ResponseHeader != 60*time.Second || lan.Overall != 90*time.Second || lan.Connect != base.Connect {
+		t.Fatalf("unexpected 192.168.1.1 timeouts %v", lan)
+	}
+	if local := overrides.For("127.0.0.1:8443", base); local.Connect != time.Second {
+		t.Fatalf("unexpected host:port timeouts %v", local)
+	}
+	if other := overrides.For("192.168.0.1", base); other != base {
+		t.Fatalf("gateway without overrides changed: %v", other)
+	}
+}
@@ -0,0 +1,218 @@
+// Package transport holds the HTTP plumbing shared by the gateway clients:
+// certificate trust, retries and per-phase timeouts.
+package transport
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// TLS verification modes
+const (
+	TLS_TOFU   = "tofu"   // pin the certificate seen on first connect
+	TLS_CA     = "ca"     // verify against a custom CA bundle
+	TLS_VERIFY = "verify" // verify against the system roots
+
+	KNOWN_GATEWAYS_FILE = "known_gateways"
+)
+
+// TLSPolicy decides how gateway certificates are trusted.
+type TLSPolicy struct {
+	Mode  string
+	Roots *x509.CertPool // TLS_CA only
+	Known *KnownGateways // TLS_TOFU only
+}
+
+// NewTLSPolicy validates mode and loads whatever it needs up front so that
+// misconfiguration is reported before any gateway is contacted.
+func NewTLSPolicy(mode, caFile, knownGatewaysPath string) (*TLSPolicy, error) {
+	switch strings.ToLower(mode) {
+	case TLS_TOFU:
+		return &TLSPolicy{Mode: TLS_TOFU, Known: &KnownGateways{Path: knownGatewaysPath}}, nil
+	case TLS_CA:
+		if caFile == "" {
+			return nil, fmt.Errorf("TLS mode %q requires a CA file", TLS_CA)
+		}
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		return &TLSPolicy{Mode: TLS_CA, Roots: roots}, nil
+	case TLS_VERIFY:
+		return &TLSPolicy{Mode: TLS_VERIFY}, nil
+	default:
+		return nil, fmt.Errorf("unknown TLS mode %q (expected %s, %s or %s)", mode, TLS_TOFU, TLS_CA, TLS_VERIFY)
+	}
+}
+
+// DefaultTLSPolicy pins certificates in app's per-user known gateways file.
+func DefaultTLSPolicy(app string) *TLSPolicy {
+	return &TLSPolicy{Mode: TLS_TOFU, Known: &KnownGateways{Path: DefaultKnownGatewaysPath(app)}}
+}
+
+// DefaultKnownGatewaysPath is the known gateways file in app's directory
+// under the user config directory.
+func DefaultKnownGatewaysPath(app string) string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return KNOWN_GATEWAYS_FILE
+	}
+	return filepath.Join(configDir, app, KNOWN_GATEWAYS_FILE)
+}
+
+// Config returns the tls.Config for connections to hostport.
+func (p *TLSPolicy) Config(hostport string) *tls.Config {
+	switch p.Mode {
+	case TLS_CA:
+		return &tls.Config{RootCAs: p.Roots}
+	case TLS_TOFU:
+		// Chain verification is replaced by the pin check below; gateways
+		// ship self-signed certificates that no root would accept.
+		return &tls.Config{
+			InsecureSkipVerify: true,
+			VerifyConnection: func(cs tls.ConnectionState) error {
+				if len(cs.PeerCertificates) == 0 {
+					return fmt.Errorf("gateway %s presented no certificate", hostport)
+				}
+				return p.Known.Check(hostport, Fingerprint(cs.PeerCertificates[0]))
+			},
+		}
+	default:
+		return &tls.Config{}
+	}
+}
+
+// Fingerprint is the SHA-256 of the DER certificate, as "sha256:<hex>".
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// PinMismatchError is returned when a gateway presents a certificate other
+// than the one pinned on first use.
+type PinMismatchError struct {
+	Host     string
+	Expected string
+	Got      string
+	Path     string
+}
+
+func (e *PinMismatchError) Error() string {
+	return fmt.Sprintf("certificate for %s has CHANGED (pinned %s, got %s); "+
+		"this may be a man-in-the-middle attack. If the gateway was reset or replaced, remove its line from %s",
+		e.Host, e.Expected, e.Got, e.Path)
+}
+
+// KnownGateways is a trust-on-first-use store of "host:port fingerprint"
+// lines. The file is re-read on every check so concurrent clients agree.
+type KnownGateways struct {
+	Path string
+
+	// OnTrust, if set, is called when a new gateway is pinned.
+	OnTrust func(host, fingerprint string)
+
+	mu sync.Mutex
+}
+
+// Check accepts a pinned fingerprint, pins an unknown host and rejects a
+// changed certificate.
+func (k *KnownGateways) Check(host, fingerprint string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	known, err := k.load()
+	if err != nil {
+		return err
+	}
+
+	if pinned, ok := known[host]; ok {
+		if pinned != fingerprint {
+			return &PinMismatchError{Host: host, Expected: pinned, Got: fingerprint, Path: k.Path}
+		}
+		return nil
+	}
+
+	if err := k.append(host, fingerprint); err != nil {
+		return err
+	}
+	if k.OnTrust != nil {
+		k.OnTrust(host, fingerprint)
+	}
+	return nil
+}
+
+// Lookup returns the pinned fingerprint for host, if any.
+func (k *KnownGateways) Lookup(host string) (string, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	known, err := k.load()
+	if err != nil {
+		return "", false, err
+	}
+	fingerprint, ok := known[host]
+	return fingerprint, ok, nil
+}
+
+func (k *KnownGateways) load() (map[string]string, error) {
+	known := make(map[string]string)
+
+	f, err := os.Open(k.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return known, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open known gateways: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"host:port fingerprint\"", k.Path, line)
+		}
+		known[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read known gateways: %w", err)
+	}
+
+	return known, nil
+}
+
+func (k *KnownGateways) append(host, fingerprint string) error {
+	if dir := filepath.Dir(k.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create known gateways directory: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(k.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open known gateways: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "%s %s\n", host, fingerprint); err != nil {
+		return fmt.Errorf("failed to pin gateway certificate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKnownGatewaysPinsAndRejectsChanges(t *testing.T) {
+	known := &KnownGateways{Path: filepath.Join(t.TempDir(), "state", KNOWN_GATEWAYS_FILE)}
+	var trusted []string
+	known.OnTrust = func(host, fingerprint string) { trusted = append(trusted, host) }
+
+	first := "sha256:" + strings.Repeat("01", 32)
+	for i := 0; i < 2; i++ {
+		if err := known.Check("192.168.1.1:443", first); err != nil {
+			t.Fatalf("check %d failed: %v", i+1, err)
+		}
+	}
+	if len(trusted) != 1 {
+		t.Fatalf("expected a single pin, got %v", trusted)
+	}
+
+	info, err := os.Stat(known.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("known gateways file has mode %v, want 0600", info.Mode().Perm())
+	}
+
+	changed := "sha256:" + strings.Repeat("02", 32)
+	err = known.Check("192.168.1.1:443", changed)
+	var pinErr *PinMismatchError
+	if !errors.As(err, &pinErr) {
+		t.Fatalf("expected PinMismatchError, got %v", err)
+	}
+	if pinErr.Expected != first || pinErr.Got != changed || pinErr.Path != known.Path {
+		t.Fatalf("unexpected mismatch details: %+v", pinErr)
+	}
+}
+
+func TestKnownGatewaysRejectsMalformedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), KNOWN_GATEWAYS_FILE)
+	if err := os.WriteFile(path, []byte("# comment\n192.168.1.1:443\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	known := &KnownGateways{Path: path}
+	if _, _, err := known.Lookup("192.168.1.1:443"); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Fatalf("expected a line-numbered parse error, got %v", err)
+	}
+}
+
+func TestNewTLSPolicyRejectsBadConfig(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, []byte("not a certificate"), 0644)
+
+	for _, tt := range []struct{ mode, caFile string }{
+		{"insecure", ""},
+		{"ca", ""},
+		{"ca", empty},
+		{"ca", filepath.Join(t.TempDir(), "missing.pem")},
+	} {
+		if _, err := NewTLSPolicy(tt.mode, tt.caFile, ""); err == nil {
+			t.Errorf("NewTLSPolicy(%q, %q) succeeded, want error", tt.mode, tt.caFile)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gateway-common/redact"
+)
+
+const (
+	API_LISTEN    = "127.0.0.1:8081"
+	API_TOKEN_ENV = "ORBI_API_TOKEN"
+)
+
+// openapi.json documents the REST API served by the api command.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// APIDevices is the router's device list as served by the API.
+type APIDevices struct {
+	Total    int      `json:"total"`
+	Active   []Device `json:"active"`
+	Inactive []Device `json:"inactive"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// APIServer exposes the router over HTTP for dashboards and phone
+// shortcuts. Router requests are serialized.
+type APIServer struct {
+	Client       *Client
+	RegistryPath string
+	Token        string
+
+	mu sync.Mutex
+}
+
+// LoadAPIToken reads the bearer token from path, or from the environment
+// when no path is given. An API without a token is refused.
+func LoadAPIToken(path string) (string, error) {
+	token := os.Getenv(API_TOKEN_ENV)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read API token: %w", err)
+		}
+		token = string(data)
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("no API token; set %s or use -api-token-file", API_TOKEN_ENV)
+	}
+	redact.Register(token)
+	return token, nil
+}
+
+// Handler serves the REST API. Everything except the OpenAPI document
+// requires the bearer token.
+func (a *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /openapi.json", a.handleOpenAPI)
+	mux.Handle("GET /orbi/devices", a.authorized(a.handleDevices))
+	mux.Handle("POST /orbi/reboot", a.authorized(a.handleReboot))
+	return mux
+}
+
+// ListenAndServe runs the API on addr until ctx is cancelled.
+func (a *APIServer) ListenAndServe(ctx context.Context, addr string) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           a.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	a.Client.Logger.Info("API Listening", "addr", addr)
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (a *APIServer) authorized(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="netgear-orbi"`)
+			writeAPIJSON(w, http.StatusUnauthorized, apiError{Error: "missing or invalid bearer token"})
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (a *APIServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+func (a *APIServer) handleDevices(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	info, err := a.Client.GetDevices()
+	a.mu.Unlock()
+	if err != nil {
+		writeAPIJSON(w, http.StatusBadGateway, apiError{Error: fmt.Sprintf("failed to get devices: %s", err)})
+		return
+	}
+
+	// A broken registry only costs the friendly names
+	if registry, err := LoadRegistry(a.RegistryPath); err == nil {
+		registry.Annotate(info)
+	} else {
+		a.Client.Logger.Warn("Could not load registry", "error", err)
+	}
+
+	writeAPIJSON(w, http.StatusOK, APIDevices{
+		Total:    info.TotalCount,
+		Active:   append([]Device{}, info.ActiveDevices...),
+		Inactive: append([]Device{}, info.InactiveDevices...),
+	})
+}
+
+// Reboots answer 202 because the router only starts going down.
+func (a *APIServer) handleReboot(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	err := a.Client.RebootRouter()
+	a.mu.Unlock()
+	if err != nil {
+		writeAPIJSON(w, http.StatusBadGateway, apiError{Error: fmt.Sprintf("failed to reboot router: %s", err)})
+		return
+	}
+	a.Client.Logger.Info("Reboot Sent", "remote", r.RemoteAddr)
+	writeAPIJSON(w, http.StatusAccepted, map[string]string{"result": "rebooting"})
+}
+
+func writeAPIJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"netgear-orbi-go/mockrouter"
+)
+
+func TestAPIDevicesAndReboot(t *testing.T) {
+	server, client := newMockClient(t, mockrouter.Config{Devices: testDevices})
+	api := &APIServer{Client: client, RegistryPath: filepath.Join(t.TempDir(), "devices.json"), Token: "phone-shortcut-token"}
+	ts := httptest.NewServer(api.Handler())
+	t.Cleanup(ts.Close)
+
+	call := func(method, path, token string) *http.Response {
+		req, _ := http.NewRequest(method, ts.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	for _, token := range []string{"", "guess"} {
+		if resp := call(http.MethodGet, "/orbi/devices", token); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("token %q: got %d, want 401", token, resp.StatusCode)
+		}
+	}
+	if resp := call(http.MethodGet, "/openapi.json", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("openapi.json: got %d", resp.StatusCode)
+	}
+
+	var devices APIDevices
+	resp := call(http.MethodGet, "/orbi/devices", api.Token)
+	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /orbi/devices: %d %v", resp.StatusCode, err)
+	}
+	if devices.Total != 3 || len(devices.Active) != 1 || devices.Active[0].Vendor != "Apple, Inc." {
+		t.Fatalf("unexpected devices: %+v", devices)
+	}
+
+	if resp := call(http.MethodPost, "/orbi/reboot", api.Token); resp.StatusCode != http.StatusAccepted || server.Reboots() != 1 {
+		t.Fatalf("POST /orbi/reboot: got %d with %d reboots", resp.StatusCode, server.Reboots())
+	}
+}
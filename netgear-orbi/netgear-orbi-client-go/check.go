@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Nagios plugin exit codes
+const (
+	CHECK_OK       = 0
+	CHECK_WARNING  = 1
+	CHECK_CRITICAL = 2
+	CHECK_UNKNOWN  = 3
+)
+
+var checkStateNames = map[int]string{
+	CHECK_OK:       "OK",
+	CHECK_WARNING:  "WARNING",
+	CHECK_CRITICAL: "CRITICAL",
+	CHECK_UNKNOWN:  "UNKNOWN",
+}
+
+// CheckThresholds are the minimum numbers of active devices below which the
+// check command alerts. Zero disables a limit.
+type CheckThresholds struct {
+	WarningActive  int
+	CriticalActive int
+}
+
+func (t CheckThresholds) Validate() error {
+	if t.WarningActive < 0 || t.CriticalActive < 0 {
+		return fmt.Errorf("thresholds must not be negative")
+	}
+	if t.WarningActive > 0 && t.CriticalActive > 0 && t.WarningActive < t.CriticalActive {
+		return fmt.Errorf("active device warning minimum %d is below the critical minimum %d", t.WarningActive, t.CriticalActive)
+	}
+	return nil
+}
+
+// CheckResult is the outcome of one check run.
+type CheckResult struct {
+	State    int
+	Message  string
+	Perfdata []string
+}
+
+// String is the plugin's single output line:
+// ORBI STATE - message | perfdata
+func (r *CheckResult) String() string {
+	// A "|" in the message would be taken as the start of the perfdata
+	line := fmt.Sprintf("ORBI %s - %s", checkStateNames[r.State], strings.ReplaceAll(r.Message, "|", "/"))
+	if len(r.Perfdata) > 0 {
+		line += " | " + strings.Join(r.Perfdata, " ")
+	}
+	return line
+}
+
+// minimumRange renders an alert-below threshold as a Nagios range ("n:"),
+// empty when disabled.
+func minimumRange(limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	return strconv.Itoa(limit) + ":"
+}
+
+// EvaluateDevices checks the router's device list against the thresholds.
+func EvaluateDevices(info *DeviceInfo, t CheckThresholds) *CheckResult {
+	active := len(info.ActiveDevices)
+	result := &CheckResult{
+		State:   CHECK_OK,
+		Message: fmt.Sprintf("%d devices, %d active", info.TotalCount, active),
+		Perfdata: []string{
+			fmt.Sprintf("'devices'=%d;;;0;", info.TotalCount),
+			fmt.Sprintf("'active'=%d;%s;%s;0;", active, minimumRange(t.WarningActive), minimumRange(t.CriticalActive)),
+			fmt.Sprintf("'inactive'=%d;;;0;", len(info.InactiveDevices)),
+		},
+	}
+
+	switch {
+	case t.CriticalActive > 0 && active < t.CriticalActive:
+		result.State = CHECK_CRITICAL
+		result.Message = fmt.Sprintf("only %d active devices, expected at least %d", active, t.CriticalActive)
+	case t.WarningActive > 0 && active < t.WarningActive:
+		result.State = CHECK_WARNING
+		result.Message = fmt.Sprintf("only %d active devices, expected at least %d", active, t.WarningActive)
+	}
+	return result
+}
+
+// RunCheck fetches the device list and evaluates it. A router that cannot
+// be logged in to or queried is CRITICAL; one with no password to log in
+// with is UNKNOWN, since nothing was checked.
+func RunCheck(client *Client, t CheckThresholds) *CheckResult {
+	info, err := client.GetDevices()
+	if errors.Is(err, ErrNoPassword) {
+		return &CheckResult{State: CHECK_UNKNOWN, Message: err.Error()}
+	}
+	if err != nil {
+		return &CheckResult{State: CHECK_CRITICAL, Message: fmt.Sprintf("router unavailable: %s", err)}
+	}
+	return EvaluateDevices(info, t)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"netgear-orbi-go/mockrouter"
+)
+
+func TestCheckActiveDeviceThresholds(t *testing.T) {
+	_, client := newMockClient(t, mockrouter.Config{Devices: testDevices})
+
+	for _, tt := range []struct {
+		thresholds CheckThresholds
+		want       int
+		output     string
+	}{
+		{CheckThresholds{}, CHECK_OK, "ORBI OK - 3 devices, 1 active | 'devices'=3;;;0; 'active'=1;;;0; 'inactive'=2;;;0;"},
+		{CheckThresholds{WarningActive: 2}, CHECK_WARNING, "ORBI WARNING - only 1 active devices, expected at least 2 | 'devices'=3;;;0; 'active'=1;2:;;0;"},
+		{CheckThresholds{WarningActive: 3, CriticalActive: 2}, CHECK_CRITICAL, "'active'=1;3:;2:;0;"},
+	} {
+		result := RunCheck(client, tt.thresholds)
+		if result.State != tt.want || !strings.Contains(result.String(), tt.output) {
+			t.Errorf("%+v: got state %d, %q; want state %d containing %q", tt.thresholds, result.State, result.String(), tt.want, tt.output)
+		}
+	}
+
+	if (CheckThresholds{WarningActive: 1, CriticalActive: 2}).Validate() == nil {
+		t.Fatal("expected a warning minimum below the critical one to be rejected")
+	}
+
+	client.Password = "wrong-password"
+	if result := RunCheck(client, CheckThresholds{}); result.State != CHECK_CRITICAL || !strings.HasPrefix(result.String(), "ORBI CRITICAL - router unavailable") {
+		t.Fatalf("failed login: %s", result)
+	}
+
+	client.Password = ""
+	if result := RunCheck(client, CheckThresholds{}); result.State != CHECK_UNKNOWN || !strings.HasPrefix(result.String(), "ORBI UNKNOWN - no router password") {
+		t.Fatalf("missing password: %s", result)
+	}
+}
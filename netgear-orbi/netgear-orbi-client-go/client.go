@@ -1,9 +1,9 @@
 package main
 
 import (
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
@@ -12,16 +12,28 @@ import (
 	"time"
 
 	"github.com/charmbracelet/log"
+
+	"gateway-common/transport"
 )
 
 const (
 	ORBI_GATEWAY_IP = "192.168.10.254"
 	ORBI_USERNAME   = "admin"
-	ORBI_PASSWORD   = "Home-404_BOM"
+
+	// Directory under the user config directory for this tool's files
+	CONFIG_DIR = "netgear-orbi"
+
+	// Tag for syslog and journald records
+	LOG_IDENTIFIER = "netgear-orbi-go"
 
 	DEV_DEVICE_INFO_PATH = "/DEV_device_info.htm"
 	REBOOT_PATH          = "/reboot.htm"
 	APPLY_CGI_PATH       = "/apply.cgi"
+
+	// Recovery polling after a reboot
+	RECOVERY_INITIAL_DELAY = 2 * time.Second
+	RECOVERY_MAX_DELAY     = 30 * time.Second
+	RECOVERY_DOWN_GRACE    = 90 * time.Second
 )
 
 type Client struct {
@@ -30,6 +42,9 @@ type Client struct {
 	Password   string
 	HTTPClient *http.Client
 	Logger     *log.Logger
+	Recovery   RecoveryPolicy
+
+	transport *http.Transport
 }
 
 type Device struct {
@@ -38,6 +53,24 @@ type Device struct {
 	MAC         string `json:"mac"`
 	ConnType    string `json:"conn_type"`
 	BackhaulSta string `json:"backhaul_sta,omitempty"`
+
+	// Populated from the embedded OUI database
+	Vendor        string `json:"vendor,omitempty"`
+	RandomizedMAC bool   `json:"randomized_mac,omitempty"`
+
+	// Populated from the local registry, not by the router
+	FriendlyName string   `json:"friendly_name,omitempty"`
+	Owner        string   `json:"owner,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	Known        bool     `json:"known,omitempty"`
+}
+
+// DisplayName prefers the registry's friendly name over the router's name.
+func (d Device) DisplayName() string {
+	if d.FriendlyName != "" {
+		return d.FriendlyName
+	}
+	return d.Name
 }
 
 type DeviceInfo struct {
@@ -47,31 +80,88 @@ type DeviceInfo struct {
 	TotalCount       int
 }
 
+// RecoveryPolicy paces WaitForRecovery. Polls start InitialDelay apart and
+// back off to MaxDelay; an answer within DownGrace of the reboot, before the
+// router was seen down, does not count as recovery.
+type RecoveryPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	DownGrace    time.Duration
+}
+
+func DefaultRecoveryPolicy() RecoveryPolicy {
+	return RecoveryPolicy{
+		InitialDelay: RECOVERY_INITIAL_DELAY,
+		MaxDelay:     RECOVERY_MAX_DELAY,
+		DownGrace:    RECOVERY_DOWN_GRACE,
+	}
+}
+
+type RecoveryResult struct {
+	RebootAt time.Time
+	DownAt   time.Time
+	BackAt   time.Time
+	Attempts int
+	Devices  *DeviceInfo
+}
+
+// Downtime is measured from the first failed poll when the outage was
+// observed, otherwise from the moment the reboot was requested.
+func (r *RecoveryResult) Downtime() time.Duration {
+	if r.DownAt.IsZero() {
+		return r.BackAt.Sub(r.RebootAt)
+	}
+	return r.BackAt.Sub(r.DownAt)
+}
+
 func NewClient(logger *log.Logger) *Client {
 	baseURL := fmt.Sprintf("http://%s", ORBI_GATEWAY_IP)
 	jar, _ := cookiejar.New(nil)
+	tr := &http.Transport{}
 
-	return &Client{
+	c := &Client{
 		BaseURL:  baseURL,
 		Username: ORBI_USERNAME,
-		Password: ORBI_PASSWORD,
 		HTTPClient: &http.Client{
-			Timeout: 30 * time.Second,
-			Jar:     jar,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-			},
+			Jar:       jar,
+			Transport: tr,
 		},
-		Logger: logger,
+		Logger:    logger,
+		Recovery:  DefaultRecoveryPolicy(),
+		transport: tr,
 	}
+	c.SetTLSPolicy(transport.DefaultTLSPolicy(CONFIG_DIR))
+	c.SetTimeouts(transport.DefaultTimeouts())
+
+	return c
+}
+
+// SetTLSPolicy replaces how the router's certificate is verified when
+// BaseURL uses https. Call it again after changing BaseURL.
+func (c *Client) SetTLSPolicy(policy *transport.TLSPolicy) {
+	host := c.BaseURL
+	if u, err := url.Parse(c.BaseURL); err == nil {
+		host = u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+	}
+	c.transport.TLSClientConfig = policy.Config(host)
+}
+
+// WrapTransport inserts a transport between the client and the network,
+// e.g. to retry transient failures.
+func (c *Client) WrapTransport(wrap func(http.RoundTripper) http.RoundTripper) {
+	c.HTTPClient.Transport = wrap(c.HTTPClient.Transport)
 }
 
 func (c *Client) GetDevices() (*DeviceInfo, error) {
 	timestamp := time.Now().Unix()
 	requestURL := fmt.Sprintf("%s%s?ts=%d", c.BaseURL, DEV_DEVICE_INFO_PATH, timestamp)
 
+	if c.Password == "" {
+		return nil, ErrNoPassword
+	}
 	req, err := http.NewRequest("GET", requestURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -123,6 +213,10 @@ func (c *Client) GetDevices() (*DeviceInfo, error) {
 }
 
 func (c *Client) processDevices(devices []Device) *DeviceInfo {
+	for i := range devices {
+		annotateVendor(&devices[i])
+	}
+
 	info := &DeviceInfo{
 		ConnectedDevices: devices,
 		TotalCount:       len(devices),
@@ -142,6 +236,9 @@ func (c *Client) processDevices(devices []Device) *DeviceInfo {
 func (c *Client) getTimestampFromRebootPage() (string, error) {
 	requestURL := fmt.Sprintf("%s%s", c.BaseURL, REBOOT_PATH)
 
+	if c.Password == "" {
+		return "", ErrNoPassword
+	}
 	req, err := http.NewRequest("GET", requestURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
@@ -188,7 +285,9 @@ func (c *Client) RebootRouter() error {
 		return fmt.Errorf("failed to get timestamp: %w", err)
 	}
 
-	requestURL := fmt.Sprintf("%s%s?/reboot_waiting.htm timestamp=%s",
+	// Browsers send the form action's space encoded; a raw space would
+	// corrupt the request line
+	requestURL := fmt.Sprintf("%s%s?/reboot_waiting.htm%%20timestamp=%s",
 		c.BaseURL, APPLY_CGI_PATH, timestamp)
 
 	formData := url.Values{
@@ -220,3 +319,68 @@ func (c *Client) RebootRouter() error {
 
 	return nil
 }
+
+// WaitForRecovery polls DEV_device_info.htm with exponential backoff until the
+// router answers again after a reboot, or until timeout elapses.
+func (c *Client) WaitForRecovery(rebootAt time.Time, timeout time.Duration) (*RecoveryResult, error) {
+	result := &RecoveryResult{RebootAt: rebootAt}
+	deadline := rebootAt.Add(timeout)
+	delay := c.Recovery.InitialDelay
+
+	for time.Now().Before(deadline) {
+		time.Sleep(min(delay, time.Until(deadline)))
+		result.Attempts++
+
+		devices, err := c.GetDevices()
+		now := time.Now()
+		if err != nil {
+			if result.DownAt.IsZero() {
+				result.DownAt = now
+				c.Logger.Debug("Router went down", "after", now.Sub(rebootAt).Round(time.Second))
+			} else {
+				c.Logger.Debug("Router still unreachable", "attempt", result.Attempts, "error", err)
+			}
+			delay = min(delay*2, c.Recovery.MaxDelay)
+			continue
+		}
+
+		// The router may keep answering for a few seconds before it actually
+		// goes down, so don't treat an early response as recovery. Back off
+		// here too rather than hammer a router that is busy shutting down.
+		if result.DownAt.IsZero() && now.Sub(rebootAt) < c.Recovery.DownGrace {
+			c.Logger.Debug("Router not down yet", "attempt", result.Attempts)
+			delay = min(delay*2, c.Recovery.MaxDelay)
+			continue
+		}
+
+		result.BackAt = now
+		result.Devices = devices
+		return result, nil
+	}
+
+	return result, fmt.Errorf("router did not recover within %s", timeout)
+}
+
+// ReconnectedDevices splits the pre-reboot snapshot into devices that are
+// present again after recovery and devices that are still missing, by MAC.
+func ReconnectedDevices(before, after *DeviceInfo) (reconnected, missing []Device) {
+	present := make(map[string]bool)
+	if after != nil {
+		for _, device := range after.ConnectedDevices {
+			present[strings.ToLower(device.MAC)] = true
+		}
+	}
+
+	if before == nil {
+		return nil, nil
+	}
+	for _, device := range before.ConnectedDevices {
+		if present[strings.ToLower(device.MAC)] {
+			reconnected = append(reconnected, device)
+		} else {
+			missing = append(missing, device)
+		}
+	}
+
+	return reconnected, missing
+}
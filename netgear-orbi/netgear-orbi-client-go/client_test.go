@@ -0,0 +1,240 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"netgear-orbi-go/mockrouter"
+)
+
+// TEST_PASSWORD is what the mock router accepts; the client has no built-in
+// password, so tests hand it over explicitly.
+const TEST_PASSWORD = "test-password"
+
+var testDevices = []mockrouter.Device{
+	{Name: "Kitchen Speaker", IP: "192.168.10.21", MAC: "3C:22:FB:10:20:30", ConnType: "wireless", BackhaulSta: "Good"},
+	{Name: "NAS", IP: "192.168.10.5", MAC: "B8:27:EB:AA:BB:CC", ConnType: "wired"},
+	{Name: "Satellite", IP: "192.168.10.2", MAC: "A0:40:A0:00:00:02", ConnType: "wireless", BackhaulSta: "Poor"},
+}
+
+func newMockClient(t *testing.T, cfg mockrouter.Config) (*mockrouter.Server, *Client) {
+	t.Helper()
+
+	if cfg.Username == "" {
+		cfg.Username = ORBI_USERNAME
+		cfg.Password = TEST_PASSWORD
+	}
+	server, ts := mockrouter.NewServer(cfg)
+	t.Cleanup(ts.Close)
+
+	client := NewClient(log.New(io.Discard))
+	client.BaseURL = ts.URL
+	client.Password = TEST_PASSWORD
+	client.HTTPClient.Timeout = 5 * time.Second
+
+	return server, client
+}
+
+func TestGetDevices(t *testing.T) {
+	_, client := newMockClient(t, mockrouter.Config{Devices: testDevices})
+
+	info, err := client.GetDevices()
+	if err != nil {
+		t.Fatalf("GetDevices failed: %v", err)
+	}
+	if info.TotalCount != 3 || len(info.ActiveDevices) != 1 || len(info.InactiveDevices) != 2 {
+		t.Fatalf("unexpected counts: total=%d active=%d inactive=%d",
+			info.TotalCount, len(info.ActiveDevices), len(info.InactiveDevices))
+	}
+	if info.ActiveDevices[0].Name != "Kitchen Speaker" || info.ActiveDevices[0].Vendor != "Apple, Inc." {
+		t.Fatalf("unexpected active device: %+v", info.ActiveDevices[0])
+	}
+}
+
+func TestGetDevicesEmptyList(t *testing.T) {
+	_, client := newMockClient(t, mockrouter.Config{})
+
+	info, err := client.GetDevices()
+	if err != nil {
+		t.Fatalf("GetDevices failed: %v", err)
+	}
+	if info.TotalCount != 0 {
+		t.Fatalf("expected no devices, got %d", info.TotalCount)
+	}
+}
+
+func TestGetDevicesWrongPassword(t *testing.T) {
+	server, client := newMockClient(t, mockrouter.Config{Devices: testDevices})
+	client.Password = "wrong"
+
+	_, err := client.GetDevices()
+	if err == nil || !strings.Contains(err.Error(), "HTTP error 401") {
+		t.Fatalf("expected HTTP 401, got %v", err)
+	}
+	if server.AuthFailures() != 1 {
+		t.Fatalf("expected 1 auth failure, got %d", server.AuthFailures())
+	}
+}
+
+func TestGetDevicesMalformedPage(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{"missing device line", "<html>nothing here</html>", "device data not found"},
+		{"invalid json", "<html>\ndevice=[{\"name\": \n</html>", "failed to parse device JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, client := newMockClient(t, mockrouter.Config{DeviceInfoPage: tt.page})
+
+			_, err := client.GetDevices()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestProcessDevices(t *testing.T) {
+	client := NewClient(log.New(io.Discard))
+	devices := []Device{
+		{Name: "a", MAC: "00:00:00:00:00:01", BackhaulSta: "Good"},
+		{Name: "b", MAC: "02:00:00:00:00:02", BackhaulSta: "Poor"},
+		{Name: "c", MAC: "00:00:00:00:00:03"},
+	}
+
+	info := client.processDevices(devices)
+
+	if info.TotalCount != 3 || len(info.ConnectedDevices) != 3 {
+		t.Fatalf("expected 3 devices, got %d", info.TotalCount)
+	}
+	if len(info.ActiveDevices) != 1 || info.ActiveDevices[0].Name != "a" {
+		t.Fatalf("only backhaul Good should be active, got %+v", info.ActiveDevices)
+	}
+	if len(info.InactiveDevices) != 2 {
+		t.Fatalf("expected 2 inactive devices, got %d", len(info.InactiveDevices))
+	}
+	if !info.InactiveDevices[0].RandomizedMAC || info.ActiveDevices[0].Vendor != "XEROX CORPORATION" {
+		t.Fatalf("expected vendor annotations, got %+v", info.ConnectedDevices)
+	}
+}
+
+func TestGetTimestampFromRebootPage(t *testing.T) {
+	_, client := newMockClient(t, mockrouter.Config{})
+
+	timestamp, err := client.getTimestampFromRebootPage()
+	if err != nil {
+		t.Fatalf("getTimestampFromRebootPage failed: %v", err)
+	}
+	if timestamp == "" || strings.Trim(timestamp, "0123456789") != "" {
+		t.Fatalf("expected a numeric timestamp, got %q", timestamp)
+	}
+}
+
+func TestRebootRouter(t *testing.T) {
+	server, client := newMockClient(t, mockrouter.Config{
+		Devices:      testDevices,
+		RebootOutage: 300 * time.Millisecond,
+	})
+
+	if err := client.RebootRouter(); err != nil {
+		t.Fatalf("RebootRouter failed: %v", err)
+	}
+	if server.Reboots() != 1 {
+		t.Fatalf("expected 1 reboot, got %d", server.Reboots())
+	}
+
+	if _, err := client.GetDevices(); err == nil {
+		t.Fatal("expected the router to be unreachable during the outage")
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	if _, err := client.GetDevices(); err != nil {
+		t.Fatalf("expected the router to be back, got %v", err)
+	}
+}
+
+func TestRebootRouterWrongPassword(t *testing.T) {
+	server, client := newMockClient(t, mockrouter.Config{})
+	client.Password = "wrong"
+
+	err := client.RebootRouter()
+	if err == nil || !strings.Contains(err.Error(), "failed to get timestamp") {
+		t.Fatalf("expected timestamp failure, got %v", err)
+	}
+	if server.Reboots() != 0 {
+		t.Fatal("router should not have rebooted")
+	}
+}
+
+func fastRecovery() RecoveryPolicy {
+	return RecoveryPolicy{InitialDelay: 20 * time.Millisecond, MaxDelay: 80 * time.Millisecond, DownGrace: 5 * time.Second}
+}
+
+func TestWaitForRecovery(t *testing.T) {
+	after := testDevices[:2]
+	_, client := newMockClient(t, mockrouter.Config{
+		Devices:            testDevices,
+		DevicesAfterReboot: after,
+		RebootOutage:       300 * time.Millisecond,
+	})
+	client.Recovery = fastRecovery()
+
+	rebootAt := time.Now()
+	if err := client.RebootRouter(); err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.WaitForRecovery(rebootAt, 3*time.Second)
+	if err != nil {
+		t.Fatalf("WaitForRecovery failed: %v (%+v)", err, result)
+	}
+	if result.DownAt.IsZero() || !result.BackAt.After(result.DownAt) || result.Attempts < 2 {
+		t.Fatalf("expected an outage followed by recovery, got %+v", result)
+	}
+	if result.Devices == nil || result.Devices.TotalCount != len(after) {
+		t.Fatalf("expected the post-reboot device list, got %+v", result.Devices)
+	}
+}
+
+func TestWaitForRecoveryTimesOut(t *testing.T) {
+	_, client := newMockClient(t, mockrouter.Config{Devices: testDevices, RebootOutage: time.Minute})
+	client.Recovery = fastRecovery()
+
+	rebootAt := time.Now()
+	if err := client.RebootRouter(); err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.WaitForRecovery(rebootAt, 300*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "did not recover") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if result.DownAt.IsZero() || !result.BackAt.IsZero() {
+		t.Fatalf("expected the router to be seen down and never back, got %+v", result)
+	}
+	if elapsed := time.Since(rebootAt); elapsed > 2*time.Second {
+		t.Fatalf("waited %s, well past the timeout", elapsed)
+	}
+}
+
+func TestWaitForRecoveryBacksOffBeforeOutage(t *testing.T) {
+	// A router that keeps answering: polls during the grace period back off
+	// instead of running at the initial pace
+	_, client := newMockClient(t, mockrouter.Config{Devices: testDevices})
+	client.Recovery = RecoveryPolicy{InitialDelay: 10 * time.Millisecond, MaxDelay: time.Second, DownGrace: 250 * time.Millisecond}
+
+	result, err := client.WaitForRecovery(time.Now(), 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10+20+40+80+160ms covers the grace period; a fixed pace would poll 25 times
+	if !result.DownAt.IsZero() || result.Attempts > 6 {
+		t.Fatalf("expected a few backed-off polls, got %d attempts (%+v)", result.Attempts, result)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gateway-common/credstore"
+	"gateway-common/redact"
+)
+
+const (
+	KEYRING_SERVICE = "netgear-orbi-go"
+	PASSPHRASE_ENV  = "ORBI_PASSPHRASE"
+	PASSWORD_ENV    = "ORBI_PASSWORD"
+)
+
+// ErrNoPassword is returned by requests made before a password was
+// resolved; the client has no built-in one.
+var ErrNoPassword = errors.New("no router password; run -cmd credentials set or set $" + PASSWORD_ENV)
+
+// OpenCredentialStore opens the keyring entry or encrypted file that holds
+// the router credentials. Keyring entries are keyed by "router" as before.
+func OpenCredentialStore(backend, path string, passphrase credstore.PassphraseFunc) (credstore.Store, error) {
+	return credstore.Open(backend, &credstore.KeyringStore{Service: KEYRING_SERVICE, Attribute: "router"}, &credstore.FileStore{Path: path, Passphrase: passphrase})
+}
+
+// ResolveCredentials loads the stored credentials for router and lets a
+// password in $ORBI_PASSWORD override the stored one. It reports whether
+// stored credentials were used and fails when neither source has a password.
+func (c *Client) ResolveCredentials(store credstore.Store, router string) (bool, error) {
+	used := false
+	creds, storeErr := store.Get(router)
+	if storeErr == nil {
+		used = true
+		if creds.Username != "" {
+			c.Username = creds.Username
+		}
+		c.Password = creds.Password
+	}
+
+	if password := os.Getenv(PASSWORD_ENV); password != "" {
+		c.Password = password
+	}
+	if c.Password != "" {
+		redact.Register(c.Password)
+		return used, nil
+	}
+	if storeErr != nil && !errors.Is(storeErr, credstore.ErrNoCredentials) {
+		return false, storeErr
+	}
+	return used, fmt.Errorf("%w for %s; run -cmd credentials set or set $%s", credstore.ErrNoCredentials, router, PASSWORD_ENV)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+
+	"gateway-common/credstore"
+	"gateway-common/redact"
+	"netgear-orbi-go/mockrouter"
+)
+
+func TestResolveCredentialsFromEncryptedFile(t *testing.T) {
+	t.Setenv(PASSWORD_ENV, "")
+	_, client := newMockClient(t, mockrouter.Config{Username: "admin", Password: "not-the-default", Devices: testDevices})
+	if _, err := client.GetDevices(); err == nil {
+		t.Fatal("built-in password should be rejected")
+	}
+
+	path := filepath.Join(t.TempDir(), credstore.CREDENTIALS_FILE)
+	passphrase := func(bool) ([]byte, error) { return []byte("pw"), nil }
+	if err := (&credstore.FileStore{Path: path, Passphrase: passphrase}).Set(ORBI_GATEWAY_IP, credstore.Credentials{Username: "admin", Password: "not-the-default"}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "not-the-default") {
+		t.Fatal("credentials file contains the plaintext password")
+	}
+
+	used, err := client.ResolveCredentials(&credstore.FileStore{Path: path, Passphrase: passphrase}, ORBI_GATEWAY_IP)
+	if err != nil || !used {
+		t.Fatalf("ResolveCredentials = %v, %v", used, err)
+	}
+	if _, err := client.GetDevices(); err != nil {
+		t.Fatalf("GetDevices with stored credentials failed: %v", err)
+	}
+}
+
+func TestResolveCredentialsRequiresPassword(t *testing.T) {
+	t.Setenv(PASSWORD_ENV, "")
+	store := &credstore.FileStore{Path: filepath.Join(t.TempDir(), credstore.CREDENTIALS_FILE), Passphrase: func(bool) ([]byte, error) { return []byte("pw"), nil }}
+
+	_, client := newMockClient(t, mockrouter.Config{Devices: testDevices})
+	client.Password = ""
+	if _, err := client.ResolveCredentials(store, ORBI_GATEWAY_IP); !errors.Is(err, credstore.ErrNoCredentials) {
+		t.Fatalf("ResolveCredentials without a password = %v", err)
+	}
+	if _, err := client.GetDevices(); !errors.Is(err, ErrNoPassword) {
+		t.Fatalf("GetDevices without a password = %v", err)
+	}
+
+	t.Setenv(PASSWORD_ENV, TEST_PASSWORD)
+	if used, err := client.ResolveCredentials(store, ORBI_GATEWAY_IP); err != nil || used {
+		t.Fatalf("ResolveCredentials from $%s = %v, %v", PASSWORD_ENV, used, err)
+	}
+	if _, err := client.GetDevices(); err != nil {
+		t.Fatalf("GetDevices with $%s failed: %v", PASSWORD_ENV, err)
+	}
+}
+
+func TestResolvedPasswordIsScrubbedFromLogs(t *testing.T) {
+	t.Setenv(PASSWORD_ENV, "router-password-from-env")
+	store := &credstore.FileStore{Path: filepath.Join(t.TempDir(), credstore.CREDENTIALS_FILE)}
+
+	client := NewClient(log.New(io.Discard))
+	if _, err := client.ResolveCredentials(store, ORBI_GATEWAY_IP); err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	log.New(redact.Writer{W: &logs}).Error("Request Failed", "url", "http://admin:router-password-from-env@"+ORBI_GATEWAY_IP+"/")
+	if strings.Contains(logs.String(), "router-password-from-env") || !strings.Contains(logs.String(), redact.REDACTED) {
+		t.Fatalf("password not scrubbed from log output: %s", logs.String())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 )
@@ -50,6 +51,11 @@ var (
 			Width(10).
 			Align(lipgloss.Left)
 
+	deviceVendorStyle = lipgloss.NewStyle().
+				Foreground(secondaryColor).
+				Width(30).
+				Align(lipgloss.Left)
+
 	activeStatusStyle = lipgloss.NewStyle().
 				Foreground(primaryColor).
 				Bold(true)
@@ -126,7 +132,7 @@ func displayDeviceInfoStyled(info *DeviceInfo) {
 		sortedActive := make([]Device, len(info.ActiveDevices))
 		copy(sortedActive, info.ActiveDevices)
 		sort.Slice(sortedActive, func(i, j int) bool {
-			return strings.ToLower(sortedActive[i].Name) < strings.ToLower(sortedActive[j].Name)
+			return strings.ToLower(sortedActive[i].DisplayName()) < strings.ToLower(sortedActive[j].DisplayName())
 		})
 
 		for _, device := range sortedActive {
@@ -154,7 +160,7 @@ func displayDeviceInfoStyled(info *DeviceInfo) {
 		sortedInactive := make([]Device, len(info.InactiveDevices))
 		copy(sortedInactive, info.InactiveDevices)
 		sort.Slice(sortedInactive, func(i, j int) bool {
-			return strings.ToLower(sortedInactive[i].Name) < strings.ToLower(sortedInactive[j].Name)
+			return strings.ToLower(sortedInactive[i].DisplayName()) < strings.ToLower(sortedInactive[j].DisplayName())
 		})
 
 		for _, device := range sortedInactive {
@@ -168,10 +174,11 @@ func displayDeviceInfoStyled(info *DeviceInfo) {
 }
 
 func displayDeviceStyled(device Device) {
-	name := deviceNameStyle.Render(truncateString(device.Name, 28))
+	name := deviceNameStyle.Render(truncateString(deviceLabel(device), 28))
 	ip := deviceIPStyle.Render(fmt.Sprintf("IP: %s", device.IP))
 	mac := deviceMACStyle.Render(fmt.Sprintf("MAC: %s", device.MAC))
 	connType := deviceTypeStyle.Render(fmt.Sprintf("Type: %s", device.ConnType))
+	vendor := deviceVendorStyle.Render(fmt.Sprintf("Vendor: %s", truncateString(device.VendorLabel(), 20)))
 
 	var status string
 	if device.BackhaulSta == "Good" {
@@ -190,12 +197,26 @@ func displayDeviceStyled(device Device) {
 		ip,
 		mac,
 		connType,
+		vendor,
 		status,
 	)
 
+	if len(device.Tags) > 0 {
+		line += separatorStyle.Render("  Tags: " + strings.Join(device.Tags, ","))
+	}
+
 	fmt.Println(line)
 }
 
+// deviceLabel is the name shown in device listings, with the owner from the
+// registry when one is set.
+func deviceLabel(device Device) string {
+	if device.Owner != "" {
+		return fmt.Sprintf("%s (%s)", device.DisplayName(), device.Owner)
+	}
+	return device.DisplayName()
+}
+
 func displayDeviceInfoPlain(info *DeviceInfo) {
 	fmt.Println("NETGEAR Orbi Router - Connected Devices")
 	fmt.Println()
@@ -210,7 +231,7 @@ func displayDeviceInfoPlain(info *DeviceInfo) {
 		sortedActive := make([]Device, len(info.ActiveDevices))
 		copy(sortedActive, info.ActiveDevices)
 		sort.Slice(sortedActive, func(i, j int) bool {
-			return strings.ToLower(sortedActive[i].Name) < strings.ToLower(sortedActive[j].Name)
+			return strings.ToLower(sortedActive[i].DisplayName()) < strings.ToLower(sortedActive[j].DisplayName())
 		})
 
 		for _, device := range sortedActive {
@@ -234,7 +255,7 @@ func displayDeviceInfoPlain(info *DeviceInfo) {
 		sortedInactive := make([]Device, len(info.InactiveDevices))
 		copy(sortedInactive, info.InactiveDevices)
 		sort.Slice(sortedInactive, func(i, j int) bool {
-			return strings.ToLower(sortedInactive[i].Name) < strings.ToLower(sortedInactive[j].Name)
+			return strings.ToLower(sortedInactive[i].DisplayName()) < strings.ToLower(sortedInactive[j].DisplayName())
 		})
 
 		for _, device := range sortedInactive {
@@ -247,10 +268,11 @@ func displayDeviceInfoPlain(info *DeviceInfo) {
 }
 
 func displayDevicePlain(device Device) {
-	name := truncateString(device.Name, 28)
+	name := truncateString(deviceLabel(device), 28)
 	ip := device.IP
 	mac := device.MAC
 	connType := device.ConnType
+	vendor := truncateString(device.VendorLabel(), 20)
 
 	var status string
 	if device.BackhaulSta == "Good" {
@@ -263,8 +285,13 @@ func displayDevicePlain(device Device) {
 		status = "Connected"
 	}
 
-	fmt.Printf("%-30s IP: %-15s MAC: %-17s Type: %-10s Status: %s\n",
-		name, ip, mac, connType, status)
+	var tags string
+	if len(device.Tags) > 0 {
+		tags = "  Tags: " + strings.Join(device.Tags, ",")
+	}
+
+	fmt.Printf("%-30s IP: %-15s MAC: %-17s Type: %-10s Vendor: %-20s Status: %s%s\n",
+		name, ip, mac, connType, vendor, status, tags)
 }
 
 func DisplayRebootSuccess(usePrettyOutput bool) {
@@ -311,6 +338,82 @@ func displayRebootSuccessPlain() {
 	fmt.Println("2. Running this tool again to list devices")
 }
 
+func DisplayRecovery(result *RecoveryResult, before *DeviceInfo, usePrettyOutput bool) {
+	downtime := result.Downtime().Round(time.Second)
+	reconnected, missing := ReconnectedDevices(before, result.Devices)
+
+	current := 0
+	if result.Devices != nil {
+		current = result.Devices.TotalCount
+	}
+
+	var deviceLine string
+	if before != nil {
+		deviceLine = fmt.Sprintf("Devices reconnected: %d/%d (%d connected now)", len(reconnected), before.TotalCount, current)
+	} else {
+		deviceLine = fmt.Sprintf("Devices connected: %d (no pre-reboot snapshot)", current)
+	}
+
+	if usePrettyOutput {
+		checkmark := successStyle.Render("✓")
+		message := successStyle.Render(fmt.Sprintf("Router is back online after %s", downtime))
+		fmt.Printf("%s %s\n", checkmark, message)
+		fmt.Println(infoStyle.Render(deviceLine))
+
+		if len(missing) > 0 {
+			fmt.Println()
+			fmt.Println(headerStyle.Render("Not Yet Reconnected"))
+			for _, device := range missing {
+				displayDeviceStyled(device)
+			}
+		}
+	} else {
+		fmt.Printf("✓ Router is back online after %s\n", downtime)
+		fmt.Println(deviceLine)
+
+		if len(missing) > 0 {
+			fmt.Println()
+			fmt.Println("Not Yet Reconnected:")
+			for _, device := range missing {
+				displayDevicePlain(device)
+			}
+		}
+	}
+}
+
+func DisplayPresenceEvent(event PresenceEvent, usePrettyOutput bool) {
+	var detail string
+	switch event.Type {
+	case EventJoin:
+		detail = fmt.Sprintf("joined (IP: %s, Type: %s, Vendor: %s)", event.IP, event.ConnType, event.Vendor)
+	case EventLeave:
+		detail = "left"
+	case EventIPChange:
+		detail = fmt.Sprintf("IP changed %s -> %s", event.Previous, event.IP)
+	case EventConnTypeChange:
+		detail = fmt.Sprintf("connection type changed %s -> %s", event.Previous, event.ConnType)
+	}
+
+	timestamp := event.Time.Format("15:04:05")
+	name := truncateString(event.Name, 28)
+
+	if usePrettyOutput {
+		eventStyle := successStyle
+		if event.Type == EventLeave {
+			eventStyle = inactiveStatusStyle
+		} else if event.Type != EventJoin {
+			eventStyle = infoStyle
+		}
+		fmt.Printf("%s %s %s %s\n",
+			separatorStyle.Render(timestamp),
+			deviceNameStyle.Render(name),
+			deviceMACStyle.Render(event.MAC),
+			eventStyle.Render(detail))
+	} else {
+		fmt.Printf("%s %-30s %-17s %s\n", timestamp, name, event.MAC, detail)
+	}
+}
+
 func DisplayError(message string, usePrettyOutput bool) {
 	if usePrettyOutput {
 		errorIcon := errorStyle.Render("✗")
@@ -321,6 +424,15 @@ func DisplayError(message string, usePrettyOutput bool) {
 	}
 }
 
+func DisplayAlert(message string, usePrettyOutput bool) {
+	if usePrettyOutput {
+		alertStyle := lipgloss.NewStyle().Foreground(warningColor).Bold(true)
+		fmt.Printf("%s %s\n", alertStyle.Render("⚠"), alertStyle.Render(message))
+	} else {
+		fmt.Printf("⚠ %s\n", message)
+	}
+}
+
 func DisplaySuccess(message string, usePrettyOutput bool) {
 	if usePrettyOutput {
 		successIcon := successStyle.Render("✓")
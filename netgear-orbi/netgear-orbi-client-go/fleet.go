@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+
+	"gateway-common/fleet"
+)
+
+// FleetResult is the outcome of polling one Orbi router.
+type FleetResult struct {
+	Site     string
+	Router   string
+	Devices  *DeviceInfo
+	Err      error
+	PolledAt time.Time
+}
+
+// PollFleet fetches the device list of every Orbi at the sites, at most
+// concurrency at a time, and returns the results in fleet order. The
+// FastMile gateways are left to fastmile-go.
+func PollFleet(sites []fleet.Site, concurrency int, newClient func(router string) *Client) []FleetResult {
+	var results []FleetResult
+	for _, site := range sites {
+		for _, gw := range site.Gateways {
+			if strings.EqualFold(gw.Type, fleet.TYPE_ORBI) {
+				results = append(results, FleetResult{Site: site.Name, Router: gw.Address})
+			}
+		}
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(result *FleetResult) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			result.Devices, result.Err = newClient(result.Router).GetDevices()
+			result.PolledAt = time.Now()
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// Summary is the result as saved to the fleet status for fastmile-go.
+func (r FleetResult) Summary() fleet.Result {
+	summary := fleet.Result{
+		Address:  r.Router,
+		Type:     fleet.TYPE_ORBI,
+		Up:       r.Err == nil,
+		PolledBy: fleet.Poller(fleet.TYPE_ORBI),
+		PolledAt: r.PolledAt,
+	}
+	if r.Err != nil {
+		summary.Detail = r.Err.Error()
+	} else {
+		summary.Detail = fmt.Sprintf("%d devices, %d active, %d inactive",
+			r.Devices.TotalCount, len(r.Devices.ActiveDevices), len(r.Devices.InactiveDevices))
+	}
+	return summary
+}
+
+func DisplayFleetSummary(results []fleet.Result, now time.Time, usePrettyOutput bool) {
+	if usePrettyOutput {
+		displayFleetSummaryStyled(results, now)
+	} else {
+		displayFleetSummaryPlain(results, now)
+	}
+}
+
+func displayFleetSummaryStyled(results []fleet.Result, now time.Time) {
+	healthStyles := map[string]lipgloss.Style{
+		fleet.HEALTH_HEALTHY:  lipgloss.NewStyle().Foreground(lipgloss.Color("40")).Bold(true),
+		fleet.HEALTH_DEGRADED: lipgloss.NewStyle().Foreground(lipgloss.Color("208")).Bold(true),
+		fleet.HEALTH_DOWN:     lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true),
+		fleet.HEALTH_UNKNOWN:  lipgloss.NewStyle().Foreground(lipgloss.Color("245")),
+	}
+	notPolledStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
+	siteStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("14")).Bold(true)
+	errStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+
+	var rows [][]string
+	order, bySite := fleet.GroupBySite(results)
+	for _, site := range order {
+		health := fleet.SiteHealth(bySite[site])
+		for i, result := range bySite[site] {
+			row := []string{"", "", result.Address, strings.ToUpper(result.Type)}
+			if i == 0 {
+				row[0] = siteStyle.Render(site)
+				row[1] = healthStyles[health].Render(health)
+			}
+			switch {
+			case !result.Polled():
+				row = append(row, notPolledStyle.Render(result.Detail), "")
+			case !result.Up:
+				row = append(row, errStyle.Render(truncateString(result.Detail, 40)), result.Source(now))
+			default:
+				row = append(row, result.Detail, result.Source(now))
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	t := table.New().
+		Border(lipgloss.RoundedBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("6"))).
+		Headers("Site", "Health", "Gateway", "Type", "Status", "Polled").
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if row == table.HeaderRow {
+				return lipgloss.NewStyle().Foreground(lipgloss.Color("12")).Bold(true).Padding(0, 1)
+			}
+			return lipgloss.NewStyle().Padding(0, 1)
+		}).
+		Rows(rows...)
+
+	fmt.Println(lipgloss.NewStyle().Bold(true).Render("📊 Fleet Summary"))
+	fmt.Println(t.Render())
+}
+
+func displayFleetSummaryPlain(results []fleet.Result, now time.Time) {
+	fmt.Println("Fleet Summary")
+	fmt.Println(strings.Repeat("=", 80))
+
+	order, bySite := fleet.GroupBySite(results)
+	for _, site := range order {
+		up, _ := fleet.CountUp(bySite[site])
+		fmt.Printf("\nSite: %s  Health: %s  Successful: %d/%d\n", site, fleet.SiteHealth(bySite[site]), up, len(bySite[site]))
+		fmt.Println(strings.Repeat("-", 80))
+		for _, result := range bySite[site] {
+			switch {
+			case !result.Polled():
+				fmt.Printf("%-22s %-4s %s\n", result.Address, strings.ToUpper(result.Type), result.Detail)
+			case !result.Up:
+				fmt.Printf("%-22s %-4s Error: %s (%s)\n", result.Address, strings.ToUpper(result.Type), result.Detail, result.Source(now))
+			default:
+				fmt.Printf("%-22s %-4s %s (%s)\n", result.Address, strings.ToUpper(result.Type), result.Detail, result.Source(now))
+			}
+		}
+	}
+	fmt.Println()
+	fmt.Println(strings.Repeat("=", 80))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"gateway-common/fleet"
+	"netgear-orbi-go/mockrouter"
+)
+
+func TestPollFleetGroupsHealthBySite(t *testing.T) {
+	_, home := mockrouter.NewServer(mockrouter.Config{Username: ORBI_USERNAME, Password: TEST_PASSWORD, Devices: testDevices})
+	t.Cleanup(home.Close)
+	_, gone := mockrouter.NewServer(mockrouter.Config{Username: ORBI_USERNAME, Password: TEST_PASSWORD})
+	gone.Close()
+
+	homeRouter := strings.TrimPrefix(home.URL, "http://")
+	goneRouter := strings.TrimPrefix(gone.URL, "http://")
+	path := filepath.Join(t.TempDir(), fleet.FILE)
+	fleetFile := `{"sites": [
+		{"name": "home", "tags": ["residential"], "gateways": [{"address": "192.168.0.1", "type": "odu"}, {"address": "` + homeRouter + `", "type": "orbi"}]},
+		{"name": "office", "tags": ["office"], "gateways": [{"address": "` + homeRouter + `", "type": "orbi"}, {"address": "` + goneRouter + `", "type": "orbi"}]},
+		{"name": "cabin", "tags": ["residential"], "gateways": [{"address": "` + goneRouter + `", "type": "orbi"}]}
+	]}`
+	if err := os.WriteFile(path, []byte(fleetFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := fleet.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newClient := func(router string) *Client {
+		client := NewClient(log.New(io.Discard))
+		client.BaseURL = "http://" + router
+		client.Password = TEST_PASSWORD
+		client.HTTPClient.Timeout = 2 * time.Second
+		return client
+	}
+
+	results := PollFleet(loaded.Select("", ""), 2, newClient)
+	if len(results) != 4 || results[0].Router != homeRouter || results[0].Devices == nil || results[0].Devices.TotalCount != 3 {
+		t.Fatalf("expected only the Orbis to be polled, got %+v", results)
+	}
+
+	// fastmile-go saved the home ODU two minutes ago
+	now := time.Now()
+	odu := fleet.Result{Address: "192.168.0.1", Type: "odu", Up: true, Detail: "FastMile 5G Receiver, up 3d", PolledBy: "fastmile-go", PolledAt: now.Add(-2 * time.Minute)}
+	if err := fleet.SaveStatus(fleet.StatusPath(path), []fleet.Result{odu}); err != nil {
+		t.Fatal(err)
+	}
+
+	var polled []fleet.Result
+	for _, result := range results {
+		polled = append(polled, result.Summary())
+	}
+	merged, err := fleet.Record(fleet.StatusPath(path), loaded.Select("", ""), polled, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order, bySite := fleet.GroupBySite(merged)
+	if strings.Join(order, ",") != "home,office,cabin" {
+		t.Fatalf("sites out of fleet order: %v", order)
+	}
+	if bySite["home"][0].Detail != odu.Detail {
+		t.Fatalf("ODU result not merged into home: %+v", bySite["home"])
+	}
+	for site, want := range map[string]string{"home": fleet.HEALTH_HEALTHY, "office": fleet.HEALTH_DEGRADED, "cabin": fleet.HEALTH_DOWN} {
+		if got := fleet.SiteHealth(bySite[site]); got != want {
+			t.Errorf("%s health = %s, want %s", site, got, want)
+		}
+	}
+
+	// The Orbi results are saved for fastmile-go
+	saved, err := fleet.LoadStatus(fleet.StatusPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 3 {
+		t.Fatalf("expected the ODU and both Orbis in the fleet status, got %+v", saved)
+	}
+}
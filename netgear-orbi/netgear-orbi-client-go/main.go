@@ -2,25 +2,84 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/x/term"
+
+	"gateway-common/credstore"
+	"gateway-common/fleet"
+	"gateway-common/logtarget"
+	"gateway-common/redact"
+	"gateway-common/transport"
 )
 
 var version = "1.0.0"
 
 func main() {
 	var (
-		command     = flag.String("cmd", "list", "Command to execute: list, reboot")
-		pretty      = flag.Bool("pretty", false, "Enable pretty output with styling")
-		verbose     = flag.Bool("verbose", false, "Enable verbose logging")
-		force       = flag.Bool("force", false, "Skip confirmation prompts")
-		showVersion = flag.Bool("version", false, "Show version information")
-		help        = flag.Bool("help", false, "Show help information")
+		command      = flag.String("cmd", "list", "Command to execute: list, reboot, schedule-reboot, presence, api, mqtt, metrics, fleet, check, credentials set|get|delete")
+		router       = flag.String("router", ORBI_GATEWAY_IP, "Router IP or host:port to act on, and whose stored credentials credentials set|get|delete manage")
+		pretty       = flag.Bool("pretty", false, "Enable pretty output with styling")
+		verbose      = flag.Bool("verbose", false, "Enable verbose logging")
+		logTarget    = flag.String("log-target", logtarget.LOG_TARGET_STDERR, "Where logs go: stderr, syslog, journald, file")
+		logFormat    = flag.String("log-format", logtarget.LOG_FORMAT_TEXT, "Log format for stderr and file, and of syslog messages: text, json, logfmt")
+		logFile      = flag.String("log-file", "", "Log file for -log-target file")
+		force        = flag.Bool("force", false, "Skip confirmation prompts")
+		wait         = flag.Bool("wait", false, "Wait for the router to come back after a reboot")
+		waitTimeout  = flag.Duration("wait-timeout", 5*time.Minute, "Maximum time to wait for the router to recover")
+		schedule     = flag.String("schedule", "", "Cron expression for scheduled reboots, e.g. \"0 4 * * *\"")
+		maxActive    = flag.Int("max-active", -1, "Skip scheduled reboots when more devices than this are active (-1 disables)")
+		skipIfMAC    = flag.String("skip-if-present", "", "Comma-separated MACs that block a scheduled reboot while connected")
+		dryRun       = flag.Bool("dry-run", false, "Log scheduled reboot decisions without rebooting")
+		interval     = flag.Duration("interval", 30*time.Second, "Polling interval for presence tracking, mqtt and metrics")
+		ndjsonPath   = flag.String("ndjson", "", "Append presence events as NDJSON to this file (\"-\" for stdout)")
+		webhookURL   = flag.String("webhook", "", "POST each presence event as JSON to this URL")
+		registry     = flag.String("registry", DefaultRegistryPath(), "Known-device registry file mapping MACs to friendly names")
+		unknownOnly  = flag.Bool("unknown-only", false, "Only list devices that are not in the registry")
+		vendor       = flag.String("vendor", "", "Only list devices whose manufacturer contains this text")
+		useHTTPS     = flag.Bool("https", false, "Connect to the router over HTTPS")
+		tlsMode      = flag.String("tls", transport.TLS_TOFU, "Certificate verification with -https: tofu (pin on first use), ca, verify")
+		caFile       = flag.String("ca-file", "", "PEM bundle of CAs trusted with -tls ca")
+		known        = flag.String("known-gateways", transport.DefaultKnownGatewaysPath(CONFIG_DIR), "File of pinned router certificate fingerprints for -tls tofu")
+		credStore    = flag.String("credential-store", credstore.STORE_AUTO, "Where credentials are kept: auto (keyring if available), keyring, file")
+		credFile     = flag.String("credentials-file", credstore.DefaultPath(CONFIG_DIR), "Encrypted credentials file used when the keyring is unavailable")
+		retries      = flag.Int("retries", transport.RETRY_ATTEMPTS, "Attempts per request for transient failures (1 disables retries)")
+		retryBackoff = flag.Duration("retry-backoff", transport.RETRY_BASE_DELAY, "Delay before the first retry, doubled on each further retry")
+		retryMax     = flag.Duration("retry-max-backoff", transport.RETRY_MAX_DELAY, "Upper bound for the retry delay")
+		retryJitter  = flag.Float64("retry-jitter", transport.RETRY_JITTER, "Fraction of each retry delay that is randomized (0-1)")
+		retryStatus  = flag.String("retry-statuses", "429,502,503,504", "Comma-separated HTTP statuses that are retried")
+		timeoutSpec  = flag.String("timeouts", transport.DefaultTimeouts().String(), "Per-phase deadlines: connect, tls, header (response headers) and overall")
+		listen       = flag.String("listen", API_LISTEN, "Address the api command listens on")
+		tokenFile    = flag.String("api-token-file", "", "File holding the api bearer token (default: $"+API_TOKEN_ENV+")")
+		mqttBroker   = flag.String("mqtt-broker", MQTT_BROKER, "MQTT broker URL for the mqtt command, e.g. tcp://host:1883 or ssl://host:8883")
+		mqttUser     = flag.String("mqtt-username", "", "MQTT username (password from $"+MQTT_PASSWORD_ENV+")")
+		mqttClientID = flag.String("mqtt-client-id", MQTT_CLIENT_ID, "MQTT client ID")
+		mqttPrefix   = flag.String("mqtt-topic-prefix", MQTT_TOPIC_PREFIX, "Prefix of the state and command topics")
+		mqttDiscover = flag.String("mqtt-discovery-prefix", MQTT_DISCOVERY_PREFIX, "Home Assistant discovery prefix (empty disables discovery)")
+		metricsSink  = flag.String("metrics-sink", SINK_INFLUX, "Comma-separated sinks for the metrics command: influx, otlp")
+		metricsOnce  = flag.Bool("metrics-once", false, "Export metrics once and exit instead of every -interval")
+		influxURL    = flag.String("influx-url", "", "InfluxDB write URL (default: line protocol on stdout; token from $"+INFLUX_TOKEN_ENV+")")
+		otlpEndpoint = flag.String("otlp-endpoint", os.Getenv(OTLP_ENDPOINT_ENV), "OTLP/HTTP metrics endpoint (headers from $"+OTLP_HEADERS_ENV+")")
+		fleetFile    = flag.String("fleet", fleet.DefaultPath(), "Fleet file of named sites and their gateways, shared with fastmile-go")
+		site         = flag.String("site", "", "Only poll these comma-separated fleet sites (default: all)")
+		tag          = flag.String("tag", "", "Only poll fleet sites carrying all of these comma-separated tags")
+		parallel     = flag.Int("concurrency", fleet.CONCURRENCY, "Routers the fleet command polls at once")
+		warnActive   = flag.Int("warning-active", 0, "check: minimum active devices below which the result is WARNING (0 disables)")
+		critActive   = flag.Int("critical-active", 0, "check: minimum active devices below which the result is CRITICAL (0 disables)")
+		showVersion  = flag.Bool("version", false, "Show version information")
+		help         = flag.Bool("help", false, "Show help information")
 	)
 	flag.Parse()
 
@@ -37,7 +96,7 @@ func main() {
 	isInTerminal := !ShouldUsePlainOutput()
 	usePrettyOutput := *pretty && isInTerminal
 
-	logger := log.New(os.Stderr)
+	logger := log.New(redact.Writer{W: os.Stderr})
 	if *verbose {
 		logger.SetLevel(log.DebugLevel)
 	} else if usePrettyOutput {
@@ -68,22 +127,144 @@ func main() {
 		logger.SetStyles(styles)
 	}
 
-	client := NewClient(logger)
+	logOutput, err := logtarget.Configure(logger, *logTarget, *logFormat, *logFile, LOG_IDENTIFIER)
+	if err != nil {
+		DisplayError(fmt.Sprintf("Invalid log target: %v", err), usePrettyOutput)
+		os.Exit(1)
+	}
+	defer logOutput.Close()
+
+	tlsPolicy, err := transport.NewTLSPolicy(*tlsMode, *caFile, *known)
+	if err != nil {
+		DisplayError(fmt.Sprintf("Invalid TLS configuration: %v", err), usePrettyOutput)
+		os.Exit(1)
+	}
+	if tlsPolicy.Known != nil {
+		tlsPolicy.Known.OnTrust = func(host, fingerprint string) {
+			logger.Warn("Pinned New Router Certificate", "host", host, "fingerprint", fingerprint, "file", tlsPolicy.Known.Path)
+		}
+	}
+
+	store, err := OpenCredentialStore(*credStore, *credFile, promptPassphrase)
+	if err != nil {
+		DisplayError(fmt.Sprintf("Invalid credential store: %v", err), usePrettyOutput)
+		os.Exit(1)
+	}
+
+	timeouts, err := transport.ParseTimeouts(*timeoutSpec, transport.DefaultTimeouts())
+	if err != nil {
+		DisplayError(fmt.Sprintf("Invalid timeouts: %v", err), usePrettyOutput)
+		os.Exit(1)
+	}
+
+	retryStatuses, err := transport.ParseStatusList(*retryStatus)
+	if err != nil {
+		DisplayError(fmt.Sprintf("Invalid retry configuration: %v", err), usePrettyOutput)
+		os.Exit(1)
+	}
 
-	switch strings.ToLower(*command) {
+	newClient := func(router string) *Client {
+		client := NewClient(logger)
+		// A router without a password fails every request with
+		// ErrNoPassword, so a fleet reports it per router
+		if used, err := client.ResolveCredentials(store, router); err != nil && !errors.Is(err, credstore.ErrNoCredentials) {
+			logger.Error("Stored Credentials Unavailable", "router", router, "error", err)
+		} else if used {
+			logger.Debug("Using Stored Credentials", "router", router, "store", store.Name())
+		}
+		client.BaseURL = fmt.Sprintf("http://%s", router)
+		if *useHTTPS {
+			client.BaseURL = fmt.Sprintf("https://%s", router)
+		}
+		client.SetTLSPolicy(tlsPolicy)
+
+		client.SetTimeouts(timeouts)
+		if *verbose {
+			client.WrapTransport(transport.TimingTransport{Logger: logger}.Wrap)
+		}
+
+		client.WrapTransport(transport.RetryPolicy{
+			Attempts:          *retries,
+			BaseDelay:         *retryBackoff,
+			MaxDelay:          *retryMax,
+			Jitter:            *retryJitter,
+			RetryableStatuses: retryStatuses,
+			OnRetry: func(req *http.Request, attempt int, delay time.Duration, reason string) {
+				logger.Warn("Retrying Request", "host", req.URL.Host, "path", req.URL.Path, "attempt", attempt, "delay", delay.Round(time.Millisecond), "reason", reason)
+			},
+		}.Wrap)
+		return client
+	}
+	cmd := strings.ToLower(*command)
+	client := newClient(*router)
+	// check reports a missing password itself, as UNKNOWN for the monitoring system
+	if client.Password == "" && cmd != "credentials" && cmd != "fleet" && cmd != "check" {
+		DisplayError(fmt.Sprintf("No password for %s: run -cmd credentials set or set $%s", *router, PASSWORD_ENV), usePrettyOutput)
+		os.Exit(1)
+	}
+
+	switch cmd {
 	case "list", "devices":
-		handleListCommand(client, usePrettyOutput)
+		handleListCommand(client, ListOptions{
+			RegistryPath: *registry,
+			UnknownOnly:  *unknownOnly,
+			Vendor:       *vendor,
+		}, usePrettyOutput)
 	case "reboot", "restart":
-		handleRebootCommand(client, *force, usePrettyOutput)
+		handleRebootCommand(client, *force, *wait, *waitTimeout, usePrettyOutput)
+	case "schedule-reboot":
+		guard := RebootGuard{
+			MaxActiveDevices: *maxActive,
+			BlockingMACs:     ParseMACList(*skipIfMAC),
+		}
+		handleScheduleRebootCommand(client, *schedule, guard, *dryRun, usePrettyOutput)
+	case "presence":
+		handlePresenceCommand(client, *interval, *ndjsonPath, *webhookURL, usePrettyOutput)
+	case "api":
+		handleAPICommand(client, *registry, *listen, *tokenFile, usePrettyOutput)
+	case "mqtt":
+		cfg := DefaultMQTTConfig()
+		redact.Register(cfg.Password)
+		cfg.Broker = *mqttBroker
+		cfg.Username = *mqttUser
+		cfg.ClientID = *mqttClientID
+		cfg.TopicPrefix = *mqttPrefix
+		cfg.DiscoveryPrefix = *mqttDiscover
+		cfg.Interval = *interval
+		handleMQTTCommand(client, cfg, *registry, usePrettyOutput)
+	case "metrics":
+		metricsInterval := *interval
+		if *metricsOnce {
+			metricsInterval = 0
+		}
+		handleMetricsCommand(client, *registry, *metricsSink, *influxURL, *otlpEndpoint, metricsInterval, usePrettyOutput)
+	case "fleet":
+		handleFleetCommand(*fleetFile, *site, *tag, *parallel, newClient, usePrettyOutput)
+	case "check":
+		handleCheckCommand(client, CheckThresholds{WarningActive: *warnActive, CriticalActive: *critActive})
+	case "credentials":
+		handleCredentialsCommand(flag.Arg(0), *router, store, usePrettyOutput)
 	default:
 		DisplayError(fmt.Sprintf("Unknown command: %s", *command), usePrettyOutput)
-		fmt.Fprintf(os.Stderr, "\nAvailable commands: list, reboot\n")
+		fmt.Fprintf(os.Stderr, "\nAvailable commands: list, reboot, schedule-reboot, presence, api, mqtt, metrics, fleet, check, credentials\n")
 		fmt.Fprintf(os.Stderr, "Use -help for more information.\n")
 		os.Exit(1)
 	}
 }
 
-func handleListCommand(client *Client, usePrettyOutput bool) {
+type ListOptions struct {
+	RegistryPath string
+	UnknownOnly  bool
+	Vendor       string
+}
+
+func handleListCommand(client *Client, opts ListOptions, usePrettyOutput bool) {
+	registry, err := LoadRegistry(opts.RegistryPath)
+	if err != nil {
+		DisplayError(err.Error(), usePrettyOutput)
+		os.Exit(1)
+	}
+
 	if !usePrettyOutput {
 		fmt.Fprintf(os.Stderr, "Fetching device information from router...\n")
 	}
@@ -94,6 +275,29 @@ func handleListCommand(client *Client, usePrettyOutput bool) {
 		os.Exit(1)
 	}
 
+	registry.Annotate(devices)
+	alertNewDevices(client, devices, filepath.Join(filepath.Dir(opts.RegistryPath), SEEN_FILE), usePrettyOutput)
+
+	if opts.UnknownOnly {
+		devices = FilterDevices(devices, func(device Device) bool {
+			return !device.Known
+		})
+		if devices.TotalCount == 0 {
+			DisplaySuccess("All connected devices are in the registry", usePrettyOutput)
+			return
+		}
+	}
+
+	if opts.Vendor != "" {
+		devices = FilterDevices(devices, func(device Device) bool {
+			return strings.Contains(strings.ToLower(device.VendorLabel()), strings.ToLower(opts.Vendor))
+		})
+		if devices.TotalCount == 0 {
+			DisplayInfo(fmt.Sprintf("No devices from vendor matching %q", opts.Vendor), usePrettyOutput)
+			return
+		}
+	}
+
 	if devices == nil || devices.TotalCount == 0 {
 		DisplayInfo("No devices found or unable to connect to router", usePrettyOutput)
 		return
@@ -102,7 +306,24 @@ func handleListCommand(client *Client, usePrettyOutput bool) {
 	DisplayDeviceInfo(devices, usePrettyOutput)
 }
 
-func handleRebootCommand(client *Client, force bool, usePrettyOutput bool) {
+func alertNewDevices(client *Client, devices *DeviceInfo, seenPath string, usePrettyOutput bool) {
+	seen, err := LoadSeenDevices(seenPath)
+	if err != nil {
+		client.Logger.Warn("Could not load seen devices", "error", err)
+		return
+	}
+
+	for _, device := range seen.Record(devices, time.Now()) {
+		DisplayAlert(fmt.Sprintf("New device never seen before: %s (IP: %s, MAC: %s)",
+			device.DisplayName(), device.IP, device.MAC), usePrettyOutput)
+	}
+
+	if err := seen.Save(); err != nil {
+		client.Logger.Warn("Could not save seen devices", "error", err)
+	}
+}
+
+func handleRebootCommand(client *Client, force, wait bool, waitTimeout time.Duration, usePrettyOutput bool) {
 	if !force {
 		if !confirmReboot(usePrettyOutput) {
 			DisplayInfo("Reboot cancelled.", usePrettyOutput)
@@ -112,12 +333,251 @@ func handleRebootCommand(client *Client, force bool, usePrettyOutput bool) {
 		DisplayInfo("Force mode: Skipping confirmation prompt", usePrettyOutput)
 	}
 
+	// Snapshot the connected devices so we can compare after recovery
+	var before *DeviceInfo
+	if wait {
+		snapshot, err := client.GetDevices()
+		if err != nil {
+			client.Logger.Warn("Could not snapshot devices before reboot", "error", err)
+		}
+		before = snapshot
+	}
+
+	rebootAt := time.Now()
 	if err := client.RebootRouter(); err != nil {
 		DisplayError(fmt.Sprintf("Failed to reboot router: %s", err), usePrettyOutput)
 		os.Exit(1)
 	}
 
-	DisplayRebootSuccess(usePrettyOutput)
+	if !wait {
+		DisplayRebootSuccess(usePrettyOutput)
+		return
+	}
+
+	DisplaySuccess("Reboot command sent successfully!", usePrettyOutput)
+	DisplayInfo(fmt.Sprintf("Waiting up to %s for the router to come back...", waitTimeout), usePrettyOutput)
+
+	result, err := client.WaitForRecovery(rebootAt, waitTimeout)
+	if err != nil {
+		DisplayError(fmt.Sprintf("Router did not recover: %s", err), usePrettyOutput)
+		os.Exit(1)
+	}
+
+	DisplayRecovery(result, before, usePrettyOutput)
+}
+
+func handleScheduleRebootCommand(client *Client, schedule string, guard RebootGuard, dryRun bool, usePrettyOutput bool) {
+	if schedule == "" {
+		DisplayError("schedule-reboot requires -schedule with a cron expression", usePrettyOutput)
+		os.Exit(1)
+	}
+
+	if err := client.RunRebootSchedule(schedule, guard, dryRun); err != nil {
+		DisplayError(fmt.Sprintf("Scheduled reboots stopped: %s", err), usePrettyOutput)
+		os.Exit(1)
+	}
+}
+
+func handlePresenceCommand(client *Client, interval time.Duration, ndjsonPath, webhookURL string, usePrettyOutput bool) {
+	sinks := &PresenceSinks{
+		WebhookURL: webhookURL,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if ndjsonPath != "" {
+		out, err := OpenNDJSON(ndjsonPath)
+		if err != nil {
+			DisplayError(fmt.Sprintf("Failed to open NDJSON output: %s", err), usePrettyOutput)
+			os.Exit(1)
+		}
+		defer out.Close()
+		sinks.NDJSON = out
+	}
+
+	// NDJSON on stdout replaces the human-readable event lines
+	onEvent := func(event PresenceEvent) {
+		if ndjsonPath != "-" {
+			DisplayPresenceEvent(event, usePrettyOutput)
+		}
+	}
+
+	client.Logger.Info("Tracking Device Presence", "interval", interval)
+	client.TrackPresence(interval, sinks, onEvent)
+}
+
+func handleAPICommand(client *Client, registryPath, listen, tokenFile string, usePrettyOutput bool) {
+	token, err := LoadAPIToken(tokenFile)
+	if err != nil {
+		DisplayError(err.Error(), usePrettyOutput)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	api := &APIServer{Client: client, RegistryPath: registryPath, Token: token}
+	if err := api.ListenAndServe(ctx, listen); err != nil {
+		DisplayError(fmt.Sprintf("API stopped: %s", err), usePrettyOutput)
+		os.Exit(1)
+	}
+}
+
+func handleMQTTCommand(client *Client, cfg MQTTConfig, registryPath string, usePrettyOutput bool) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := NewMQTTPublisher(cfg, client, registryPath).Run(ctx); err != nil {
+		DisplayError(fmt.Sprintf("MQTT publisher stopped: %s", err), usePrettyOutput)
+		os.Exit(1)
+	}
+}
+
+func handleMetricsCommand(client *Client, registryPath, sinkSpec, influxURL, otlpEndpoint string, interval time.Duration, usePrettyOutput bool) {
+	sinks, err := NewMetricSinks(sinkSpec, influxURL, otlpEndpoint)
+	if err != nil {
+		DisplayError(err.Error(), usePrettyOutput)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	exporter := &MetricsExporter{Sinks: sinks, Client: client, RegistryPath: registryPath, Interval: interval}
+	if err := exporter.Run(ctx); err != nil {
+		DisplayError(fmt.Sprintf("Metrics export failed: %s", err), usePrettyOutput)
+		os.Exit(1)
+	}
+}
+
+// handleFleetCommand polls the Orbis of the sites and reports each site's
+// health together with the FastMile results fastmile-go saved beside the
+// fleet file.
+func handleFleetCommand(fleetPath, sites, tags string, concurrency int, newClient func(string) *Client, usePrettyOutput bool) {
+	fleetConfig, err := fleet.Load(fleetPath)
+	if err != nil {
+		DisplayError(err.Error(), usePrettyOutput)
+		os.Exit(1)
+	}
+
+	selected := fleetConfig.Select(sites, tags)
+	if len(selected) == 0 {
+		DisplayError("No sites selected, check -fleet, -site and -tag", usePrettyOutput)
+		os.Exit(1)
+	}
+
+	var polled []fleet.Result
+	for _, result := range PollFleet(selected, concurrency, newClient) {
+		polled = append(polled, result.Summary())
+	}
+
+	now := time.Now()
+	merged, err := fleet.Record(fleet.StatusPath(fleetPath), selected, polled, now)
+	if err != nil {
+		DisplayAlert(fmt.Sprintf("Fleet status unavailable, FastMile gateways are shown without results: %s", err), usePrettyOutput)
+	}
+	DisplayFleetSummary(merged, now, usePrettyOutput)
+}
+
+// handleCheckCommand prints one Nagios plugin line and exits with its state.
+func handleCheckCommand(client *Client, thresholds CheckThresholds) {
+	if err := thresholds.Validate(); err != nil {
+		fmt.Printf("ORBI %s - %s\n", checkStateNames[CHECK_UNKNOWN], err)
+		os.Exit(CHECK_UNKNOWN)
+	}
+
+	result := RunCheck(client, thresholds)
+	fmt.Println(result)
+	os.Exit(result.State)
+}
+
+func handleCredentialsCommand(action, router string, store credstore.Store, usePrettyOutput bool) {
+	switch strings.ToLower(action) {
+	case "set":
+		creds := credstore.Credentials{
+			Username: promptLine(fmt.Sprintf("Username [%s]: ", ORBI_USERNAME), ORBI_USERNAME),
+		}
+		password, err := promptSecret("Password: ")
+		if err != nil || len(password) == 0 {
+			DisplayError("A password is required", usePrettyOutput)
+			os.Exit(1)
+		}
+		creds.Password = string(password)
+
+		if err := store.Set(router, creds); err != nil {
+			DisplayError(fmt.Sprintf("Failed to store credentials: %v", err), usePrettyOutput)
+			os.Exit(1)
+		}
+		DisplaySuccess(fmt.Sprintf("Stored credentials for %s in %s", router, store.Name()), usePrettyOutput)
+	case "get":
+		creds, err := store.Get(router)
+		if err != nil {
+			DisplayError(fmt.Sprintf("%s: %v", router, err), usePrettyOutput)
+			os.Exit(1)
+		}
+		fmt.Printf("Router:   %s\n", router)
+		fmt.Printf("Store:    %s\n", store.Name())
+		fmt.Printf("Username: %s\n", creds.Username)
+		fmt.Printf("Password: %s\n", strings.Repeat("*", 8))
+	case "delete":
+		if err := store.Delete(router); err != nil {
+			DisplayError(fmt.Sprintf("%s: %v", router, err), usePrettyOutput)
+			os.Exit(1)
+		}
+		DisplaySuccess(fmt.Sprintf("Deleted credentials for %s from %s", router, store.Name()), usePrettyOutput)
+	default:
+		DisplayError(fmt.Sprintf("Unknown credentials action %q (expected set, get or delete)", action), usePrettyOutput)
+		os.Exit(1)
+	}
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+func promptLine(prompt, fallback string) string {
+	fmt.Fprint(os.Stderr, prompt)
+	line, _ := stdinReader.ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return fallback
+}
+
+// promptSecret reads without echo on a terminal and a plain line otherwise,
+// so secrets can be piped in.
+func promptSecret(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		line, err := stdinReader.ReadString('\n')
+		if err != nil && line == "" {
+			return nil, fmt.Errorf("failed to read %s: %w", strings.TrimSuffix(prompt, ": "), err)
+		}
+		return []byte(strings.TrimRight(line, "\r\n")), nil
+	}
+
+	secret, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	return secret, err
+}
+
+func promptPassphrase(confirm bool) ([]byte, error) {
+	if passphrase := os.Getenv(PASSPHRASE_ENV); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return nil, fmt.Errorf("credentials file is encrypted; set %s or run interactively", PASSPHRASE_ENV)
+	}
+
+	passphrase, err := promptSecret("Credentials passphrase: ")
+	if err != nil || !confirm {
+		return passphrase, err
+	}
+	again, err := promptSecret("Repeat passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if string(again) != string(passphrase) {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
 }
 
 func confirmReboot(usePrettyOutput bool) bool {
@@ -146,16 +606,73 @@ func showHelp() {
 	fmt.Println("  netgear-orbi-go [OPTIONS]")
 	fmt.Println()
 	fmt.Println("OPTIONS:")
-	fmt.Println("  -cmd string       Command to execute: list, reboot (default \"list\")")
+	fmt.Println("  -cmd string       Command to execute: list, reboot, schedule-reboot, presence, api, mqtt, metrics,")
+	fmt.Println("                    fleet, check, credentials set|get|delete (default \"list\")")
+	fmt.Println("  -router string    Router IP or host:port, also for credentials set|get|delete (default \"192.168.10.254\")")
 	fmt.Println("  -pretty           Enable pretty output with styling")
 	fmt.Println("  -verbose          Enable verbose logging")
+	fmt.Println("  -log-target       Where logs go: stderr, syslog, journald, file (default \"stderr\")")
+	fmt.Println("  -log-format       Log format: text, json, logfmt (default \"text\")")
+	fmt.Println("  -log-file         Log file for -log-target file")
 	fmt.Println("  -force            Skip confirmation prompts")
+	fmt.Println("  -wait             Wait for the router to come back after a reboot")
+	fmt.Println("  -wait-timeout     Maximum time to wait for recovery (default 5m0s)")
+	fmt.Println("  -schedule string  Cron expression for schedule-reboot, e.g. \"0 4 * * *\"")
+	fmt.Println("  -max-active int   Skip scheduled reboots above this many active devices (default -1, disabled)")
+	fmt.Println("  -skip-if-present  Comma-separated MACs that block a scheduled reboot")
+	fmt.Println("  -dry-run          Log scheduled reboot decisions without rebooting")
+	fmt.Println("  -interval         Polling interval for presence tracking, mqtt and metrics (default 30s)")
+	fmt.Println("  -ndjson string    Append presence events as NDJSON to a file (\"-\" for stdout)")
+	fmt.Println("  -webhook string   POST each presence event as JSON to this URL")
+	fmt.Println("  -registry string  Known-device registry file (default: <config dir>/netgear-orbi/devices.json)")
+	fmt.Println("  -unknown-only     Only list devices that are not in the registry")
+	fmt.Println("  -vendor string    Only list devices whose manufacturer contains this text")
+	fmt.Println("  -https            Connect to the router over HTTPS")
+	fmt.Println("  -tls string       Certificate verification: tofu, ca, verify (default \"tofu\")")
+	fmt.Println("  -ca-file string   PEM bundle of CAs trusted with -tls ca")
+	fmt.Println("  -known-gateways   Pinned certificate fingerprints (default: <config dir>/netgear-orbi/known_gateways)")
+	fmt.Println("  -retries int      Attempts per request for transient failures (default 3, 1 disables)")
+	fmt.Println("  -retry-backoff    Delay before the first retry, doubled each time (default 500ms)")
+	fmt.Println("  -retry-max-backoff Upper bound for the retry delay (default 5s)")
+	fmt.Println("  -retry-jitter     Fraction of each retry delay that is randomized (default 0.2)")
+	fmt.Println("  -retry-statuses   HTTP statuses that are retried (default \"429,502,503,504\")")
+	fmt.Println("  -timeouts string  Per-phase deadlines (default \"connect=10s,tls=10s,header=20s,overall=30s\")")
+	fmt.Println("  -credential-store Where credentials are kept: auto, keyring, file (default \"auto\")")
+	fmt.Println("  -credentials-file Encrypted credentials file (default: <config dir>/netgear-orbi/credentials.enc)")
+	fmt.Println("  $ORBI_PASSWORD    Router password, overriding the stored one; one of the two is required")
+	fmt.Println("  -listen string    Address the api command listens on, plain HTTP (default \"127.0.0.1:8081\")")
+	fmt.Println("  -api-token-file   File holding the api bearer token (default: $ORBI_API_TOKEN)")
+	fmt.Println("  -mqtt-broker      MQTT broker URL (default \"tcp://127.0.0.1:1883\")")
+	fmt.Println("  -mqtt-username    MQTT username (password from $ORBI_MQTT_PASSWORD)")
+	fmt.Println("  -mqtt-client-id   MQTT client ID (default \"netgear-orbi-go\")")
+	fmt.Println("  -mqtt-topic-prefix Prefix of the state and command topics (default \"orbi\")")
+	fmt.Println("  -mqtt-discovery-prefix Home Assistant discovery prefix, empty disables (default \"homeassistant\")")
+	fmt.Println("  -metrics-sink     Comma-separated metrics sinks: influx, otlp (default \"influx\")")
+	fmt.Println("  -metrics-once     Export metrics once and exit")
+	fmt.Println("  -influx-url       InfluxDB write URL, line protocol on stdout if empty (token from $ORBI_INFLUX_TOKEN)")
+	fmt.Println("  -otlp-endpoint    OTLP/HTTP metrics endpoint (default $OTEL_EXPORTER_OTLP_METRICS_ENDPOINT)")
+	fmt.Println("  -fleet            Fleet file of named sites and their gateways, shared with fastmile-go")
+	fmt.Println("  -site             Only poll these comma-separated fleet sites")
+	fmt.Println("  -tag              Only poll fleet sites carrying all of these comma-separated tags")
+	fmt.Println("  -concurrency      Routers the fleet command polls at once (default 8)")
+	fmt.Println("  -warning-active   check: WARNING below this many active devices (0 disables)")
+	fmt.Println("  -critical-active  check: CRITICAL below this many active devices (0 disables)")
 	fmt.Println("  -version          Show version information")
 	fmt.Println("  -help             Show this help message")
 	fmt.Println()
 	fmt.Println("COMMANDS:")
 	fmt.Println("  list, devices     List all connected devices (default)")
 	fmt.Println("  reboot, restart   Reboot the router")
+	fmt.Println("  schedule-reboot   Reboot on a cron schedule, subject to guard conditions")
+	fmt.Println("  presence          Report devices joining, leaving or changing IP/connection type")
+	fmt.Println("  api               Serve GET /orbi/devices and POST /orbi/reboot over HTTP with bearer auth;")
+	fmt.Println("                    separate from fastmile-go's api, and keep it on loopback or behind a TLS proxy")
+	fmt.Println("  mqtt              Publish device presence to MQTT with Home Assistant discovery")
+	fmt.Println("  metrics           Export device counts as InfluxDB line protocol or OTLP metrics")
+	fmt.Println("  fleet             Poll every Orbi in the fleet file and summarize health by site,")
+	fmt.Println("                    including the FastMile results fastmile-go saved in the last 15 minutes")
+	fmt.Println("  check             Nagios/Icinga check: exits 0-3 and prints one line with perfdata")
+	fmt.Println("  credentials       Manage stored router credentials: set, get, delete")
 	fmt.Println()
 	fmt.Println("EXAMPLES:")
 	fmt.Println("  # List devices")
@@ -164,6 +681,51 @@ func showHelp() {
 	fmt.Println("  # List devices with pretty output")
 	fmt.Println("  netgear-orbi-go -pretty")
 	fmt.Println()
+	fmt.Println("  # List only devices missing from the registry")
+	fmt.Println("  netgear-orbi-go -unknown-only")
+	fmt.Println()
+	fmt.Println("  # List devices using randomized private MAC addresses")
+	fmt.Println("  netgear-orbi-go -vendor randomized")
+	fmt.Println()
 	fmt.Println("  # Reboot router without confirmation")
 	fmt.Println("  netgear-orbi-go -cmd reboot -force")
+	fmt.Println()
+	fmt.Println("  # Reboot and wait until the router is back online")
+	fmt.Println("  netgear-orbi-go -cmd reboot -force -wait")
+	fmt.Println()
+	fmt.Println("  # Reboot nightly at 4am unless more than 3 devices are active")
+	fmt.Println("  netgear-orbi-go -cmd schedule-reboot -schedule \"0 4 * * *\" -max-active 3")
+	fmt.Println()
+	fmt.Println("  # List devices over HTTPS, pinning the router certificate on first use")
+	fmt.Println("  netgear-orbi-go -https")
+	fmt.Println()
+	fmt.Println("  # Store the router password in the keyring (or an encrypted file)")
+	fmt.Println("  netgear-orbi-go -cmd credentials set")
+	fmt.Println()
+	fmt.Println("  # Store the password of a satellite site's router for the fleet command")
+	fmt.Println("  netgear-orbi-go -cmd credentials -router 10.2.0.1 set")
+	fmt.Println()
+	fmt.Println("  # Serve the REST API to a dashboard on this host (OpenAPI at /openapi.json)")
+	fmt.Println("  ORBI_API_TOKEN=secret netgear-orbi-go -cmd api")
+	fmt.Println()
+	fmt.Println("  # Alert from Nagios when fewer than 3 devices are active")
+	fmt.Println("  netgear-orbi-go -cmd check -warning-active 3 -critical-active 1")
+	fmt.Println()
+	fmt.Println("  # Summarize the routers at every office")
+	fmt.Println("  netgear-orbi-go -cmd fleet -tag office")
+	fmt.Println()
+	fmt.Println("  # Log reboots from a systemd timer to the journal with structured fields")
+	fmt.Println("  netgear-orbi-go -cmd reboot -force -log-target journald")
+	fmt.Println()
+	fmt.Println("  # Print device counts once as InfluxDB line protocol")
+	fmt.Println("  netgear-orbi-go -cmd metrics -metrics-once")
+	fmt.Println()
+	fmt.Println("  # Push device counts to an OpenTelemetry collector every minute")
+	fmt.Println("  netgear-orbi-go -cmd metrics -metrics-sink otlp -otlp-endpoint http://collector:4318/v1/metrics -interval 1m")
+	fmt.Println()
+	fmt.Println("  # Publish presence to Home Assistant over MQTT every minute")
+	fmt.Println("  netgear-orbi-go -cmd mqtt -mqtt-broker tcp://hass.local:1883 -mqtt-username orbi -interval 1m")
+	fmt.Println()
+	fmt.Println("  # Track presence and forward events to a home-automation webhook")
+	fmt.Println("  netgear-orbi-go -cmd presence -ndjson events.ndjson -webhook http://hass.local/api/webhook/orbi")
 }
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gateway-common/redact"
+)
+
+const (
+	METRICS_TIMEOUT      = 10 * time.Second
+	METRICS_SERVICE_NAME = "netgear-orbi-go"
+	INFLUX_TOKEN_ENV     = "ORBI_INFLUX_TOKEN"
+	OTLP_ENDPOINT_ENV    = "OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"
+	OTLP_HEADERS_ENV     = "OTEL_EXPORTER_OTLP_HEADERS"
+
+	SINK_INFLUX = "influx"
+	SINK_OTLP   = "otlp"
+)
+
+// Metric is one sample. Names and labels follow Prometheus conventions
+// (snake_case, base units in the name) so every sink, and a Prometheus
+// exporter, can be fed from the same samples.
+type Metric struct {
+	Name   string
+	Help   string
+	Unit   string // UCUM unit, as used by OTLP
+	Labels map[string]string
+	Value  float64
+	Time   time.Time
+}
+
+// MetricSink delivers a batch of samples somewhere.
+type MetricSink interface {
+	Name() string
+	Write(ctx context.Context, metrics []Metric) error
+}
+
+// DeviceInfoMetrics turns the router's device list into samples. A nil
+// list yields only orbi_up 0, so an unreachable router still shows up in
+// dashboards.
+func DeviceInfoMetrics(router string, info *DeviceInfo, now time.Time) []Metric {
+	metric := func(name, help, unit string, value float64, extra ...string) Metric {
+		labels := map[string]string{"router": router}
+		for i := 0; i+1 < len(extra); i += 2 {
+			labels[extra[i]] = extra[i+1]
+		}
+		return Metric{Name: name, Help: help, Unit: unit, Labels: labels, Value: value, Time: now}
+	}
+
+	if info == nil {
+		return []Metric{metric("orbi_up", "Whether the router answered the last poll", "1", 0)}
+	}
+
+	var unknown float64
+	byConnection := make(map[string]float64)
+	for _, device := range info.ConnectedDevices {
+		if !device.Known {
+			unknown++
+		}
+		connType := strings.ToLower(device.ConnType)
+		if connType == "" {
+			connType = "unknown"
+		}
+		byConnection[connType]++
+	}
+
+	metrics := []Metric{
+		metric("orbi_up", "Whether the router answered the last poll", "1", 1),
+		metric("orbi_devices_connected", "Devices attached to the router", "{device}", float64(info.TotalCount)),
+		metric("orbi_devices", "Devices by activity", "{device}", float64(len(info.ActiveDevices)), "state", "active"),
+		metric("orbi_devices", "Devices by activity", "{device}", float64(len(info.InactiveDevices)), "state", "inactive"),
+		metric("orbi_devices_unknown", "Devices missing from the registry", "{device}", unknown),
+	}
+	connTypes := make([]string, 0, len(byConnection))
+	for connType := range byConnection {
+		connTypes = append(connTypes, connType)
+	}
+	sort.Strings(connTypes)
+	for _, connType := range connTypes {
+		metrics = append(metrics, metric("orbi_devices_by_connection", "Devices by connection type", "{device}", byConnection[connType], "conn_type", connType))
+	}
+	return metrics
+}
+
+// sortedLabels returns the label names in a stable order.
+func sortedLabels(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// InfluxSink writes InfluxDB line protocol, one line per sample with the
+// metric name as measurement and the sample in the "value" field. With no
+// URL the lines go to Output, for piping into Telegraf or influx write.
+type InfluxSink struct {
+	URL        string // full write URL, e.g. http://influx:8086/api/v2/write?org=home&bucket=network
+	Token      string
+	Output     io.Writer
+	HTTPClient *http.Client
+}
+
+func NewInfluxSink(url, token string) *InfluxSink {
+	return &InfluxSink{
+		URL:        url,
+		Token:      token,
+		Output:     os.Stdout,
+		HTTPClient: &http.Client{Timeout: METRICS_TIMEOUT},
+	}
+}
+
+func (s *InfluxSink) Name() string { return SINK_INFLUX }
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// EncodeLineProtocol renders samples as line protocol with nanosecond
+// timestamps. Empty label values are dropped, as InfluxDB rejects them.
+func EncodeLineProtocol(metrics []Metric) []byte {
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		buf.WriteString(influxMeasurementEscaper.Replace(m.Name))
+		for _, k := range sortedLabels(m.Labels) {
+			if m.Labels[k] == "" {
+				continue
+			}
+			fmt.Fprintf(&buf, ",%s=%s", influxTagEscaper.Replace(k), influxTagEscaper.Replace(m.Labels[k]))
+		}
+		fmt.Fprintf(&buf, " value=%s %d\n", strconv.FormatFloat(m.Value, 'g', -1, 64), m.Time.UnixNano())
+	}
+	return buf.Bytes()
+}
+
+func (s *InfluxSink) Write(ctx context.Context, metrics []Metric) error {
+	body := EncodeLineProtocol(metrics)
+	if s.URL == "" {
+		_, err := s.Output.Write(body)
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	}
+	return sendMetrics(s.HTTPClient, req)
+}
+
+// OTLPSink pushes samples to an OpenTelemetry collector using OTLP/HTTP
+// with JSON encoding. Every sample is exported as a gauge.
+type OTLPSink struct {
+	Endpoint   string // e.g. http://collector:4318/v1/metrics
+	Headers    map[string]string
+	HTTPClient *http.Client
+}
+
+func NewOTLPSink(endpoint string, headers map[string]string) *OTLPSink {
+	return &OTLPSink{
+		Endpoint:   endpoint,
+		Headers:    headers,
+		HTTPClient: &http.Client{Timeout: METRICS_TIMEOUT},
+	}
+}
+
+func (s *OTLPSink) Name() string { return SINK_OTLP }
+
+// ParseOTLPHeaders parses the OTEL_EXPORTER_OTLP_HEADERS format,
+// key1=value1,key2=value2.
+func ParseOTLPHeaders(spec string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected key=value", pair)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+type otlpMetric struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Gauge       struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+type otlpScopeMetrics struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Metrics []*otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+// EncodeOTLP renders samples as an OTLP ExportMetricsServiceRequest,
+// grouping samples of the same name into one metric.
+func EncodeOTLP(metrics []Metric) ([]byte, error) {
+	var order []*otlpMetric
+	byName := make(map[string]*otlpMetric)
+	for _, m := range metrics {
+		om, ok := byName[m.Name]
+		if !ok {
+			om = &otlpMetric{Name: m.Name, Description: m.Help, Unit: m.Unit}
+			byName[m.Name] = om
+			order = append(order, om)
+		}
+		point := otlpDataPoint{
+			Attributes:   []otlpAttribute{},
+			TimeUnixNano: strconv.FormatInt(m.Time.UnixNano(), 10),
+			AsDouble:     m.Value,
+		}
+		for _, k := range sortedLabels(m.Labels) {
+			point.Attributes = append(point.Attributes, otlpAttribute{Key: k, Value: otlpValue{StringValue: m.Labels[k]}})
+		}
+		om.Gauge.DataPoints = append(om.Gauge.DataPoints, point)
+	}
+
+	var scope otlpScopeMetrics
+	scope.Scope.Name = METRICS_SERVICE_NAME
+	scope.Metrics = order
+
+	var resource otlpResourceMetrics
+	resource.Resource.Attributes = []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: METRICS_SERVICE_NAME}}}
+	resource.ScopeMetrics = []otlpScopeMetrics{scope}
+
+	req := otlpRequest{ResourceMetrics: []otlpResourceMetrics{resource}}
+	return json.Marshal(req)
+}
+
+func (s *OTLPSink) Write(ctx context.Context, metrics []Metric) error {
+	body, err := EncodeOTLP(metrics)
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	return sendMetrics(s.HTTPClient, req)
+}
+
+func sendMetrics(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("metrics rejected with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// MetricsExporter polls the router on an interval and hands the samples to
+// every sink.
+type MetricsExporter struct {
+	Sinks        []MetricSink
+	Client       *Client
+	RegistryPath string
+	Interval     time.Duration // zero collects once
+}
+
+// routerLabel is the router's host, used to tell routers apart.
+func (e *MetricsExporter) routerLabel() string {
+	if u, err := url.Parse(e.Client.BaseURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return e.Client.BaseURL
+}
+
+// Collect polls the router once.
+func (e *MetricsExporter) Collect() []Metric {
+	info, err := e.Client.GetDevices()
+	if err != nil {
+		e.Client.Logger.Warn("Router Poll Failed", "error", err)
+		return DeviceInfoMetrics(e.routerLabel(), nil, time.Now())
+	}
+
+	if registry, err := LoadRegistry(e.RegistryPath); err == nil {
+		registry.Annotate(info)
+	} else {
+		e.Client.Logger.Warn("Could not load registry", "error", err)
+	}
+	return DeviceInfoMetrics(e.routerLabel(), info, time.Now())
+}
+
+// ExportOnce collects and writes to every sink, returning the first sink
+// error after trying them all.
+func (e *MetricsExporter) ExportOnce(ctx context.Context) error {
+	metrics := e.Collect()
+
+	var firstErr error
+	for _, sink := range e.Sinks {
+		if err := sink.Write(ctx, metrics); err != nil {
+			e.Client.Logger.Warn("Metrics Sink Failed", "sink", sink.Name(), "error", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", sink.Name(), err)
+			}
+			continue
+		}
+		e.Client.Logger.Debug("Exported Metrics", "sink", sink.Name(), "samples", len(metrics))
+	}
+	return firstErr
+}
+
+// Run exports immediately and then on every interval until ctx is
+// cancelled. Sink failures are logged and retried on the next interval.
+func (e *MetricsExporter) Run(ctx context.Context) error {
+	if e.Interval <= 0 {
+		return e.ExportOnce(ctx)
+	}
+
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	for {
+		e.ExportOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NewMetricSinks builds the sinks named in a comma-separated list.
+func NewMetricSinks(spec, influxURL, otlpEndpoint string) ([]MetricSink, error) {
+	var sinks []MetricSink
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case SINK_INFLUX:
+			token := os.Getenv(INFLUX_TOKEN_ENV)
+			redact.Register(token)
+			sinks = append(sinks, NewInfluxSink(influxURL, token))
+		case SINK_OTLP:
+			if otlpEndpoint == "" {
+				return nil, fmt.Errorf("the otlp sink needs -otlp-endpoint or $%s", OTLP_ENDPOINT_ENV)
+			}
+			headers, err := ParseOTLPHeaders(os.Getenv(OTLP_HEADERS_ENV))
+			if err != nil {
+				return nil, fmt.Errorf("invalid $%s: %w", OTLP_HEADERS_ENV, err)
+			}
+			for _, v := range headers {
+				redact.Register(v)
+			}
+			sinks = append(sinks, NewOTLPSink(otlpEndpoint, headers))
+		default:
+			return nil, fmt.Errorf("unknown metrics sink %q, expected %s or %s", name, SINK_INFLUX, SINK_OTLP)
+		}
+	}
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("no metrics sink selected")
+	}
+	return sinks, nil
+}
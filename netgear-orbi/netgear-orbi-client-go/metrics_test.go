@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"netgear-orbi-go/mockrouter"
+)
+
+func TestMetricsExporterWritesInfluxAndOTLP(t *testing.T) {
+	_, client := newMockClient(t, mockrouter.Config{Devices: testDevices})
+
+	var otlp otlpRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&otlp); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(collector.Close)
+
+	var lines bytes.Buffer
+	influx := NewInfluxSink("", "")
+	influx.Output = &lines
+	exporter := &MetricsExporter{
+		Sinks:        []MetricSink{influx, NewOTLPSink(collector.URL+"/v1/metrics", nil)},
+		Client:       client,
+		RegistryPath: filepath.Join(t.TempDir(), "devices.json"),
+	}
+	if err := exporter.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	router := exporter.routerLabel()
+	for _, line := range []string{
+		"orbi_up,router=" + router + " value=1 ",
+		"orbi_devices_connected,router=" + router + " value=3 ",
+		"orbi_devices,router=" + router + ",state=active value=1 ",
+		"orbi_devices_by_connection,conn_type=wireless,router=" + router + " value=2 ",
+	} {
+		if !strings.Contains(lines.String(), line) {
+			t.Errorf("line protocol is missing %q:\n%s", line, lines.String())
+		}
+	}
+
+	if len(otlp.ResourceMetrics) != 1 {
+		t.Fatalf("OTLP request not received: %+v", otlp)
+	}
+	points := make(map[string]int)
+	for _, m := range otlp.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		points[m.Name] = len(m.Gauge.DataPoints)
+	}
+	if points["orbi_devices"] != 2 || points["orbi_devices_by_connection"] != 2 || points["orbi_devices_unknown"] != 1 {
+		t.Fatalf("unexpected OTLP data points: %v", points)
+	}
+}
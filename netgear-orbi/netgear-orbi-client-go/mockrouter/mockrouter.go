@@ -0,0 +1,211 @@
+// Package mockrouter implements a fake NETGEAR Orbi web interface serving the
+// pages the client scrapes, with Basic auth and a simulated reboot outage.
+package mockrouter
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Device struct {
+	Name        string `json:"name"`
+	IP          string `json:"ip"`
+	MAC         string `json:"mac"`
+	ConnType    string `json:"conn_type"`
+	BackhaulSta string `json:"backhaul_sta,omitempty"`
+}
+
+type Config struct {
+	Username string
+	Password string
+	Devices  []Device
+
+	// DevicesAfterReboot replaces Devices once a reboot completes; nil keeps them.
+	DevicesAfterReboot []Device
+
+	// RebootOutage is how long the router drops connections after a reboot.
+	RebootOutage time.Duration
+
+	// DeviceInfoPage, when set, is served verbatim instead of the device list.
+	DeviceInfoPage string
+}
+
+type Server struct {
+	cfg Config
+
+	mu          sync.Mutex
+	devices     []Device
+	timestamp   int64
+	downUntil   time.Time
+	reboots     int
+	authFailure int
+}
+
+func New(cfg Config) *Server {
+	return &Server{
+		cfg:       cfg,
+		devices:   cfg.Devices,
+		timestamp: time.Now().Unix(),
+	}
+}
+
+// NewServer starts s on a loopback httptest server.
+func NewServer(cfg Config) (*Server, *httptest.Server) {
+	s := New(cfg)
+	return s, httptest.NewServer(s)
+}
+
+func (s *Server) Reboots() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reboots
+}
+
+func (s *Server) AuthFailures() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.authFailure
+}
+
+func (s *Server) SetDevices(devices []Device) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices = devices
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.isDown() {
+		dropConnection(w)
+		return
+	}
+
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="NETGEAR Orbi"`)
+		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/DEV_device_info.htm":
+		s.handleDeviceInfo(w)
+	case "/reboot.htm":
+		s.handleRebootPage(w)
+	case "/apply.cgi":
+		s.handleApply(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	username, password, ok := r.BasicAuth()
+	if ok &&
+		subtle.ConstantTimeCompare([]byte(username), []byte(s.cfg.Username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.cfg.Password)) == 1 {
+		return true
+	}
+
+	s.mu.Lock()
+	s.authFailure++
+	s.mu.Unlock()
+	return false
+}
+
+func (s *Server) isDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.downUntil.IsZero() {
+		return false
+	}
+	if time.Now().Before(s.downUntil) {
+		return true
+	}
+
+	// Back up: the router comes back with a fresh page timestamp
+	s.downUntil = time.Time{}
+	s.timestamp = time.Now().Unix()
+	if s.cfg.DevicesAfterReboot != nil {
+		s.devices = s.cfg.DevicesAfterReboot
+	}
+	return false
+}
+
+// dropConnection closes the socket without a response, like a router that
+// is mid-reboot.
+func dropConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "rebooting", http.StatusServiceUnavailable)
+		return
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	conn.Close()
+}
+
+func (s *Server) handleDeviceInfo(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html")
+
+	if s.cfg.DeviceInfoPage != "" {
+		fmt.Fprint(w, s.cfg.DeviceInfoPage)
+		return
+	}
+
+	s.mu.Lock()
+	devices := s.devices
+	s.mu.Unlock()
+	if devices == nil {
+		devices = []Device{}
+	}
+
+	deviceJSON, _ := json.Marshal(devices)
+	fmt.Fprintf(w, "<html>\n<script>\nvar ts=%d;\ndevice=%s\n</script>\n</html>\n", time.Now().Unix(), deviceJSON)
+}
+
+func (s *Server) handleRebootPage(w http.ResponseWriter) {
+	s.mu.Lock()
+	timestamp := s.timestamp
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, `<html><form method="POST" action="/apply.cgi?/reboot_waiting.htm timestamp=%d">`+
+		`<input type="hidden" name="submit_flag" value="reboot"></form></html>`, timestamp)
+}
+
+func (s *Server) handleApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("submit_flag") != "reboot" || r.PostForm.Get("yes") != "Yes" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	// The page timestamp guards against replayed form posts
+	s.mu.Lock()
+	expected := "/reboot_waiting.htm timestamp=" + strconv.FormatInt(s.timestamp, 10)
+	s.mu.Unlock()
+	if query, err := url.PathUnescape(r.URL.RawQuery); err != nil || query != expected {
+		http.Error(w, "invalid timestamp", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	s.reboots++
+	s.downUntil = time.Now().Add(s.cfg.RebootOutage)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, "<html>Rebooting...</html>")
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	MQTT_BROKER           = "tcp://127.0.0.1:1883"
+	MQTT_CLIENT_ID        = "netgear-orbi-go"
+	MQTT_TOPIC_PREFIX     = "orbi"
+	MQTT_DISCOVERY_PREFIX = "homeassistant"
+	MQTT_TIMEOUT          = 10 * time.Second
+	MQTT_PASSWORD_ENV     = "ORBI_MQTT_PASSWORD"
+
+	MQTT_ONLINE   = "online"
+	MQTT_OFFLINE  = "offline"
+	MQTT_PRESS    = "PRESS"
+	MQTT_HOME     = "home"
+	MQTT_NOT_HOME = "not_home"
+)
+
+type MQTTConfig struct {
+	Broker          string
+	ClientID        string
+	Username        string
+	Password        string
+	TopicPrefix     string
+	DiscoveryPrefix string // empty disables Home Assistant discovery
+	Interval        time.Duration
+}
+
+func DefaultMQTTConfig() MQTTConfig {
+	return MQTTConfig{
+		Broker:          MQTT_BROKER,
+		ClientID:        MQTT_CLIENT_ID,
+		Password:        os.Getenv(MQTT_PASSWORD_ENV),
+		TopicPrefix:     MQTT_TOPIC_PREFIX,
+		DiscoveryPrefix: MQTT_DISCOVERY_PREFIX,
+		Interval:        30 * time.Second,
+	}
+}
+
+// MQTTRouterState is the retained JSON published for the router on every poll.
+type MQTTRouterState struct {
+	Connected int `json:"connected"`
+	Active    int `json:"active"`
+	Inactive  int `json:"inactive"`
+	Unknown   int `json:"unknown"`
+}
+
+// MQTTPublisher polls the router on an interval and publishes device
+// presence, with Home Assistant discovery so the router shows up as a
+// device with device-count and online sensors and a reboot button, and
+// every client device as a device tracker.
+//
+// Topics, with <mac> lowercase hex without separators:
+//
+//	<prefix>/bridge/availability     online/offline (last will)
+//	<prefix>/router/state            MQTTRouterState JSON, retained
+//	<prefix>/router/online           ON/OFF, retained
+//	<prefix>/router/reboot           PRESS reboots the router
+//	<prefix>/device/<mac>/state      home/not_home, retained
+//	<prefix>/device/<mac>/attributes Device JSON, retained
+//	<prefix>/presence                PresenceEvent JSON for every change
+type MQTTPublisher struct {
+	Config       MQTTConfig
+	Client       *Client
+	RegistryPath string
+
+	client mqtt.Client
+
+	// Serializes router requests between polls and reboots
+	routerMu sync.Mutex
+
+	mu         sync.Mutex
+	previous   *DeviceInfo
+	devices    map[string]Device
+	discovered bool
+}
+
+func NewMQTTPublisher(cfg MQTTConfig, client *Client, registryPath string) *MQTTPublisher {
+	return &MQTTPublisher{
+		Config:       cfg,
+		Client:       client,
+		RegistryPath: registryPath,
+		devices:      make(map[string]Device),
+	}
+}
+
+// mqttMAC turns a MAC address into a topic and ID segment.
+func mqttMAC(mac string) string {
+	return strings.NewReplacer(":", "", "-", "").Replace(strings.ToLower(mac))
+}
+
+func (p *MQTTPublisher) topic(parts ...string) string {
+	return p.Config.TopicPrefix + "/" + strings.Join(parts, "/")
+}
+
+// Connect connects to the broker. Subscriptions and the online message are
+// (re)established on every connect, so broker restarts are survived.
+func (p *MQTTPublisher) Connect() error {
+	availability := p.topic("bridge", "availability")
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(p.Config.Broker).
+		SetClientID(p.Config.ClientID).
+		SetUsername(p.Config.Username).
+		SetPassword(p.Config.Password).
+		SetWill(availability, MQTT_OFFLINE, 1, true).
+		SetAutoReconnect(true).
+		SetConnectTimeout(MQTT_TIMEOUT).
+		SetOnConnectHandler(func(client mqtt.Client) {
+			p.publish(availability, MQTT_ONLINE, true)
+			client.Subscribe(p.topic("router", "reboot"), 0, p.handleReboot)
+			if p.Config.DiscoveryPrefix != "" {
+				client.Subscribe(p.Config.DiscoveryPrefix+"/status", 0, p.handleHomeAssistantStatus)
+			}
+			p.Client.Logger.Info("Connected To MQTT Broker", "broker", p.Config.Broker)
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			p.Client.Logger.Warn("MQTT Connection Lost", "broker", p.Config.Broker, "error", err)
+		})
+
+	p.client = mqtt.NewClient(opts)
+	token := p.client.Connect()
+	if !token.WaitTimeout(MQTT_TIMEOUT) {
+		return fmt.Errorf("timed out connecting to %s", p.Config.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", p.Config.Broker, err)
+	}
+	return nil
+}
+
+// Run publishes immediately and then on every interval until ctx is
+// cancelled.
+func (p *MQTTPublisher) Run(ctx context.Context) error {
+	if err := p.Connect(); err != nil {
+		return err
+	}
+	defer p.Close()
+
+	ticker := time.NewTicker(p.Config.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.PublishOnce()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close marks the bridge offline and disconnects.
+func (p *MQTTPublisher) Close() {
+	if p.client != nil && p.client.IsConnected() {
+		p.publish(p.topic("bridge", "availability"), MQTT_OFFLINE, true)
+		p.client.Disconnect(250)
+	}
+}
+
+// PublishOnce polls the router and publishes the device list and any
+// presence changes since the previous poll.
+func (p *MQTTPublisher) PublishOnce() {
+	p.routerMu.Lock()
+	current, err := p.Client.GetDevices()
+	p.routerMu.Unlock()
+	if err != nil {
+		p.Client.Logger.Warn("Router Poll Failed", "error", err)
+		p.publish(p.topic("router", "online"), "OFF", true)
+		return
+	}
+
+	if registry, err := LoadRegistry(p.RegistryPath); err == nil {
+		registry.Annotate(current)
+	} else {
+		p.Client.Logger.Warn("Could not load registry", "error", err)
+	}
+
+	p.publishRouterDiscovery(false)
+
+	state := MQTTRouterState{
+		Connected: current.TotalCount,
+		Active:    len(current.ActiveDevices),
+		Inactive:  len(current.InactiveDevices),
+	}
+	for _, device := range current.ConnectedDevices {
+		if !device.Known {
+			state.Unknown++
+		}
+	}
+	p.publish(p.topic("router", "state"), state, true)
+	p.publish(p.topic("router", "online"), "ON", true)
+
+	p.mu.Lock()
+	previous := p.previous
+	p.previous = current
+	p.mu.Unlock()
+
+	present := devicesByMAC(current)
+	for _, device := range present {
+		p.publishDevice(device, MQTT_HOME, false)
+	}
+	for mac, device := range devicesByMAC(previous) {
+		if _, ok := present[mac]; !ok {
+			p.publishDevice(device, MQTT_NOT_HOME, false)
+		}
+	}
+
+	// The first poll is the baseline, as with the presence command
+	if previous != nil {
+		for _, event := range DiffDevices(previous, current, time.Now()) {
+			p.publish(p.topic("presence"), event, false)
+		}
+	}
+	p.Client.Logger.Debug("Published Router Status", "devices", current.TotalCount)
+}
+
+// publishDevice sends a device's presence and attributes, announcing the
+// device to Home Assistant the first time it is seen.
+func (p *MQTTPublisher) publishDevice(device Device, state string, force bool) {
+	mac := mqttMAC(device.MAC)
+
+	p.mu.Lock()
+	_, seen := p.devices[mac]
+	p.devices[mac] = device
+	p.mu.Unlock()
+
+	if p.Config.DiscoveryPrefix != "" && (!seen || force) {
+		id := "orbi_" + mac
+		p.publish(p.Config.DiscoveryPrefix+"/device_tracker/"+id+"/config", map[string]any{
+			"name":                  device.DisplayName(),
+			"unique_id":             id,
+			"object_id":             id,
+			"state_topic":           p.topic("device", mac, "state"),
+			"json_attributes_topic": p.topic("device", mac, "attributes"),
+			"payload_home":          MQTT_HOME,
+			"payload_not_home":      MQTT_NOT_HOME,
+			"source_type":           "router",
+			"availability_topic":    p.topic("bridge", "availability"),
+		}, true)
+	}
+
+	if force {
+		return
+	}
+	p.publish(p.topic("device", mac, "attributes"), device, true)
+	p.publish(p.topic("device", mac, "state"), state, true)
+}
+
+func (p *MQTTPublisher) publishRouterDiscovery(force bool) {
+	if p.Config.DiscoveryPrefix == "" {
+		return
+	}
+
+	p.mu.Lock()
+	done := p.discovered
+	p.discovered = true
+	p.mu.Unlock()
+	if done && !force {
+		return
+	}
+
+	id := "orbi_router"
+	device := map[string]any{
+		"identifiers":  []string{id},
+		"name":         "Netgear Orbi",
+		"manufacturer": "Netgear",
+		"model":        "Orbi",
+	}
+	availability := p.topic("bridge", "availability")
+	stateTopic := p.topic("router", "state")
+
+	sensor := func(key, name, template, icon string) map[string]any {
+		return map[string]any{
+			"name":               name,
+			"unique_id":          id + "_" + key,
+			"object_id":          id + "_" + key,
+			"state_topic":        stateTopic,
+			"value_template":     template,
+			"state_class":        "measurement",
+			"icon":               icon,
+			"availability_topic": availability,
+			"device":             device,
+		}
+	}
+
+	configs := map[string]map[string]any{
+		"sensor/" + id + "/connected": sensor("connected", "Connected Devices", "{{ value_json.connected }}", "mdi:devices"),
+		"sensor/" + id + "/active":    sensor("active", "Active Devices", "{{ value_json.active }}", "mdi:lan-connect"),
+		"sensor/" + id + "/unknown":   sensor("unknown", "Unknown Devices", "{{ value_json.unknown }}", "mdi:help-network"),
+		"binary_sensor/" + id + "/online": {
+			"name":               "Online",
+			"unique_id":          id + "_online",
+			"object_id":          id + "_online",
+			"state_topic":        p.topic("router", "online"),
+			"device_class":       "connectivity",
+			"availability_topic": availability,
+			"device":             device,
+		},
+		"button/" + id + "/reboot": {
+			"name":               "Reboot",
+			"unique_id":          id + "_reboot",
+			"object_id":          id + "_reboot",
+			"command_topic":      p.topic("router", "reboot"),
+			"payload_press":      MQTT_PRESS,
+			"device_class":       "restart",
+			"availability_topic": availability,
+			"device":             device,
+		},
+	}
+
+	for path, config := range configs {
+		p.publish(p.Config.DiscoveryPrefix+"/"+path+"/config", config, true)
+	}
+	p.Client.Logger.Info("Published Home Assistant Discovery", "device", id)
+}
+
+// publish sends a message, encoding anything but strings as JSON.
+func (p *MQTTPublisher) publish(topic string, payload any, retained bool) {
+	var data []byte
+	switch v := payload.(type) {
+	case string:
+		data = []byte(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			p.Client.Logger.Error("MQTT Encode Failed", "topic", topic, "error", err)
+			return
+		}
+		data = encoded
+	}
+
+	token := p.client.Publish(topic, 1, retained, data)
+	if !token.WaitTimeout(MQTT_TIMEOUT) {
+		p.Client.Logger.Warn("MQTT Publish Timed Out", "topic", topic)
+		return
+	}
+	if err := token.Error(); err != nil {
+		p.Client.Logger.Warn("MQTT Publish Failed", "topic", topic, "error", err)
+	}
+}
+
+// handleReboot runs when the reboot button is pressed. Retained commands
+// are ignored so that a stale message cannot reboot the router on connect.
+func (p *MQTTPublisher) handleReboot(_ mqtt.Client, msg mqtt.Message) {
+	if msg.Retained() || strings.TrimSpace(string(msg.Payload())) != MQTT_PRESS {
+		return
+	}
+
+	p.Client.Logger.Info("Reboot Requested Over MQTT")
+	go func() {
+		p.routerMu.Lock()
+		err := p.Client.RebootRouter()
+		p.routerMu.Unlock()
+		if err != nil {
+			p.Client.Logger.Error("Reboot Failed", "error", err)
+			return
+		}
+		p.publish(p.topic("router", "online"), "OFF", true)
+	}()
+}
+
+// handleHomeAssistantStatus republishes discovery when Home Assistant comes
+// back online, in case it lost the retained configs.
+func (p *MQTTPublisher) handleHomeAssistantStatus(_ mqtt.Client, msg mqtt.Message) {
+	if string(msg.Payload()) != MQTT_ONLINE {
+		return
+	}
+
+	p.mu.Lock()
+	devices := make([]Device, 0, len(p.devices))
+	for _, device := range p.devices {
+		devices = append(devices, device)
+	}
+	p.mu.Unlock()
+
+	go func() {
+		p.publishRouterDiscovery(true)
+		for _, device := range devices {
+			p.publishDevice(device, "", true)
+		}
+	}()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	broker "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"netgear-orbi-go/mockrouter"
+)
+
+func TestMQTTPublishesPresenceAndDiscovery(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	b := broker.New(&broker.Options{InlineClient: true, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	b.AddHook(new(auth.AllowHook), nil)
+	if err := b.AddListener(listeners.NewTCP(listeners.Config{ID: "test", Address: addr})); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	var mu sync.Mutex
+	messages := make(map[string]string)
+	b.Subscribe("#", 1, func(_ *broker.Client, _ packets.Subscription, pk packets.Packet) {
+		mu.Lock()
+		messages[pk.TopicName] = string(pk.Payload)
+		mu.Unlock()
+	})
+	message := func(topic string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		return messages[topic]
+	}
+	waitFor := func(what string, ok func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(3 * time.Second); !ok(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+
+	// A stale retained press must never reboot the router
+	b.Publish("orbi/router/reboot", []byte(MQTT_PRESS), true, 0)
+
+	server, client := newMockClient(t, mockrouter.Config{Devices: testDevices})
+	cfg := DefaultMQTTConfig()
+	cfg.Broker = "tcp://" + addr
+	publisher := NewMQTTPublisher(cfg, client, filepath.Join(t.TempDir(), "devices.json"))
+	if err := publisher.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	publisher.PublishOnce()
+
+	var state MQTTRouterState
+	if err := json.Unmarshal([]byte(message("orbi/router/state")), &state); err != nil || state.Connected != 3 || state.Unknown != 3 {
+		t.Fatalf("bad router state %q: %v", message("orbi/router/state"), err)
+	}
+	for _, path := range []string{"sensor/orbi_router/connected", "binary_sensor/orbi_router/online", "button/orbi_router/reboot", "device_tracker/orbi_b827ebaabbcc"} {
+		var config map[string]any
+		if err := json.Unmarshal([]byte(message("homeassistant/"+path+"/config")), &config); err != nil || config["unique_id"] == nil {
+			t.Fatalf("missing or invalid discovery config for %s: %v", path, err)
+		}
+	}
+	if got := message("orbi/device/b827ebaabbcc/state"); got != MQTT_HOME {
+		t.Fatalf("NAS state = %q, want %q", got, MQTT_HOME)
+	}
+
+	// The NAS leaves
+	server.SetDevices(append(testDevices[:1:1], testDevices[2]))
+	publisher.PublishOnce()
+	if got := message("orbi/device/b827ebaabbcc/state"); got != MQTT_NOT_HOME {
+		t.Fatalf("NAS state = %q, want %q", got, MQTT_NOT_HOME)
+	}
+	var event PresenceEvent
+	if err := json.Unmarshal([]byte(message("orbi/presence")), &event); err != nil || event.Type != "leave" || event.Name != "NAS" {
+		t.Fatalf("bad presence event %q: %v", message("orbi/presence"), err)
+	}
+
+	// Pressing the button in Home Assistant
+	b.Publish("orbi/router/reboot", []byte(MQTT_PRESS), false, 0)
+	waitFor("the reboot", func() bool { return server.Reboots() == 1 })
+
+	publisher.Close()
+	waitFor("the bridge to go offline", func() bool { return message("orbi/bridge/availability") == MQTT_OFFLINE })
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	_ "embed"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// oui.txt holds one "PREFIX<TAB>Organization" line per IEEE MA-L assignment,
+// with the prefix as six uppercase hex digits. It is derived from
+// https://standards-oui.ieee.org/oui/oui.csv and can be refreshed with:
+//
+//	curl -s https://standards-oui.ieee.org/oui/oui.csv |
+//	  python3 -c 'import csv,sys; [print(r[1]+"\t"+" ".join(r[2].split())) for r in list(csv.reader(sys.stdin))[1:]]' |
+//	  LC_ALL=C sort -u | awk -F'\t' '!seen[$1]++' > oui.txt
+//
+// The registry assigns a few prefixes more than once; the awk step keeps the
+// first organization in sort order so every prefix has exactly one vendor.
+//
+//go:embed oui.txt
+var ouiData string
+
+const RANDOMIZED_VENDOR = "Randomized MAC"
+
+var (
+	ouiOnce  sync.Once
+	ouiTable map[string]string
+)
+
+func loadOUITable() {
+	ouiTable = make(map[string]string, strings.Count(ouiData, "\n"))
+	for line := range strings.SplitSeq(ouiData, "\n") {
+		prefix, vendor, ok := strings.Cut(line, "\t")
+		if ok {
+			ouiTable[prefix] = vendor
+		}
+	}
+}
+
+// macPrefix returns the first three octets of mac as uppercase hex, accepting
+// colon, dash, dot or no separators.
+func macPrefix(mac string) (string, bool) {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '-', '.':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(mac)))
+
+	if len(digits) < 6 {
+		return "", false
+	}
+	if _, err := strconv.ParseUint(digits[:6], 16, 32); err != nil {
+		return "", false
+	}
+	return digits[:6], true
+}
+
+// LookupVendor returns the organization registered for the MAC's OUI, or ""
+// when the prefix is unassigned or the MAC is malformed.
+func LookupVendor(mac string) string {
+	prefix, ok := macPrefix(mac)
+	if !ok {
+		return ""
+	}
+	ouiOnce.Do(loadOUITable)
+	return ouiTable[prefix]
+}
+
+// IsLocallyAdministered reports whether the U/L bit of the first octet is set,
+// which is how phones and laptops mark their randomized private addresses.
+func IsLocallyAdministered(mac string) bool {
+	prefix, ok := macPrefix(mac)
+	if !ok {
+		return false
+	}
+	firstOctet, _ := strconv.ParseUint(prefix[:2], 16, 8)
+	return firstOctet&0x02 != 0
+}
+
+func annotateVendor(device *Device) {
+	device.RandomizedMAC = IsLocallyAdministered(device.MAC)
+	if !device.RandomizedMAC {
+		device.Vendor = LookupVendor(device.MAC)
+	}
+}
+
+// VendorLabel is the manufacturer as shown to users.
+func (d Device) VendorLabel() string {
+	switch {
+	case d.RandomizedMAC:
+		return RANDOMIZED_VENDOR
+	case d.Vendor != "":
+		return d.Vendor
+	default:
+		return "Unknown"
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestOUIDataHasOneVendorPerPrefix(t *testing.T) {
+	line := regexp.MustCompile(`^[0-9A-F]{6}\t\S.*$`)
+	vendors := make(map[string]string)
+	for i, entry := range strings.Split(strings.TrimSuffix(ouiData, "\n"), "\n") {
+		if !line.MatchString(entry) {
+			t.Fatalf("oui.txt:%d is malformed: %q", i+1, entry)
+		}
+		prefix, vendor, _ := strings.Cut(entry, "\t")
+		if previous, ok := vendors[prefix]; ok {
+			t.Errorf("oui.txt:%d: prefix %s maps to both %q and %q", i+1, prefix, previous, vendor)
+		}
+		vendors[prefix] = vendor
+	}
+}
+
+func TestLookupVendor(t *testing.T) {
+	for _, tt := range []struct{ mac, want string }{
+		{"00:01:C8:12:34:56", "CONRAD CORP."},
+		{"08-00-30-00-00-01", "CERN"},
+		{"0800.3000.0001", "CERN"},
+		{"b8:27:eb:aa:bb:cc", "Raspberry Pi Foundation"},
+		{"zz:zz:zz:00:00:00", ""},
+		{"00:01", ""},
+	} {
+		if got := LookupVendor(tt.mac); got != tt.want {
+			t.Errorf("LookupVendor(%q) = %q, want %q", tt.mac, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	EventJoin           = "join"
+	EventLeave          = "leave"
+	EventIPChange       = "ip-change"
+	EventConnTypeChange = "conn-type-change"
+)
+
+type PresenceEvent struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	MAC      string    `json:"mac"`
+	Name     string    `json:"name"`
+	IP       string    `json:"ip,omitempty"`
+	ConnType string    `json:"conn_type,omitempty"`
+	Vendor   string    `json:"vendor,omitempty"`
+	Previous string    `json:"previous,omitempty"`
+}
+
+// DiffDevices compares two snapshots by MAC and returns the presence events
+// that turn prev into curr, ordered by MAC for stable output.
+func DiffDevices(prev, curr *DeviceInfo, at time.Time) []PresenceEvent {
+	before := devicesByMAC(prev)
+	after := devicesByMAC(curr)
+
+	var events []PresenceEvent
+	for mac, device := range after {
+		old, existed := before[mac]
+		if !existed {
+			events = append(events, newPresenceEvent(EventJoin, device, "", at))
+			continue
+		}
+		if old.IP != device.IP {
+			events = append(events, newPresenceEvent(EventIPChange, device, old.IP, at))
+		}
+		if old.ConnType != device.ConnType {
+			events = append(events, newPresenceEvent(EventConnTypeChange, device, old.ConnType, at))
+		}
+	}
+	for mac, device := range before {
+		if _, stillHere := after[mac]; !stillHere {
+			events = append(events, newPresenceEvent(EventLeave, device, "", at))
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].MAC < events[j].MAC
+	})
+
+	return events
+}
+
+func devicesByMAC(info *DeviceInfo) map[string]Device {
+	devices := make(map[string]Device)
+	if info == nil {
+		return devices
+	}
+	for _, device := range info.ConnectedDevices {
+		devices[strings.ToLower(device.MAC)] = device
+	}
+	return devices
+}
+
+func newPresenceEvent(eventType string, device Device, previous string, at time.Time) PresenceEvent {
+	return PresenceEvent{
+		Time:     at,
+		Type:     eventType,
+		MAC:      strings.ToLower(device.MAC),
+		Name:     device.Name,
+		IP:       device.IP,
+		ConnType: device.ConnType,
+		Vendor:   device.VendorLabel(),
+		Previous: previous,
+	}
+}
+
+type PresenceSinks struct {
+	NDJSON     io.Writer
+	WebhookURL string
+	HTTPClient *http.Client
+}
+
+// OpenNDJSON opens the NDJSON event log for appending; "-" means stdout.
+func OpenNDJSON(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return os.Stdout, nil
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
+
+// Deliver sends the event to every configured sink, so a failing NDJSON log
+// does not starve the webhook or the other way round.
+func (s *PresenceSinks) Deliver(event PresenceEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	var errs []error
+	if s.NDJSON != nil {
+		if _, err := s.NDJSON.Write(append(payload, '\n')); err != nil {
+			errs = append(errs, fmt.Errorf("failed to write event: %w", err))
+		}
+	}
+
+	if s.WebhookURL != "" {
+		if err := s.postWebhook(payload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *PresenceSinks) postWebhook(payload []byte) error {
+	resp, err := s.HTTPClient.Post(s.WebhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("webhook delivery failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// TrackPresence polls the router every interval and reports the difference
+// between consecutive snapshots. The first successful snapshot is the
+// baseline and produces no events.
+func (c *Client) TrackPresence(interval time.Duration, sinks *PresenceSinks, onEvent func(PresenceEvent)) {
+	var previous *DeviceInfo
+
+	for {
+		current, err := c.GetDevices()
+		if err != nil {
+			c.Logger.Warn("Presence Poll Failed", "error", err)
+		} else if previous == nil {
+			c.Logger.Info("Presence Baseline", "devices", current.TotalCount)
+			previous = current
+		} else {
+			for _, event := range DiffDevices(previous, current, time.Now()) {
+				onEvent(event)
+				if err := sinks.Deliver(event); err != nil {
+					c.Logger.Warn("Event Delivery Failed", "type", event.Type, "mac", event.MAC, "error", err)
+				}
+			}
+			previous = current
+		}
+
+		time.Sleep(interval)
+	}
+}
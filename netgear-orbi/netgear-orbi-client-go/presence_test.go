@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffDevices(t *testing.T) {
+	at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	speaker := Device{Name: "Kitchen Speaker", IP: "192.168.10.21", MAC: "3C:22:FB:10:20:30", ConnType: "wireless"}
+	nas := Device{Name: "NAS", IP: "192.168.10.5", MAC: "B8:27:EB:AA:BB:CC", ConnType: "wired"}
+	snapshot := func(devices ...Device) *DeviceInfo {
+		return &DeviceInfo{ConnectedDevices: devices, TotalCount: len(devices)}
+	}
+	moved := speaker
+	moved.IP = "192.168.10.99"
+	wired := speaker
+	wired.ConnType = "wired"
+	both := moved
+	both.ConnType = "wired"
+	lower := nas
+	lower.MAC = strings.ToLower(nas.MAC)
+
+	type event struct{ Type, MAC, Previous string }
+	for _, tt := range []struct {
+		name       string
+		prev, curr *DeviceInfo
+		want       []event
+	}{
+		{"no change", snapshot(speaker, nas), snapshot(nas, speaker), nil},
+		{"baseline", nil, snapshot(nas), []event{{EventJoin, "b8:27:eb:aa:bb:cc", ""}}},
+		{"join", snapshot(nas), snapshot(nas, speaker), []event{{EventJoin, "3c:22:fb:10:20:30", ""}}},
+		{"leave", snapshot(speaker, nas), snapshot(speaker), []event{{EventLeave, "b8:27:eb:aa:bb:cc", ""}}},
+		{"ip change", snapshot(speaker), snapshot(moved), []event{{EventIPChange, "3c:22:fb:10:20:30", "192.168.10.21"}}},
+		{"conn type change", snapshot(speaker), snapshot(wired), []event{{EventConnTypeChange, "3c:22:fb:10:20:30", "wireless"}}},
+		{"ip and conn type change", snapshot(speaker), snapshot(both), []event{
+			{EventIPChange, "3c:22:fb:10:20:30", "192.168.10.21"},
+			{EventConnTypeChange, "3c:22:fb:10:20:30", "wireless"},
+		}},
+		{"mac case is ignored", snapshot(nas), snapshot(lower), nil},
+		{"ordered by mac", snapshot(), snapshot(nas, speaker), []event{
+			{EventJoin, "3c:22:fb:10:20:30", ""},
+			{EventJoin, "b8:27:eb:aa:bb:cc", ""},
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []event
+			for _, e := range DiffDevices(tt.prev, tt.curr, at) {
+				if !e.Time.Equal(at) {
+					t.Errorf("event time %s, want %s", e.Time, at)
+				}
+				got = append(got, event{e.Type, e.MAC, e.Previous})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("DiffDevices = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestPresenceSinksDeliverToEverySink(t *testing.T) {
+	var received []PresenceEvent
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event PresenceEvent
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &event); err == nil {
+			received = append(received, event)
+		}
+	}))
+	t.Cleanup(webhook.Close)
+
+	sinks := &PresenceSinks{NDJSON: failingWriter{}, WebhookURL: webhook.URL, HTTPClient: webhook.Client()}
+	err := sinks.Deliver(PresenceEvent{Type: EventJoin, MAC: "3c:22:fb:10:20:30"})
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("expected the NDJSON failure to be reported, got %v", err)
+	}
+	if len(received) != 1 || received[0].MAC != "3c:22:fb:10:20:30" {
+		t.Fatalf("webhook did not receive the event after the NDJSON failure: %+v", received)
+	}
+
+	webhook.Close()
+	err = sinks.Deliver(PresenceEvent{Type: EventLeave, MAC: "3c:22:fb:10:20:30"})
+	if err == nil || !strings.Contains(err.Error(), "disk full") || !strings.Contains(err.Error(), "webhook delivery failed") {
+		t.Fatalf("expected both failures to be reported, got %v", err)
+	}
+}
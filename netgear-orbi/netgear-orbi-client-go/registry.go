@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	REGISTRY_FILE = "devices.json"
+	SEEN_FILE     = "seen.json"
+)
+
+type RegistryEntry struct {
+	Name  string   `json:"name"`
+	Owner string   `json:"owner,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// Registry is the user-maintained list of known devices, keyed by MAC.
+type Registry struct {
+	Devices map[string]RegistryEntry `json:"devices"`
+}
+
+// SeenDevices is maintained by the tool and remembers every MAC it has ever
+// listed, so that devices appearing for the first time can be flagged.
+type SeenDevices struct {
+	FirstSeen map[string]time.Time `json:"first_seen"`
+
+	path     string
+	baseline bool
+}
+
+func DefaultRegistryPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return REGISTRY_FILE
+	}
+	return filepath.Join(configDir, "netgear-orbi", REGISTRY_FILE)
+}
+
+func normalizeMAC(mac string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(mac)), "-", ":")
+}
+
+// LoadRegistry reads the registry file; a missing file is an empty registry.
+func LoadRegistry(path string) (*Registry, error) {
+	registry := &Registry{Devices: make(map[string]RegistryEntry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry: %w", err)
+	}
+
+	var loaded Registry
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("failed to parse registry %s: %w", path, err)
+	}
+	for mac, entry := range loaded.Devices {
+		registry.Devices[normalizeMAC(mac)] = entry
+	}
+
+	return registry, nil
+}
+
+func (r *Registry) Lookup(mac string) (RegistryEntry, bool) {
+	entry, ok := r.Devices[normalizeMAC(mac)]
+	return entry, ok
+}
+
+// Annotate copies friendly names, owners and tags onto every listed device.
+func (r *Registry) Annotate(info *DeviceInfo) {
+	info.each(func(device *Device) {
+		entry, ok := r.Lookup(device.MAC)
+		if !ok {
+			return
+		}
+		device.Known = true
+		device.FriendlyName = entry.Name
+		device.Owner = entry.Owner
+		device.Tags = entry.Tags
+	})
+}
+
+// FilterDevices returns a copy of info containing only devices keep accepts.
+func FilterDevices(info *DeviceInfo, keep func(Device) bool) *DeviceInfo {
+	filter := func(devices []Device) []Device {
+		var kept []Device
+		for _, device := range devices {
+			if keep(device) {
+				kept = append(kept, device)
+			}
+		}
+		return kept
+	}
+
+	filtered := &DeviceInfo{
+		ConnectedDevices: filter(info.ConnectedDevices),
+		ActiveDevices:    filter(info.ActiveDevices),
+		InactiveDevices:  filter(info.InactiveDevices),
+	}
+	filtered.TotalCount = len(filtered.ConnectedDevices)
+
+	return filtered
+}
+
+func (info *DeviceInfo) each(fn func(*Device)) {
+	for _, devices := range [][]Device{info.ConnectedDevices, info.ActiveDevices, info.InactiveDevices} {
+		for i := range devices {
+			fn(&devices[i])
+		}
+	}
+}
+
+func LoadSeenDevices(path string) (*SeenDevices, error) {
+	seen := &SeenDevices{FirstSeen: make(map[string]time.Time), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Nothing recorded yet: the first run only establishes a baseline
+		seen.baseline = true
+		return seen, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seen devices: %w", err)
+	}
+
+	if err := json.Unmarshal(data, seen); err != nil {
+		return nil, fmt.Errorf("failed to parse seen devices %s: %w", path, err)
+	}
+	if seen.FirstSeen == nil {
+		seen.FirstSeen = make(map[string]time.Time)
+	}
+
+	return seen, nil
+}
+
+// Record marks every device in info as seen and returns those that had never
+// been seen before and are not in the registry, so annotate info first.
+// Nothing is reported on the baseline run.
+func (s *SeenDevices) Record(info *DeviceInfo, now time.Time) []Device {
+	var newDevices []Device
+	for _, device := range info.ConnectedDevices {
+		mac := normalizeMAC(device.MAC)
+		if _, ok := s.FirstSeen[mac]; ok {
+			continue
+		}
+		s.FirstSeen[mac] = now
+		if !s.baseline && !device.Known {
+			newDevices = append(newDevices, device)
+		}
+	}
+	return newDevices
+}
+
+func (s *SeenDevices) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode seen devices: %w", err)
+	}
+
+	return os.WriteFile(s.path, data, 0644)
+}
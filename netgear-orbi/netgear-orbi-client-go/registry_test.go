@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRegistryAnnotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), REGISTRY_FILE)
+	if err := os.WriteFile(path, []byte(`{"devices": {
+		"3C-22-FB-10-20-30": {"name": "Kitchen Echo", "owner": "family", "tags": ["iot"]},
+		"b8:27:eb:aa:bb:cc": {"name": "Backup NAS"}
+	}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	registry, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	speaker := Device{Name: "Kitchen Speaker", MAC: "3c:22:fb:10:20:30", BackhaulSta: "Good"}
+	stranger := Device{Name: "android-1234", MAC: "02:11:22:33:44:55"}
+	info := &DeviceInfo{
+		ConnectedDevices: []Device{speaker, stranger},
+		ActiveDevices:    []Device{speaker},
+		InactiveDevices:  []Device{stranger},
+		TotalCount:       2,
+	}
+	registry.Annotate(info)
+
+	got := info.ConnectedDevices[0]
+	if !got.Known || got.DisplayName() != "Kitchen Echo" || got.Owner != "family" || !reflect.DeepEqual(got.Tags, []string{"iot"}) {
+		t.Fatalf("registry entry not applied: %+v", got)
+	}
+	if info.ActiveDevices[0].DisplayName() != "Kitchen Echo" {
+		t.Fatalf("active list not annotated: %+v", info.ActiveDevices[0])
+	}
+	if other := info.ConnectedDevices[1]; other.Known || other.DisplayName() != "android-1234" {
+		t.Fatalf("unknown device annotated: %+v", other)
+	}
+
+	empty, err := LoadRegistry(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || len(empty.Devices) != 0 {
+		t.Fatalf("missing registry should be empty, got %+v, %v", empty, err)
+	}
+}
+
+func TestSeenDevicesReportsOnlyNewUnknownDevices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", SEEN_FILE)
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	nas := Device{Name: "NAS", MAC: "B8:27:EB:AA:BB:CC"}
+
+	seen, err := LoadSeenDevices(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added := seen.Record(&DeviceInfo{ConnectedDevices: []Device{nas}}, start); len(added) != 0 {
+		t.Fatalf("baseline run reported %+v", added)
+	}
+	if err := seen.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	phone := Device{Name: "android-1234", MAC: "02:11:22:33:44:55"}
+	echo := Device{Name: "Kitchen Speaker", MAC: "3C:22:FB:10:20:30", FriendlyName: "Kitchen Echo", Known: true}
+	lowerNAS := Device{Name: "NAS", MAC: "b8-27-eb-aa-bb-cc"}
+
+	seen, err = LoadSeenDevices(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := seen.Record(&DeviceInfo{ConnectedDevices: []Device{lowerNAS, phone, echo}}, start.Add(time.Hour))
+	if len(added) != 1 || added[0].MAC != phone.MAC {
+		t.Fatalf("expected only the unregistered new device, got %+v", added)
+	}
+	if first, ok := seen.FirstSeen["3c:22:fb:10:20:30"]; !ok || !first.Equal(start.Add(time.Hour)) {
+		t.Fatalf("registered device not recorded as seen: %+v", seen.FirstSeen)
+	}
+	if err := seen.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	seen, err = LoadSeenDevices(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added := seen.Record(&DeviceInfo{ConnectedDevices: []Device{phone}}, start.Add(2*time.Hour)); len(added) != 0 {
+		t.Fatalf("device reported twice: %+v", added)
+	}
+	if !seen.FirstSeen[normalizeMAC(nas.MAC)].Equal(start) {
+		t.Fatalf("first-seen time not kept: %+v", seen.FirstSeen)
+	}
+}
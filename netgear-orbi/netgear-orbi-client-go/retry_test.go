@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"gateway-common/transport"
+	"netgear-orbi-go/mockrouter"
+)
+
+func TestRebootRetriesOnlyIdempotentRequests(t *testing.T) {
+	server := mockrouter.New(mockrouter.Config{Username: ORBI_USERNAME, Password: TEST_PASSWORD, Devices: testDevices})
+	var pageLoads, applyPosts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case REBOOT_PATH:
+			if atomic.AddInt32(&pageLoads, 1) == 1 {
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+		case APPLY_CGI_PATH:
+			// Drop the reboot request as if the reply was lost in transit
+			atomic.AddInt32(&applyPosts, 1)
+			if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+				conn.Close()
+			}
+			return
+		}
+		server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	client := NewClient(log.New(io.Discard))
+	client.BaseURL = ts.URL
+	client.Password = TEST_PASSWORD
+	policy := transport.DefaultRetryPolicy()
+	policy.BaseDelay = time.Millisecond
+	client.WrapTransport(policy.Wrap)
+
+	if err := client.RebootRouter(); err == nil {
+		t.Fatal("expected the dropped reboot request to fail")
+	}
+	if pageLoads != 2 {
+		t.Fatalf("expected the reboot page GET to be retried once, got %d loads", pageLoads)
+	}
+	if applyPosts != 1 {
+		t.Fatalf("reboot POST was sent %d times, want exactly once", applyPosts)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/robfig/cron/v3"
+)
+
+type RebootGuard struct {
+	MaxActiveDevices int      // skip when more devices than this are active; negative disables
+	BlockingMACs     []string // skip when any of these MACs is connected
+}
+
+func (g RebootGuard) Enabled() bool {
+	return g.MaxActiveDevices >= 0 || len(g.BlockingMACs) > 0
+}
+
+// Evaluate reports whether a reboot may proceed, and why.
+func (g RebootGuard) Evaluate(info *DeviceInfo) (bool, string) {
+	if !g.Enabled() {
+		return true, "no guard conditions configured"
+	}
+	if info == nil {
+		return false, "device list unavailable"
+	}
+
+	if g.MaxActiveDevices >= 0 && len(info.ActiveDevices) > g.MaxActiveDevices {
+		return false, fmt.Sprintf("%d active devices exceeds limit of %d", len(info.ActiveDevices), g.MaxActiveDevices)
+	}
+
+	for _, blocking := range g.BlockingMACs {
+		for _, device := range info.ConnectedDevices {
+			if normalizeMAC(device.MAC) == normalizeMAC(blocking) {
+				return false, fmt.Sprintf("blocking device %s (%s) is connected", device.MAC, device.Name)
+			}
+		}
+	}
+
+	return true, fmt.Sprintf("guards passed (%d active devices)", len(info.ActiveDevices))
+}
+
+// ParseMACList splits a comma or space separated list of MACs, written with
+// colons or dashes in either case, into normalized form.
+func ParseMACList(value string) []string {
+	var macs []string
+	for _, mac := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		macs = append(macs, normalizeMAC(mac))
+	}
+	return macs
+}
+
+// RunRebootSchedule blocks forever, rebooting the router at every activation
+// of the cron expression unless a guard condition says otherwise.
+func (c *Client) RunRebootSchedule(expr string, guard RebootGuard, dryRun bool) error {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+
+	for {
+		next := schedule.Next(time.Now())
+		c.Logger.Info("Next Scheduled Reboot", "at", next.Format(time.RFC3339), "schedule", expr)
+		time.Sleep(time.Until(next))
+
+		c.runScheduledReboot(guard, dryRun)
+	}
+}
+
+func (c *Client) runScheduledReboot(guard RebootGuard, dryRun bool) {
+	var info *DeviceInfo
+	if guard.Enabled() {
+		devices, err := c.GetDevices()
+		if err != nil {
+			c.Logger.Warn("Reboot Skipped", "reason", "could not check guard conditions", "error", err)
+			return
+		}
+		info = devices
+	}
+
+	proceed, reason := guard.Evaluate(info)
+	if !proceed {
+		c.Logger.Info("Reboot Skipped", "reason", reason)
+		return
+	}
+
+	if dryRun {
+		c.Logger.Info("Reboot Skipped", "reason", "dry run", "guards", reason)
+		return
+	}
+
+	c.Logger.Info("Reboot Approved", "reason", reason)
+	if err := c.RebootRouter(); err != nil {
+		c.Logger.Error("Scheduled Reboot Failed", "error", err)
+		return
+	}
+	c.Logger.Info("Scheduled Reboot Sent")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+
+	"netgear-orbi-go/mockrouter"
+)
+
+func TestParseMACList(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{" , ", nil},
+		{"3C:22:FB:10:20:30", []string{"3c:22:fb:10:20:30"}},
+		{"3c-22-fb-10-20-30, B8:27:EB:AA:BB:CC", []string{"3c:22:fb:10:20:30", "b8:27:eb:aa:bb:cc"}},
+		{"3c:22:fb:10:20:30 b8-27-eb-aa-bb-cc,,", []string{"3c:22:fb:10:20:30", "b8:27:eb:aa:bb:cc"}},
+	} {
+		if got := ParseMACList(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseMACList(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRebootGuardEvaluate(t *testing.T) {
+	client := NewClient(log.New(&bytes.Buffer{}))
+	var devices []Device
+	for _, d := range testDevices {
+		devices = append(devices, Device{Name: d.Name, IP: d.IP, MAC: d.MAC, ConnType: d.ConnType, BackhaulSta: d.BackhaulSta})
+	}
+	info := client.processDevices(devices) // one active device
+
+	for _, tt := range []struct {
+		name  string
+		guard RebootGuard
+		info  *DeviceInfo
+		want  bool
+	}{
+		{"disabled", RebootGuard{MaxActiveDevices: -1}, nil, true},
+		{"no device list", RebootGuard{MaxActiveDevices: 5}, nil, false},
+		{"below limit", RebootGuard{MaxActiveDevices: 2}, info, true},
+		{"at limit", RebootGuard{MaxActiveDevices: 1}, info, true},
+		{"over limit", RebootGuard{MaxActiveDevices: 0}, info, false},
+		{"blocking mac", RebootGuard{MaxActiveDevices: -1, BlockingMACs: ParseMACList("b8-27-eb-aa-bb-cc")}, info, false},
+		{"blocking mac uppercase", RebootGuard{MaxActiveDevices: -1, BlockingMACs: []string{"B8:27:EB:AA:BB:CC"}}, info, false},
+		{"absent mac", RebootGuard{MaxActiveDevices: -1, BlockingMACs: ParseMACList("00:11:22:33:44:55")}, info, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, reason := tt.guard.Evaluate(tt.info); got != tt.want {
+				t.Fatalf("Evaluate = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduledRebootDryRun(t *testing.T) {
+	server, client := newMockClient(t, mockrouter.Config{Devices: testDevices})
+	var logs bytes.Buffer
+	client.Logger = log.New(&logs)
+
+	client.runScheduledReboot(RebootGuard{MaxActiveDevices: 1}, true)
+	if server.Reboots() != 0 || !strings.Contains(logs.String(), "dry run") {
+		t.Fatalf("dry run rebooted or did not say so (%d reboots):\n%s", server.Reboots(), logs.String())
+	}
+
+	logs.Reset()
+	client.runScheduledReboot(RebootGuard{MaxActiveDevices: 0}, false)
+	if server.Reboots() != 0 || !strings.Contains(logs.String(), "exceeds limit") {
+		t.Fatalf("guard did not block the reboot (%d reboots):\n%s", server.Reboots(), logs.String())
+	}
+
+	client.runScheduledReboot(RebootGuard{MaxActiveDevices: 1}, false)
+	if server.Reboots() != 1 {
+		t.Fatalf("expected the approved reboot to be sent, got %d", server.Reboots())
+	}
+}
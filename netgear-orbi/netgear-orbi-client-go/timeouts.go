@@ -0,0 +1,17 @@
+package main
+
+import (
+	"net"
+	"time"
+
+	"gateway-common/transport"
+)
+
+// SetTimeouts applies per-phase deadlines to the client's transport.
+func (c *Client) SetTimeouts(t transport.Timeouts) {
+	dialer := &net.Dialer{Timeout: t.Connect, KeepAlive: 30 * time.Second}
+	c.transport.DialContext = dialer.DialContext
+	c.transport.TLSHandshakeTimeout = t.TLSHandshake
+	c.transport.ResponseHeaderTimeout = t.ResponseHeader
+	c.HTTPClient.Timeout = t.Overall
+}
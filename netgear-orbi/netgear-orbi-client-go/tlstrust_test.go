@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+
+	"gateway-common/transport"
+	"netgear-orbi-go/mockrouter"
+)
+
+func TestGetDevicesPinsCertificate(t *testing.T) {
+	server := mockrouter.New(mockrouter.Config{Username: ORBI_USERNAME, Password: TEST_PASSWORD, Devices: testDevices})
+	ts := httptest.NewTLSServer(server)
+	t.Cleanup(ts.Close)
+
+	known := &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}
+	client := NewClient(log.New(io.Discard))
+	client.BaseURL = ts.URL
+	client.Password = TEST_PASSWORD
+	client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: known})
+
+	if _, err := client.GetDevices(); err != nil {
+		t.Fatalf("first connection failed: %v", err)
+	}
+	host := strings.TrimPrefix(ts.URL, "https://")
+	if pinned, ok, _ := known.Lookup(host); !ok || pinned != transport.Fingerprint(ts.Certificate()) {
+		t.Fatalf("certificate not pinned for %s", host)
+	}
+
+	// A different certificate on the same address must be refused
+	stale := "sha256:" + strings.Repeat("ab", 32)
+	if err := os.WriteFile(known.Path, []byte(host+" "+stale+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client = NewClient(log.New(io.Discard))
+	client.BaseURL = ts.URL
+	client.Password = TEST_PASSWORD
+	client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: known})
+
+	_, err := client.GetDevices()
+	var pinErr *transport.PinMismatchError
+	if !errors.As(err, &pinErr) {
+		t.Fatalf("expected PinMismatchError, got %v", err)
+	}
+}
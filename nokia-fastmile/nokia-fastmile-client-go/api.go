@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"gateway-common/redact"
+)
+
+const (
+	API_LISTEN    = "127.0.0.1:8080"
+	API_TOKEN_ENV = "FASTMILE_API_TOKEN"
+)
+
+// openapi.json documents the REST API served by the api command.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// APIGateway describes one gateway the API serves.
+type APIGateway struct {
+	ID          string `json:"id"`
+	GatewayType string `json:"gateway_type"`
+}
+
+// APIServer exposes the configured gateways over HTTP for dashboards and
+// phone shortcuts. It keeps one session per gateway, like the daemon.
+type APIServer struct {
+	Gateways []string
+	Token    string
+	Logger   *log.Logger
+
+	sessions *Daemon
+}
+
+func NewAPIServer(gateways []string, newClient ClientFactory, token string, logger *log.Logger) *APIServer {
+	return &APIServer{
+		Gateways: gateways,
+		Token:    token,
+		Logger:   logger,
+		sessions: NewDaemon(newClient, logger),
+	}
+}
+
+// LoadAPIToken reads the bearer token from path, or from the environment
+// when no path is given. An API without a token is refused.
+func LoadAPIToken(path string) (string, error) {
+	token := os.Getenv(API_TOKEN_ENV)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read API token: %w", err)
+		}
+		token = string(data)
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("no API token; set %s or use -api-token-file", API_TOKEN_ENV)
+	}
+	redact.Register(token)
+	return token, nil
+}
+
+// Handler serves the REST API. Everything except the OpenAPI document
+// requires the bearer token.
+func (a *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /openapi.json", a.handleOpenAPI)
+	mux.Handle("GET /gateways", a.authorized(a.handleGateways))
+	mux.Handle("GET /gateways/{id}/status", a.authorized(a.handleStatus))
+	mux.Handle("GET /gateways/{id}/devices", a.authorized(a.handleDevices))
+	mux.Handle("POST /gateways/{id}/reboot", a.authorized(a.handleReboot))
+	return mux
+}
+
+// ListenAndServe runs the API on addr until ctx is cancelled, then logs out
+// of every gateway.
+func (a *APIServer) ListenAndServe(ctx context.Context, addr string) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           a.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	a.sessions.Open(a.Gateways)
+	a.Logger.Info("API Listening", "addr", addr, "gateways", strings.Join(a.Gateways, ","))
+	err := server.ListenAndServe()
+	a.sessions.Close()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (a *APIServer) authorized(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="fastmile"`)
+			writeDaemonJSON(w, http.StatusUnauthorized, daemonError{Error: "missing or invalid bearer token"})
+			return
+		}
+		next(w, r)
+	})
+}
+
+// gateway returns the {id} of the request if it is a configured gateway.
+func (a *APIServer) gateway(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if !slices.Contains(a.Gateways, id) {
+		writeDaemonJSON(w, http.StatusNotFound, daemonError{Error: fmt.Sprintf("unknown gateway %q", id)})
+		return "", false
+	}
+	return id, true
+}
+
+func (a *APIServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+func (a *APIServer) handleGateways(w http.ResponseWriter, r *http.Request) {
+	gateways := make([]APIGateway, 0, len(a.Gateways))
+	for _, id := range a.Gateways {
+		gateways = append(gateways, APIGateway{ID: id, GatewayType: a.sessions.gatewayType(id)})
+	}
+	writeDaemonJSON(w, http.StatusOK, gateways)
+}
+
+func (a *APIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.gateway(w, r)
+	if !ok {
+		return
+	}
+	resp, err := a.sessions.status(id)
+	if err != nil {
+		writeDaemonError(w, err)
+		return
+	}
+	writeDaemonJSON(w, http.StatusOK, resp)
+}
+
+func (a *APIServer) handleDevices(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.gateway(w, r)
+	if !ok {
+		return
+	}
+	resp, err := a.sessions.devices(id)
+	if err != nil {
+		writeDaemonError(w, err)
+		return
+	}
+	writeDaemonJSON(w, http.StatusOK, resp)
+}
+
+// Reboots answer 202 because the gateway only starts going down.
+func (a *APIServer) handleReboot(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.gateway(w, r)
+	if !ok {
+		return
+	}
+	if err := a.sessions.reboot(id); err != nil {
+		writeDaemonError(w, err)
+		return
+	}
+	writeDaemonJSON(w, http.StatusAccepted, map[string]string{"gateway": id, "result": "rebooting"})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/charmbracelet/log"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/transport"
+)
+
+const testAPIToken = "dashboard-token-0123"
+
+func newTestAPI(t *testing.T) (*httptest.Server, map[string]*mockgateway.Server) {
+	t.Helper()
+
+	servers := make(map[string]*mockgateway.Server)
+	urls := make(map[string]string)
+	modes := make(map[string]string)
+	var gateways []string
+	for _, cfg := range []mockgateway.Config{oduConfig(), iduConfig()} {
+		server, ts := mockgateway.NewTLSServer(cfg)
+		t.Cleanup(ts.Close)
+		address := ts.Listener.Addr().String()
+		servers[address], urls[address], modes[address] = server, ts.URL, string(cfg.Mode)
+		gateways = append(gateways, address)
+	}
+
+	known := &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}
+	api := NewAPIServer(gateways, func(address string) *Client {
+		client := newTestClient(urls[address], address, modes[address])
+		client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: known})
+		return client
+	}, testAPIToken, log.New(io.Discard))
+
+	ts := httptest.NewServer(api.Handler())
+	t.Cleanup(ts.Close)
+	return ts, servers
+}
+
+func apiRequest(t *testing.T, method, url, token string, v any) int {
+	t.Helper()
+
+	req, _ := http.NewRequest(method, url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: invalid JSON: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAPIRequiresBearerToken(t *testing.T) {
+	ts, _ := newTestAPI(t)
+
+	for _, token := range []string{"", "wrong-token"} {
+		if code := apiRequest(t, http.MethodGet, ts.URL+"/gateways", token, nil); code != http.StatusUnauthorized {
+			t.Errorf("token %q: got %d, want 401", token, code)
+		}
+	}
+
+	// The OpenAPI document is public so clients can be generated from it
+	var doc struct {
+		OpenAPI string         `json:"openapi"`
+		Paths   map[string]any `json:"paths"`
+	}
+	if code := apiRequest(t, http.MethodGet, ts.URL+"/openapi.json", "", &doc); code != http.StatusOK {
+		t.Fatalf("openapi.json: got %d", code)
+	}
+	for _, path := range []string{"/gateways", "/gateways/{id}/status", "/gateways/{id}/devices", "/gateways/{id}/reboot"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("OpenAPI document is missing %s", path)
+		}
+	}
+}
+
+func TestAPIGatewayStatusAndReboot(t *testing.T) {
+	ts, servers := newTestAPI(t)
+
+	var gateways []APIGateway
+	if code := apiRequest(t, http.MethodGet, ts.URL+"/gateways", testAPIToken, &gateways); code != http.StatusOK || len(gateways) != 2 {
+		t.Fatalf("GET /gateways: %d %+v", code, gateways)
+	}
+
+	for _, gateway := range gateways {
+		var status DaemonStatus
+		code := apiRequest(t, http.MethodGet, ts.URL+"/gateways/"+gateway.ID+"/status", testAPIToken, &status)
+		if code != http.StatusOK || status.Status == nil || status.Status.SerialNumber == "" || status.GatewayType != gateway.GatewayType {
+			t.Fatalf("GET status for %s: %d %+v", gateway.ID, code, status)
+		}
+
+		var devices DaemonDevices
+		if code := apiRequest(t, http.MethodGet, ts.URL+"/gateways/"+gateway.ID+"/devices", testAPIToken, &devices); code != http.StatusOK || len(devices.Devices) == 0 {
+			t.Fatalf("GET devices for %s: %d %+v", gateway.ID, code, devices)
+		}
+
+		if code := apiRequest(t, http.MethodPost, ts.URL+"/gateways/"+gateway.ID+"/reboot", testAPIToken, nil); code != http.StatusAccepted {
+			t.Fatalf("POST reboot for %s: got %d", gateway.ID, code)
+		}
+		if server := servers[gateway.ID]; server.Reboots() != 1 || server.Logins() != 1 {
+			t.Fatalf("%s: expected one login and one reboot, got %d and %d", gateway.ID, server.Logins(), server.Reboots())
+		}
+	}
+
+	if code := apiRequest(t, http.MethodGet, ts.URL+"/gateways/10.0.0.1/status", testAPIToken, nil); code != http.StatusNotFound {
+		t.Fatalf("unconfigured gateway: got %d, want 404", code)
+	}
+}
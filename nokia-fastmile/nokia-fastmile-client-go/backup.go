@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	BACKUP_EXTENSION   = ".cfg"
+	BACKUP_TIME_FORMAT = "20060102-150405"
+	BACKUP_MAX_SIZE    = 16 << 20
+
+	// BACKUP_EXPORT_PATH has not been checked against real firmware yet and
+	// no fixture of a real export is recorded; restoring a configuration
+	// waits until both exist. Running backup with -record against a real
+	// gateway captures that fixture with the export itself redacted.
+	BACKUP_EXPORT_PATH = "/backup_restore_web_app.cgi?export"
+)
+
+// ExportConfig downloads the gateway's configuration export from
+// BACKUP_EXPORT_PATH. It is opaque to the client and holds every setting,
+// including Wi-Fi keys and port forwards.
+func (c *Client) ExportConfig() ([]byte, error) {
+	if !c.LoggedIn {
+		return nil, fmt.Errorf("not logged in")
+	}
+
+	exportData := url.Values{"csrf_token": {c.Token}}
+	req, err := http.NewRequest("POST", c.BaseURL+BACKUP_EXPORT_PATH, strings.NewReader(exportData.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("configuration export failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("configuration export failed with status: %d: %w", resp.StatusCode, ErrSessionExpired)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("configuration export failed with status: %d", resp.StatusCode)
+	}
+	// Firmware without the export answers with a web interface page, which
+	// must not be saved as a backup
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return nil, fmt.Errorf("gateway answered %s with a web page, not a configuration export", BACKUP_EXPORT_PATH)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, BACKUP_MAX_SIZE+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration export: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("gateway returned an empty configuration export")
+	}
+	if len(data) > BACKUP_MAX_SIZE {
+		return nil, fmt.Errorf("configuration export is larger than %d bytes", BACKUP_MAX_SIZE)
+	}
+	return data, nil
+}
+
+// BackupFileName names a backup after when it was taken and the gateway it
+// came from, e.g. 20261018-040000_FastMile-5G-Receiver-5G14-B_ALCLB1234567.cfg,
+// so a directory of backups sorts by time.
+func BackupFileName(status *DeviceStatus, at time.Time) string {
+	return fmt.Sprintf("%s_%s_%s%s", at.UTC().Format(BACKUP_TIME_FORMAT),
+		fileNamePart(status.ModelName), fileNamePart(status.SerialNumber), BACKUP_EXTENSION)
+}
+
+// fileNamePart keeps letters, digits, dots and dashes and turns runs of
+// anything else into a single dash, so the part cannot name a directory.
+func fileNamePart(s string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteRune('-')
+		}
+	}
+	if part := strings.Trim(b.String(), ".-"); part != "" {
+		return part
+	}
+	return "unknown"
+}
+
+// BackupConfig saves a logged in gateway's configuration export in dir and
+// returns the path written. The file is private since it holds secrets.
+func BackupConfig(client *Client, dir string, now time.Time) (string, error) {
+	status, err := client.GetDeviceStatus()
+	if err != nil {
+		return "", err
+	}
+	data, err := client.ExportConfig()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	path := filepath.Join(dir, BackupFileName(status, now))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	return path, nil
+}
+
+func handleBackupCommand(gateways []string, newClient ClientFactory, dir string, usePrettyOutput bool, logger *log.Logger) {
+	logger.Warn("Unconfirmed Export Endpoint", "path", BACKUP_EXPORT_PATH, "hint", "add -record DIR to capture a redacted fixture that confirms it")
+
+	failed := 0
+	for _, gatewayIP := range gateways {
+		client := newClient(gatewayIP)
+		if err := client.LoginWithProgress(usePrettyOutput, logger); err != nil {
+			logger.Error("Authentication Failed", "gateway-type", client.GatewayType, "ip", gatewayIP, "error", err)
+			failed++
+			continue
+		}
+
+		path, err := BackupConfig(client, dir, time.Now())
+		client.Logout()
+		if err != nil {
+			logger.Error("Backup Failed", "gateway-type", client.GatewayType, "ip", gatewayIP, "error", err)
+			failed++
+			continue
+		}
+
+		if usePrettyOutput {
+			fmt.Printf("%s\n", RenderSuccessLipgloss(fmt.Sprintf("%s configuration saved to %s", client.GatewayType, path)))
+		} else {
+			logger.Info("Configuration Backed Up", "gateway-type", client.GatewayType, "ip", gatewayIP, "file", path)
+		}
+	}
+	if failed > 0 {
+		logger.Fatal("Backup Incomplete", "failed", failed, "gateways", len(gateways))
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/transport"
+)
+
+func TestBackupFileName(t *testing.T) {
+	status := &DeviceStatus{ModelName: "FastMile 5G Receiver 5G14-B", SerialNumber: "ALCLB1234567"}
+	at := time.Date(2026, 10, 18, 4, 0, 0, 0, time.UTC)
+
+	name := BackupFileName(status, at)
+	if name != "20261018-040000_FastMile-5G-Receiver-5G14-B_ALCLB1234567.cfg" {
+		t.Fatalf("unexpected name %q", name)
+	}
+	if name := BackupFileName(&DeviceStatus{ModelName: "../x/_y"}, at); name != "20261018-040000_x-y_unknown.cfg" {
+		t.Fatalf("unsafe name %q", name)
+	}
+}
+
+func TestBackupConfig(t *testing.T) {
+	_, ts := mockgateway.NewTLSServer(oduConfig())
+	t.Cleanup(ts.Close)
+	client := newTestClient(ts.URL, ts.Listener.Addr().String(), string(mockgateway.ModeODU))
+	client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}})
+	if err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Logout()
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	path, err := BackupConfig(client, dir, time.Date(2026, 10, 18, 4, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(path) != "20261018-040000_FastMile-5G-Receiver-5G14-B_ALCLB1234567.cfg" {
+		t.Fatalf("unexpected backup name %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !bytes.Equal(data, mockgateway.DefaultBackup()) {
+		t.Fatalf("backup content %q, err %v", data, err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Fatalf("backup is readable by others: %v", info.Mode())
+	}
+}
+
+func TestExportConfigRejectsWebPage(t *testing.T) {
+	server := mockgateway.New(oduConfig())
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Firmware without the export serves its login page instead
+		if r.URL.Path == "/backup_restore_web_app.cgi" {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><head><title>Nokia WebGUI</title></head></html>"))
+			return
+		}
+		server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	client := newTestClient(ts.URL, "127.0.0.1", string(mockgateway.ModeODU))
+	client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}})
+	if err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Logout()
+
+	if data, err := client.ExportConfig(); err == nil {
+		t.Fatalf("web page saved as a backup: %q", data)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Nagios plugin exit codes
+const (
+	CHECK_OK       = 0
+	CHECK_WARNING  = 1
+	CHECK_CRITICAL = 2
+	CHECK_UNKNOWN  = 3
+
+	CHECK_WARNING_CPU     = 80
+	CHECK_CRITICAL_CPU    = 95
+	CHECK_WARNING_MEMORY  = 85
+	CHECK_CRITICAL_MEMORY = 95
+)
+
+var checkStateNames = map[int]string{
+	CHECK_OK:       "OK",
+	CHECK_WARNING:  "WARNING",
+	CHECK_CRITICAL: "CRITICAL",
+	CHECK_UNKNOWN:  "UNKNOWN",
+}
+
+// checkSeverity orders states for aggregation; UNKNOWN ranks between
+// WARNING and CRITICAL as in Nagios service dependencies.
+var checkSeverity = map[int]int{CHECK_OK: 0, CHECK_WARNING: 1, CHECK_UNKNOWN: 2, CHECK_CRITICAL: 3}
+
+// CheckThresholds are the limits the check command alerts on. CPU and
+// memory are percentages alerted on above the limit, uptime is alerted on
+// below it. Zero disables a limit.
+type CheckThresholds struct {
+	WarningCPU     float64
+	CriticalCPU    float64
+	WarningMemory  float64
+	CriticalMemory float64
+	WarningUptime  time.Duration
+	CriticalUptime time.Duration
+}
+
+func (t CheckThresholds) Validate() error {
+	if t.WarningCPU < 0 || t.CriticalCPU < 0 || t.WarningMemory < 0 || t.CriticalMemory < 0 || t.WarningUptime < 0 || t.CriticalUptime < 0 {
+		return fmt.Errorf("thresholds must not be negative")
+	}
+	if t.WarningCPU > 0 && t.CriticalCPU > 0 && t.WarningCPU > t.CriticalCPU {
+		return fmt.Errorf("CPU warning threshold %.0f%% is above the critical threshold %.0f%%", t.WarningCPU, t.CriticalCPU)
+	}
+	if t.WarningMemory > 0 && t.CriticalMemory > 0 && t.WarningMemory > t.CriticalMemory {
+		return fmt.Errorf("memory warning threshold %.0f%% is above the critical threshold %.0f%%", t.WarningMemory, t.CriticalMemory)
+	}
+	if t.WarningUptime > 0 && t.CriticalUptime > 0 && t.WarningUptime < t.CriticalUptime {
+		return fmt.Errorf("uptime warning minimum %s is below the critical minimum %s", t.WarningUptime, t.CriticalUptime)
+	}
+	return nil
+}
+
+// CheckResult accumulates the worst state, a message per problem or
+// gateway, and Nagios perfdata.
+type CheckResult struct {
+	State    int
+	Messages []string
+	Perfdata []string
+}
+
+func (r *CheckResult) raise(state int) {
+	if checkSeverity[state] > checkSeverity[r.State] {
+		r.State = state
+	}
+}
+
+// String is the plugin's single output line:
+// FASTMILE STATE - message; message | perfdata
+func (r *CheckResult) String() string {
+	// A "|" in a message would be taken as the start of the perfdata
+	message := strings.ReplaceAll(strings.Join(r.Messages, "; "), "|", "/")
+	line := fmt.Sprintf("FASTMILE %s - %s", checkStateNames[r.State], message)
+	if len(r.Perfdata) > 0 {
+		line += " | " + strings.Join(r.Perfdata, " ")
+	}
+	return line
+}
+
+// perfdata formats one value as 'label'=value[uom];warn;crit;min;max.
+func perfdata(label string, value float64, uom, warn, crit, min, max string) string {
+	return fmt.Sprintf("'%s'=%s%s;%s;%s;%s;%s", label, strconv.FormatFloat(value, 'f', -1, 64), uom, warn, crit, min, max)
+}
+
+// upperLimit renders an alert-above threshold as a Nagios range, empty when
+// disabled.
+func upperLimit(limit float64) string {
+	if limit <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(limit, 'f', -1, 64)
+}
+
+// lowerLimit renders an alert-below threshold as a Nagios range ("n:").
+func lowerLimit(limit float64) string {
+	if limit <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(limit, 'f', -1, 64) + ":"
+}
+
+// EvaluateStatus checks one gateway's status against the thresholds.
+func EvaluateStatus(result *CheckResult, gatewayType, gatewayIP string, status *DeviceStatus, t CheckThresholds) {
+	prefix := strings.ToLower(gatewayType)
+	var problems []string
+
+	cpu := float64(status.CPUUsageInfo.CPUUsage)
+	switch {
+	case t.CriticalCPU > 0 && cpu > t.CriticalCPU:
+		result.raise(CHECK_CRITICAL)
+		problems = append(problems, fmt.Sprintf("CPU %.0f%% > %.0f%%", cpu, t.CriticalCPU))
+	case t.WarningCPU > 0 && cpu > t.WarningCPU:
+		result.raise(CHECK_WARNING)
+		problems = append(problems, fmt.Sprintf("CPU %.0f%% > %.0f%%", cpu, t.WarningCPU))
+	}
+	result.Perfdata = append(result.Perfdata, perfdata(prefix+"_cpu", cpu, "%", upperLimit(t.WarningCPU), upperLimit(t.CriticalCPU), "0", "100"))
+
+	if status.MemInfo.Total > 0 {
+		memory := FormatMemory(status.MemInfo.Total, status.MemInfo.Free)
+		used := math.Round(memory.UsedPercent*10) / 10
+		switch {
+		case t.CriticalMemory > 0 && used > t.CriticalMemory:
+			result.raise(CHECK_CRITICAL)
+			problems = append(problems, fmt.Sprintf("memory %.0f%% > %.0f%%", used, t.CriticalMemory))
+		case t.WarningMemory > 0 && used > t.WarningMemory:
+			result.raise(CHECK_WARNING)
+			problems = append(problems, fmt.Sprintf("memory %.0f%% > %.0f%%", used, t.WarningMemory))
+		}
+		result.Perfdata = append(result.Perfdata, perfdata(prefix+"_memory", used, "%", upperLimit(t.WarningMemory), upperLimit(t.CriticalMemory), "0", "100"))
+	}
+
+	uptime := time.Duration(status.UpTime) * time.Second
+	switch {
+	case t.CriticalUptime > 0 && uptime < t.CriticalUptime:
+		result.raise(CHECK_CRITICAL)
+		problems = append(problems, fmt.Sprintf("up only %s", FormatUptime(status.UpTime)))
+	case t.WarningUptime > 0 && uptime < t.WarningUptime:
+		result.raise(CHECK_WARNING)
+		problems = append(problems, fmt.Sprintf("up only %s", FormatUptime(status.UpTime)))
+	}
+	result.Perfdata = append(result.Perfdata, perfdata(prefix+"_uptime", float64(status.UpTime), "s",
+		lowerLimit(t.WarningUptime.Seconds()), lowerLimit(t.CriticalUptime.Seconds()), "0", ""))
+
+	message := fmt.Sprintf("%s %s up %s, CPU %.0f%%", gatewayType, gatewayIP, FormatUptime(status.UpTime), cpu)
+	if len(problems) > 0 {
+		message = fmt.Sprintf("%s %s %s", gatewayType, gatewayIP, strings.Join(problems, ", "))
+	}
+	result.Messages = append(result.Messages, message)
+}
+
+// RunCheck logs in to every gateway and evaluates its status. A gateway
+// that cannot be logged in to or queried is CRITICAL.
+func RunCheck(gateways []string, newClient ClientFactory, t CheckThresholds) *CheckResult {
+	result := &CheckResult{State: CHECK_OK}
+
+	for _, gatewayIP := range gateways {
+		client := newClient(gatewayIP)
+		if err := client.Login(); err != nil {
+			result.raise(CHECK_CRITICAL)
+			result.Messages = append(result.Messages, fmt.Sprintf("%s %s login failed: %s", client.GatewayType, gatewayIP, err))
+			continue
+		}
+
+		status, err := client.GetDeviceStatus()
+		client.Logout()
+		if err != nil {
+			result.raise(CHECK_CRITICAL)
+			result.Messages = append(result.Messages, fmt.Sprintf("%s %s status unavailable: %s", client.GatewayType, gatewayIP, err))
+			continue
+		}
+		EvaluateStatus(result, client.GatewayType, gatewayIP, status, t)
+
+		// A firmware change is news, not a problem; an unwritable history
+		// must not fail the check either
+		if change := status.FirmwareChange; change != nil {
+			result.Messages = append(result.Messages, fmt.Sprintf("%s %s firmware changed from %s to %s", client.GatewayType, gatewayIP, change.From, change.To))
+		}
+	}
+	return result
+}
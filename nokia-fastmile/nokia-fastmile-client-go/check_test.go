@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/transport"
+)
+
+func defaultThresholds() CheckThresholds {
+	return CheckThresholds{
+		WarningCPU:     CHECK_WARNING_CPU,
+		CriticalCPU:    CHECK_CRITICAL_CPU,
+		WarningMemory:  CHECK_WARNING_MEMORY,
+		CriticalMemory: CHECK_CRITICAL_MEMORY,
+	}
+}
+
+func TestEvaluateStatusThresholds(t *testing.T) {
+	var status DeviceStatus
+	if err := json.Unmarshal([]byte(mockgateway.DefaultStatus(mockgateway.ModeODU)), &status); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		adjust func(*CheckThresholds)
+		want   int
+		output string
+	}{
+		{"defaults", func(*CheckThresholds) {}, CHECK_OK,
+			"FASTMILE OK - ODU 192.168.0.1 up 3d 4h 4m, CPU 17% | 'odu_cpu'=17%;80;95;0;100 'odu_memory'=63%;85;95;0;100 'odu_uptime'=273845s;;;0;"},
+		{"cpu warning", func(th *CheckThresholds) { th.WarningCPU = 10 }, CHECK_WARNING, "CPU 17% > 10%"},
+		{"memory critical", func(th *CheckThresholds) { th.WarningCPU = 10; th.CriticalMemory = 60 }, CHECK_CRITICAL, "CPU 17% > 10%, memory 63% > 60%"},
+		{"recent reboot", func(th *CheckThresholds) { th.WarningUptime = 100 * time.Hour }, CHECK_WARNING, "'odu_uptime'=273845s;360000:;;0;"},
+		{"disabled limits", func(th *CheckThresholds) { *th = CheckThresholds{} }, CHECK_OK, "'odu_cpu'=17%;;;0;100"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			thresholds := defaultThresholds()
+			tt.adjust(&thresholds)
+
+			result := &CheckResult{}
+			EvaluateStatus(result, "ODU", "192.168.0.1", &status, thresholds)
+			if result.State != tt.want || !strings.Contains(result.String(), tt.output) {
+				t.Fatalf("got state %d, %q; want state %d containing %q", result.State, result.String(), tt.want, tt.output)
+			}
+		})
+	}
+
+	invalid := defaultThresholds()
+	invalid.WarningCPU = 99
+	if invalid.Validate() == nil {
+		t.Fatal("expected a warning threshold above the critical one to be rejected")
+	}
+}
+
+func TestRunCheckUnreachableGatewayIsCritical(t *testing.T) {
+	_, up := mockgateway.NewTLSServer(oduConfig())
+	t.Cleanup(up.Close)
+	_, gone := mockgateway.NewTLSServer(iduConfig())
+	gone.Close()
+
+	urls := map[string]string{
+		up.Listener.Addr().String():   up.URL,
+		gone.Listener.Addr().String(): gone.URL,
+	}
+	modes := map[string]string{
+		up.Listener.Addr().String():   string(mockgateway.ModeODU),
+		gone.Listener.Addr().String(): string(mockgateway.ModeIDU),
+	}
+	known := &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}
+	gatewayClient := func(address string) *Client {
+		client := newTestClient(urls[address], address, modes[address])
+		client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: known})
+		client.SetTimeouts(transport.Timeouts{Connect: time.Second, Overall: 2 * time.Second})
+		return client
+	}
+
+	result := RunCheck([]string{up.Listener.Addr().String()}, gatewayClient, defaultThresholds())
+	if result.State != CHECK_OK {
+		t.Fatalf("healthy gateway: %s", result)
+	}
+
+	result = RunCheck([]string{up.Listener.Addr().String(), gone.Listener.Addr().String()}, gatewayClient, defaultThresholds())
+	line := result.String()
+	if result.State != CHECK_CRITICAL || !strings.HasPrefix(line, "FASTMILE CRITICAL - ") || !strings.Contains(line, "IDU "+gone.Listener.Addr().String()+" login failed") {
+		t.Fatalf("unreachable gateway: %s", line)
+	}
+	if strings.Count(line, "|") != 1 || strings.Contains(line, "\n") {
+		t.Fatalf("output is not a single plugin line: %q", line)
+	}
+}
@@ -1,36 +1,43 @@
 package main
 
 import (
-	"crypto/rand"
-	"crypto/sha256"
-	"crypto/tls"
-	"encoding/base64"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
-	"regexp"
+	"net/url"
 	"strings"
-	"time"
 
 	"github.com/charmbracelet/log"
+
+	"fastmile-go/lenientjson"
+	"fastmile-go/oduauth"
+	"gateway-common/redact"
+	"gateway-common/transport"
 )
 
 // Gateway Configuration Constants
 const (
 	ODU_GATEWAY_IP = "192.168.0.1"
 	ODU_USERNAME   = "admin"
-	ODU_PASSWORD   = "ANKODACF00005930"
 
 	IDU_GATEWAY_IP = "192.168.1.1"
 	IDU_USERNAME   = "admin"
-	IDU_PASSWORD   = "Pass@Airtel-123"
 
-	// IDU Browser-captured encrypted payload
-	IDU_BROWSER_PAYLOAD = "encrypted=1&ct=DiVgETIqDqEOAr6WsF4-kX2yYqyEp1KnZxC5j5__HGCAztvljLzKvNQwuPI25mqrteWc7D63ivOBANHyD6SveoIQc9-9wjfaEhTZzVd-rJlbhE-O5V9kpXdRavvHhBbReCZLmk2wlOPFshOO85dBhPmmi0B0N3maAa6bF9GS-rNRByE4-QP4CODsKa9lEaQ7qmy3aLq43mAtP3hELrulRxnkKbGC0Yk-9VSIftRe0Uw3zyFhyYjNIJnCT3CjsJTH-gSVlxvHwJukztsE0XwfBQ&ck=fewEnnPAQ2ApoDmGZKGuy9mVhU7jozMgIdf3FAfsjjClcqlsOwDJgPp1iR4It-R4tmZOu_OmgKl4Vg1OpK6jgOFMZ-Mh0HDMnb4fL8uOO-rQolJG2tNeYKZvluYj9KM7-rzpz1mKHKaQ9GPS37avrkBNxiYDZityySUR66CBT9Q."
+	// Directory under the user config directory for this tool's files
+	CONFIG_DIR = "fastmile"
+
+	// Tag for syslog and journald records
+	LOG_IDENTIFIER = "fastmile-go"
 )
 
+// ErrSessionExpired is returned when the gateway no longer accepts the
+// session, e.g. after another login cleared it.
+var ErrSessionExpired = errors.New("session expired")
+
 type Client struct {
 	BaseURL     string
 	GatewayIP   string
@@ -39,6 +46,28 @@ type Client struct {
 	Token       string
 	SID         string
 	LoggedIn    bool
+
+	// Username defaults to the gateway type's; the password (ODU) or
+	// browser payload (IDU) has no default and comes from ResolveCredentials.
+	Username       string
+	Password       string
+	BrowserPayload string
+
+	// Sessions, if set, carries the gateway session over to later runs:
+	// Login reuses a cached session that still works and Logout leaves it
+	// open on the gateway.
+	Sessions *SessionCache
+
+	// Daemon, if set, serves status, devices and reboots from the session
+	// a running daemon holds, and Login and Logout leave that session alone.
+	Daemon *DaemonClient
+
+	// Firmware, if set, is where GetDeviceStatus records the firmware
+	// version the gateway reports. Through a daemon the daemon records it
+	// and passes any change back in the status.
+	Firmware *FirmwareHistory
+
+	transport *http.Transport
 }
 
 type LoginResponse struct {
@@ -70,6 +99,33 @@ type DeviceStatus struct {
 		Total int `json:"Total"`
 		Free  int `json:"Free"`
 	} `json:"mem_info"`
+	Devices []LANDevice `json:"device_cfg"`
+
+	// Set from the client's firmware history, not by the gateway: the
+	// change this status revealed, or why it could not be recorded
+	FirmwareChange *FirmwareChange `json:"firmware_change,omitempty"`
+	FirmwareError  string          `json:"firmware_error,omitempty"`
+}
+
+type LANDevice struct {
+	HostName      string   `json:"HostName"`
+	MACAddress    string   `json:"MACAddress"`
+	IPAddress     string   `json:"IPAddress"`
+	InterfaceType string   `json:"InterfaceType"`
+	Active        flexBool `json:"Active"`
+}
+
+// flexBool accepts the gateway's mix of true/false, 1/0 and "1"/"0" values.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(strings.ToLower(string(data)), `"`) {
+	case "true", "1":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
 }
 
 func NewClient(gatewayIP string, useHTTPS bool) *Client {
@@ -78,38 +134,82 @@ func NewClient(gatewayIP string, useHTTPS bool) *Client {
 		protocol = "https"
 	}
 
-	tr := &http.Transport{}
-	if useHTTPS {
-		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	// Gateways listen on 443 for both schemes; an explicit host:port wins
+	host := gatewayIP
+	if _, _, err := net.SplitHostPort(gatewayIP); err != nil {
+		host = net.JoinHostPort(gatewayIP, "443")
+	}
+	baseURL := fmt.Sprintf("%s://%s", protocol, host)
+
+	gatewayType := "IDU"
+	if gatewayIP == ODU_GATEWAY_IP {
+		gatewayType = "ODU"
+	}
+
+	c := newClient(baseURL, gatewayIP, gatewayType, useHTTPS)
+	c.SetTLSPolicy(transport.DefaultTLSPolicy(CONFIG_DIR))
+	return c
+}
+
+// ClientFactory builds a configured client for a gateway address.
+type ClientFactory func(gatewayIP string) *Client
+
+// NewClientWithType is NewClient with the gateway type forced, for gateways
+// that are not at their default addresses.
+func NewClientWithType(gatewayIP, gatewayType string, useHTTPS bool) *Client {
+	c := NewClient(gatewayIP, useHTTPS)
+	if gatewayType != "" {
+		c.GatewayType = strings.ToUpper(gatewayType)
+		c.setDefaultCredentials()
 	}
+	return c
+}
+
+func newClient(baseURL, gatewayIP, gatewayType string, useHTTPS bool) *Client {
+	tr := &http.Transport{}
 
 	jar, _ := cookiejar.New(nil)
 
 	client := &http.Client{
 		Transport: tr,
-		Timeout:   30 * time.Second,
 		Jar:       jar,
 	}
 
-	baseURL := fmt.Sprintf("%s://%s:443", protocol, gatewayIP)
-
-	gatewayType := "IDU"
-	if gatewayIP == ODU_GATEWAY_IP {
-		gatewayType = "ODU"
-	}
-
 	c := &Client{
 		BaseURL:     baseURL,
 		GatewayIP:   gatewayIP,
 		GatewayType: gatewayType,
 		HTTPClient:  client,
+		transport:   tr,
 	}
 
+	c.SetTimeouts(transport.DefaultTimeouts())
 	c.setDefaultHeaders()
+	c.setDefaultCredentials()
 
 	return c
 }
 
+func (c *Client) setDefaultCredentials() {
+	if c.GatewayType == "ODU" {
+		c.Username = ODU_USERNAME
+		return
+	}
+	c.Username = IDU_USERNAME
+}
+
+// missingSecret returns ErrNoPassword when the client lacks what its gateway
+// type logs in with.
+func (c *Client) missingSecret() error {
+	if c.GatewayType == "ODU" && c.Password == "" {
+		return fmt.Errorf("%w for %s; run -cmd credentials set -gateway %s or set $%s", ErrNoPassword, c.GatewayIP, c.GatewayIP, PASSWORD_ENV)
+	}
+	if c.GatewayType != "ODU" && c.BrowserPayload == "" {
+		return fmt.Errorf("%w for %s; run -cmd credentials set -gateway %s or set $%s", ErrNoPassword, c.GatewayIP, c.GatewayIP, BROWSER_PAYLOAD_ENV)
+	}
+	return nil
+}
+
 func (c *Client) setDefaultHeaders() {
 	existingTransport := c.HTTPClient.Transport
 	if existingTransport == nil {
@@ -129,6 +229,26 @@ func (c *Client) setDefaultHeaders() {
 	}
 }
 
+// SetTLSPolicy replaces how the gateway's certificate is verified. Clients
+// built by newClient verify against the system roots until this is called.
+func (c *Client) SetTLSPolicy(policy *transport.TLSPolicy) {
+	host := c.BaseURL
+	if u, err := url.Parse(c.BaseURL); err == nil {
+		host = u.Host
+	}
+	c.transport.TLSClientConfig = policy.Config(host)
+}
+
+// WrapTransport inserts a transport between the default headers and the
+// network, e.g. to record or replay traffic.
+func (c *Client) WrapTransport(wrap func(http.RoundTripper) http.RoundTripper) {
+	if ht, ok := c.HTTPClient.Transport.(*headerTransport); ok {
+		ht.RoundTripper = wrap(ht.RoundTripper)
+		return
+	}
+	c.HTTPClient.Transport = wrap(c.HTTPClient.Transport)
+}
+
 type headerTransport struct {
 	http.RoundTripper
 	headers map[string]string
@@ -143,29 +263,16 @@ func (ht *headerTransport) RoundTrip(req *http.Request) (*http.Response, error)
 	return ht.RoundTripper.RoundTrip(req)
 }
 
-// Cryptographic helper functions for ODU authentication
-func base64URLEscape(b64 string) string {
-	return strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(b64, "=", "."), "/", "_"), "+", "-")
-}
-
-func sha256Hash(val1, val2 string) string {
-	h := sha256.Sum256([]byte(val1 + ":" + val2))
-	return base64.StdEncoding.EncodeToString(h[:])
-}
-
-func sha256Single(val string) string {
-	h := sha256.Sum256([]byte(val))
-	return fmt.Sprintf("%x", h)
-}
-
-func sha256URL(val1, val2 string) string {
-	return base64URLEscape(sha256Hash(val1, val2))
-}
-
-func randomWords(numWords int) string {
-	bytes := make([]byte, numWords*4)
-	rand.Read(bytes)
-	return base64.StdEncoding.EncodeToString(bytes)
+// preview shortens a nonce or salt for progress output, or masks it unless
+// secrets are shown.
+func preview(value string) string {
+	if !redact.ShowSecrets() {
+		return redact.Mask(value)
+	}
+	if len(value) > 20 {
+		return value[:20] + "..."
+	}
+	return value
 }
 
 func (c *Client) InitializeSession() error {
@@ -187,10 +294,48 @@ func (c *Client) Login() error {
 }
 
 func (c *Client) LoginWithProgress(showProgress bool, logger *log.Logger) error {
+	if c.Daemon != nil {
+		if showProgress {
+			fmt.Printf("  \033[92m✓\033[0m Using Daemon Session\n")
+		} else if logger != nil {
+			logger.Info("Using Daemon Session", "gateway", c.GatewayIP, "socket", c.Daemon.SocketPath)
+		}
+		c.LoggedIn = true
+		return nil
+	}
+
+	if c.Sessions != nil {
+		resumed, err := c.resumeSession()
+		if err != nil && logger != nil {
+			logger.Warn("Cached Session Unusable", "gateway", c.GatewayIP, "error", err)
+		}
+		if resumed {
+			if showProgress {
+				fmt.Printf("  \033[92m✓\033[0m Reusing Cached Session\n")
+			} else if logger != nil {
+				logger.Info("Reusing Cached Session", "gateway", c.GatewayIP)
+			}
+			return nil
+		}
+	}
+
+	if err := c.missingSecret(); err != nil {
+		return err
+	}
+
+	var err error
 	if c.GatewayType == "ODU" {
-		return c.LoginODUWithProgress(showProgress, logger)
+		err = c.LoginODUWithProgress(showProgress, logger)
+	} else {
+		err = c.LoginIDUWithProgress(showProgress, logger)
 	}
-	return c.LoginIDUWithProgress(showProgress, logger)
+
+	if err == nil && c.Sessions != nil {
+		if saveErr := c.saveSession(); saveErr != nil && logger != nil {
+			logger.Warn("Failed To Cache Session", "gateway", c.GatewayIP, "error", saveErr)
+		}
+	}
+	return err
 }
 
 func (c *Client) LoginODU() error {
@@ -202,8 +347,9 @@ func (c *Client) LoginIDU() error {
 }
 
 func (c *Client) LoginODUWithProgress(showProgress bool, logger *log.Logger) error {
-	username := ODU_USERNAME
-	password := ODU_PASSWORD
+	username := c.Username
+	password := c.Password
+	redact.Register(password)
 
 	if showProgress {
 		fmt.Printf("  \033[94mStep 1:\033[0m Initializing Session...\n")
@@ -239,13 +385,15 @@ func (c *Client) LoginODUWithProgress(showProgress bool, logger *log.Logger) err
 	defer resp.Body.Close()
 
 	var nonceResp NonceResponse
-	if err := json.NewDecoder(resp.Body).Decode(&nonceResp); err != nil {
+	if err := decodeJSON(resp.Body, &nonceResp); err != nil {
 		return fmt.Errorf("invalid nonce response: %w", err)
 	}
+	redact.Register(nonceResp.Nonce)
+	redact.Register(nonceResp.RandomKey)
 	if showProgress {
-		fmt.Printf("  \033[92m✓\033[0m Nonce: \033[96m%s...\033[0m\n", nonceResp.Nonce[:20])
+		fmt.Printf("  \033[92m✓\033[0m Nonce: \033[96m%s\033[0m\n", preview(nonceResp.Nonce))
 	} else if logger != nil {
-		logger.Info("Nonce Received", "preview", nonceResp.Nonce[:20]+"...")
+		logger.Info("Nonce Received", "preview", preview(nonceResp.Nonce))
 	}
 
 	// Get salt
@@ -254,10 +402,13 @@ func (c *Client) LoginODUWithProgress(showProgress bool, logger *log.Logger) err
 	} else if logger != nil {
 		logger.Info("Getting Salt", "step", "4")
 	}
-	userhash := sha256URL(username, nonceResp.Nonce)
-	saltData := fmt.Sprintf("userhash=%s&nonce=%s", userhash, base64URLEscape(nonceResp.Nonce))
+	userhash := oduauth.UserHash(username, nonceResp.Nonce)
+	saltData := fmt.Sprintf("userhash=%s&nonce=%s", userhash, oduauth.EscapeBase64URL(nonceResp.Nonce))
 
-	req, err := http.NewRequest("POST", c.BaseURL+"/login_web_app.cgi?salt", strings.NewReader(saltData))
+	// Asking for the salt again changes nothing on the gateway, so the
+	// retry policy may resend it
+	ctx := transport.WithIdempotent(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/login_web_app.cgi?salt", strings.NewReader(saltData))
 	if err != nil {
 		return fmt.Errorf("failed to create salt request: %w", err)
 	}
@@ -270,21 +421,14 @@ func (c *Client) LoginODUWithProgress(showProgress bool, logger *log.Logger) err
 	defer resp.Body.Close()
 
 	var saltResp SaltResponse
-	if err := json.NewDecoder(resp.Body).Decode(&saltResp); err != nil {
+	if err := decodeJSON(resp.Body, &saltResp); err != nil {
 		return fmt.Errorf("invalid salt response: %w", err)
 	}
+	redact.Register(saltResp.Alati)
 	if showProgress {
-		saltPreview := saltResp.Alati
-		if len(saltPreview) > 20 {
-			saltPreview = saltPreview[:20] + "..."
-		}
-		fmt.Printf("  \033[92m✓\033[0m Salt: \033[96m%s\033[0m\n", saltPreview)
+		fmt.Printf("  \033[92m✓\033[0m Salt: \033[96m%s\033[0m\n", preview(saltResp.Alati))
 	} else if logger != nil {
-		saltPreview := saltResp.Alati
-		if len(saltPreview) > 20 {
-			saltPreview = saltPreview[:20] + "..."
-		}
-		logger.Info("Salt Received", "preview", saltPreview)
+		logger.Info("Salt Received", "preview", preview(saltResp.Alati))
 	}
 
 	// Process password
@@ -293,17 +437,11 @@ func (c *Client) LoginODUWithProgress(showProgress bool, logger *log.Logger) err
 	} else if logger != nil {
 		logger.Info("Processing Authentication", "step", "5")
 	}
-	passHash := saltResp.Alati + password
-	if nonceResp.Iterations >= 1 {
-		passHash = sha256Single(passHash)
-	}
-
 	// Generate authentication response
-	loginHash := sha256Hash(username, strings.ToLower(passHash))
-	response := sha256URL(loginHash, nonceResp.Nonce)
-	randomKeyHash := sha256URL(nonceResp.RandomKey, nonceResp.Nonce)
-	enckey := randomWords(4)
-	enciv := randomWords(4)
+	response := oduauth.Response(username, password, saltResp.Alati, nonceResp.Nonce, nonceResp.Iterations)
+	randomKeyHash := oduauth.RandomKeyHash(nonceResp.RandomKey, nonceResp.Nonce)
+	enckey := oduauth.RandomWords(4)
+	enciv := oduauth.RandomWords(4)
 
 	// Submit authentication
 	if showProgress {
@@ -312,8 +450,8 @@ func (c *Client) LoginODUWithProgress(showProgress bool, logger *log.Logger) err
 		logger.Info("Submitting Authentication", "step", "6")
 	}
 	authData := fmt.Sprintf("userhash=%s&RandomKeyhash=%s&response=%s&nonce=%s&enckey=%s&enciv=%s",
-		userhash, randomKeyHash, response, base64URLEscape(nonceResp.Nonce),
-		base64URLEscape(enckey), base64URLEscape(enciv))
+		userhash, randomKeyHash, response, oduauth.EscapeBase64URL(nonceResp.Nonce),
+		oduauth.EscapeBase64URL(enckey), oduauth.EscapeBase64URL(enciv))
 
 	req, err = http.NewRequest("POST", c.BaseURL+"/login_web_app.cgi", strings.NewReader(authData))
 	if err != nil {
@@ -328,7 +466,7 @@ func (c *Client) LoginODUWithProgress(showProgress bool, logger *log.Logger) err
 	defer resp.Body.Close()
 
 	var loginResp LoginResponse
-	if err := json.NewDecoder(resp.Body).Decode(&loginResp); err != nil {
+	if err := decodeJSON(resp.Body, &loginResp); err != nil {
 		return fmt.Errorf("invalid login response: %w", err)
 	}
 
@@ -338,6 +476,8 @@ func (c *Client) LoginODUWithProgress(showProgress bool, logger *log.Logger) err
 
 	c.Token = loginResp.Token
 	c.SID = loginResp.SID
+	redact.Register(c.Token)
+	redact.Register(c.SID)
 	c.LoggedIn = true
 
 	return nil
@@ -371,7 +511,8 @@ func (c *Client) LoginIDUWithProgress(showProgress bool, logger *log.Logger) err
 		logger.Info("Processing Authentication", "step", "3")
 	}
 	// Browser-captured encrypted payload for IDU
-	browserPayload := IDU_BROWSER_PAYLOAD
+	browserPayload := c.BrowserPayload
+	redact.Register(browserPayload)
 
 	if showProgress {
 		fmt.Printf("  \033[94mStep 4:\033[0m Submitting Authentication...\n")
@@ -400,7 +541,7 @@ func (c *Client) LoginIDUWithProgress(showProgress bool, logger *log.Logger) err
 	}
 
 	var loginResp LoginResponse
-	if err := json.NewDecoder(resp.Body).Decode(&loginResp); err != nil {
+	if err := decodeJSON(resp.Body, &loginResp); err != nil {
 		return fmt.Errorf("invalid JSON response: %w", err)
 	}
 
@@ -410,6 +551,8 @@ func (c *Client) LoginIDUWithProgress(showProgress bool, logger *log.Logger) err
 
 	c.Token = loginResp.Token
 	c.SID = loginResp.SID
+	redact.Register(c.Token)
+	redact.Register(c.SID)
 	c.LoggedIn = true
 
 	return nil
@@ -419,6 +562,9 @@ func (c *Client) GetDeviceStatus() (*DeviceStatus, error) {
 	if !c.LoggedIn {
 		return nil, fmt.Errorf("not logged in")
 	}
+	if c.Daemon != nil {
+		return c.Daemon.Status(c.GatewayIP)
+	}
 
 	resp, err := c.HTTPClient.Get(c.BaseURL + "/device_status_web_app.cgi?getroot")
 	if err != nil {
@@ -426,6 +572,9 @@ func (c *Client) GetDeviceStatus() (*DeviceStatus, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("device status request failed with status: %d: %w", resp.StatusCode, ErrSessionExpired)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("device status request failed with status: %d", resp.StatusCode)
 	}
@@ -437,35 +586,105 @@ func (c *Client) GetDeviceStatus() (*DeviceStatus, error) {
 
 	contentStr := strings.TrimSpace(string(bodyBytes))
 
+	// Firmware emits trailing commas, empty array slots and similar defects
 	var status DeviceStatus
-	if err := json.Unmarshal([]byte(contentStr), &status); err == nil {
-		return &status, nil
-	}
-	contentStr = strings.ReplaceAll(contentStr, ",]", "]")
-	contentStr = strings.ReplaceAll(contentStr, ",}", "}")
-
-	// Handle malformed JSON with multiple commas
-	re1 := regexp.MustCompile(`,\s*,`)
-	contentStr = re1.ReplaceAllString(contentStr, ",")
-
-	re2 := regexp.MustCompile(`\[\s*,`)
-	contentStr = re2.ReplaceAllString(contentStr, "[")
-
-	if err := json.Unmarshal([]byte(contentStr), &status); err != nil {
+	if err := lenientjson.Unmarshal([]byte(contentStr), &status); err != nil {
+		// The payload can carry Wi-Fi keys, so only a redacted copy is quoted
+		contentStr = redactJSON(contentStr)
 		if len(contentStr) > 200 {
 			return nil, fmt.Errorf("failed to decode device status: %w (content starts with: %.200s...)", err, contentStr)
 		}
 		return nil, fmt.Errorf("failed to decode device status: %w (content: %s)", err, contentStr)
 	}
 
+	c.recordFirmware(&status)
 	return &status, nil
 }
 
+// decodeJSON reads a whole response body and decodes it leniently, since
+// every FastMile endpoint can return slightly malformed JSON.
+func decodeJSON(r io.Reader, v any) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return lenientjson.Unmarshal(data, v)
+}
+
+// GetDevices returns the LAN hosts the gateway reports in its getroot payload.
+func (c *Client) GetDevices() ([]LANDevice, error) {
+	if c.Daemon != nil && c.LoggedIn {
+		return c.Daemon.Devices(c.GatewayIP)
+	}
+	status, err := c.GetDeviceStatus()
+	if err != nil {
+		return nil, err
+	}
+	return status.Devices, nil
+}
+
+func (c *Client) Reboot() error {
+	if !c.LoggedIn {
+		return fmt.Errorf("not logged in")
+	}
+	if c.Daemon != nil {
+		if err := c.Daemon.Reboot(c.GatewayIP); err != nil {
+			return err
+		}
+		c.LoggedIn = false
+		return nil
+	}
+
+	rebootData := url.Values{"csrf_token": {c.Token}}
+	req, err := http.NewRequest("POST", c.BaseURL+"/reboot_web_app.cgi", strings.NewReader(rebootData.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create reboot request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("reboot request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("reboot failed with status: %d: %w", resp.StatusCode, ErrSessionExpired)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("reboot failed with status: %d", resp.StatusCode)
+	}
+
+	// The gateway drops the session as it goes down
+	c.Token = ""
+	c.SID = ""
+	c.LoggedIn = false
+	if c.Sessions != nil {
+		return c.Sessions.Delete(c.BaseURL)
+	}
+
+	return nil
+}
+
 func (c *Client) Logout() error {
 	if !c.LoggedIn {
 		return nil
 	}
 
+	if c.Daemon != nil {
+		c.LoggedIn = false
+		return nil
+	}
+
+	// Keep the session for the next run, with any cookies it refreshed
+	if c.Sessions != nil {
+		err := c.saveSession()
+		c.Token = ""
+		c.SID = ""
+		c.LoggedIn = false
+		return err
+	}
+
 	_, err := c.HTTPClient.Get(c.BaseURL + "/login_web_app.cgi?out")
 	if err != nil {
 		return fmt.Errorf("logout failed: %w", err)
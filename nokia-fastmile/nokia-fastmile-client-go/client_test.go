@@ -0,0 +1,215 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/transport"
+)
+
+// The mock gateways accept these; the client has no built-in secrets, so
+// tests hand them over explicitly.
+const (
+	TEST_ODU_PASSWORD = "test-odu-password"
+	TEST_IDU_PAYLOAD  = "encrypted=1&ct=dGVzdC1jaXBoZXJ0ZXh0LWNhcHR1cmVkLWZyb20tYS1icm93c2Vy&ck=dGVzdC1rZXk."
+)
+
+// newTestClient is newClient over HTTPS with the test secrets set.
+func newTestClient(baseURL, gatewayIP, gatewayType string) *Client {
+	client := newClient(baseURL, gatewayIP, gatewayType, true)
+	client.Password = TEST_ODU_PASSWORD
+	client.BrowserPayload = TEST_IDU_PAYLOAD
+	return client
+}
+
+func newMockClient(t *testing.T, cfg mockgateway.Config) (*mockgateway.Server, *Client) {
+	t.Helper()
+
+	server, ts := mockgateway.NewTLSServer(cfg)
+	t.Cleanup(ts.Close)
+
+	client := newTestClient(ts.URL, "127.0.0.1", string(cfg.Mode))
+	client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}})
+	return server, client
+}
+
+func oduConfig() mockgateway.Config {
+	return mockgateway.Config{
+		Mode:       mockgateway.ModeODU,
+		Username:   ODU_USERNAME,
+		Password:   TEST_ODU_PASSWORD,
+		Iterations: 1,
+	}
+}
+
+func iduConfig() mockgateway.Config {
+	return mockgateway.Config{
+		Mode:       mockgateway.ModeIDU,
+		IDUPayload: TEST_IDU_PAYLOAD,
+	}
+}
+
+func TestLoginODU(t *testing.T) {
+	for _, iterations := range []int{0, 1} {
+		cfg := oduConfig()
+		cfg.Iterations = iterations
+		_, client := newMockClient(t, cfg)
+
+		if err := client.Login(); err != nil {
+			t.Fatalf("iterations=%d: login failed: %v", iterations, err)
+		}
+		if !client.LoggedIn || client.Token == "" || client.SID == "" {
+			t.Fatalf("iterations=%d: expected token and SID, got %+v", iterations, client)
+		}
+	}
+}
+
+func TestLoginIDU(t *testing.T) {
+	_, client := newMockClient(t, iduConfig())
+
+	if err := client.Login(); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if client.Token == "" {
+		t.Fatal("expected a token after IDU login")
+	}
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	cfg := oduConfig()
+	cfg.Password = "not-the-password"
+	_, client := newMockClient(t, cfg)
+
+	err := client.Login()
+	if err == nil || !strings.Contains(err.Error(), "gateway error code 1") {
+		t.Fatalf("expected gateway error code 1, got %v", err)
+	}
+	if client.LoggedIn {
+		t.Fatal("client should not be logged in")
+	}
+}
+
+func TestLoginScriptedFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     mockgateway.Config
+		failure mockgateway.Failure
+		want    string
+	}{
+		{"odu bad credentials", oduConfig(), mockgateway.FailBadCredentials, "gateway error code 1"},
+		{"idu bad credentials", iduConfig(), mockgateway.FailBadCredentials, "gateway error code 1"},
+		{"odu result code", withResultCode(oduConfig(), 7), mockgateway.FailResultCode, "gateway error code 7"},
+		{"odu malformed json", oduConfig(), mockgateway.FailMalformedJSON, "invalid nonce response"},
+		{"idu malformed json", iduConfig(), mockgateway.FailMalformedJSON, "invalid JSON response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newMockClient(t, tt.cfg)
+			server.SetFailure(tt.failure)
+
+			err := client.Login()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func withResultCode(cfg mockgateway.Config, code int) mockgateway.Config {
+	cfg.ResultCode = code
+	return cfg
+}
+
+func TestGetDeviceStatus(t *testing.T) {
+	_, client := newMockClient(t, oduConfig())
+	if err := client.Login(); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	status, err := client.GetDeviceStatus()
+	if err != nil {
+		t.Fatalf("GetDeviceStatus failed: %v", err)
+	}
+	if status.SerialNumber != "ALCLB1234567" || status.CPUUsageInfo.CPUUsage != 17 || status.MemInfo.Total != 493440 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if len(status.Devices) != 3 || !status.Devices[0].Active || status.Devices[2].Active {
+		t.Fatalf("unexpected devices: %+v", status.Devices)
+	}
+}
+
+func TestGetDeviceStatusRepairsTrailingCommas(t *testing.T) {
+	cfg := iduConfig()
+	cfg.Status = `{"ModelName": "FastMile", "UpTime": 60, "cpu_usageinfo": {"CPUUsage": 3,}, "device_cfg": [,{"HostName": "a"},],}`
+	_, client := newMockClient(t, cfg)
+	if err := client.Login(); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	status, err := client.GetDeviceStatus()
+	if err != nil {
+		t.Fatalf("GetDeviceStatus failed: %v", err)
+	}
+	if status.ModelName != "FastMile" || status.CPUUsageInfo.CPUUsage != 3 || len(status.Devices) != 1 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+}
+
+func TestGetDeviceStatusMalformedJSON(t *testing.T) {
+	server, client := newMockClient(t, iduConfig())
+	if err := client.Login(); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	server.SetFailure(mockgateway.FailMalformedJSON)
+	if _, err := client.GetDeviceStatus(); err == nil || !strings.Contains(err.Error(), "failed to decode device status") {
+		t.Fatalf("expected decode error, got %v", err)
+	}
+}
+
+func TestGetDeviceStatusSessionExpired(t *testing.T) {
+	server, client := newMockClient(t, oduConfig())
+	if err := client.Login(); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	server.ExpireSessions()
+	if _, err := client.GetDeviceStatus(); err == nil || !strings.Contains(err.Error(), "status: 401") {
+		t.Fatalf("expected 401 after session expiry, got %v", err)
+	}
+}
+
+func TestReboot(t *testing.T) {
+	server, client := newMockClient(t, oduConfig())
+	if err := client.Login(); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	if err := client.Reboot(); err != nil {
+		t.Fatalf("reboot failed: %v", err)
+	}
+	if server.Reboots() != 1 {
+		t.Fatalf("expected 1 reboot, got %d", server.Reboots())
+	}
+	if client.LoggedIn {
+		t.Fatal("client should be logged out after a reboot")
+	}
+}
+
+func TestLogoutClearsSession(t *testing.T) {
+	_, client := newMockClient(t, oduConfig())
+	if err := client.Login(); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if err := client.Logout(); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+
+	client.LoggedIn = true
+	if _, err := client.GetDeviceStatus(); err == nil {
+		t.Fatal("expected getroot to fail after logout")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/charmbracelet/log"
+
+	"fastmile-go/mockgateway"
+)
+
+func main() {
+	var (
+		addr       = flag.String("addr", "127.0.0.1:8443", "Address to listen on")
+		mode       = flag.String("mode", "odu", "Login flow to emulate: odu, idu")
+		username   = flag.String("username", "admin", "Username accepted by the ODU login")
+		password   = flag.String("password", "admin", "Password accepted by the ODU login")
+		payload    = flag.String("payload", "", "Exact login body accepted by the IDU login (default: any)")
+		iterations = flag.Int("iterations", 1, "Iterations advertised in the ODU nonce response")
+		useTLS     = flag.Bool("tls", true, "Serve HTTPS with a self-signed certificate")
+		failure    = flag.String("fail", "", "Failure mode: bad-credentials, result-code, malformed-json, session-expiry")
+		resultCode = flag.Int("result-code", 2, "Result code returned by logins in result-code failure mode")
+		sessionTTL = flag.Duration("session-ttl", 0, "Expire sessions after this long (0 never expires)")
+		statusFile = flag.String("status-file", "", "Serve this file verbatim from getroot")
+	)
+	flag.Parse()
+
+	logger := log.New(os.Stderr)
+
+	cfg := mockgateway.Config{
+		Mode:       mockgateway.Mode(strings.ToUpper(*mode)),
+		Username:   *username,
+		Password:   *password,
+		IDUPayload: *payload,
+		Iterations: *iterations,
+		ResultCode: *resultCode,
+		SessionTTL: *sessionTTL,
+	}
+	if cfg.Mode != mockgateway.ModeODU && cfg.Mode != mockgateway.ModeIDU {
+		logger.Fatal("Unknown Mode", "mode", *mode)
+	}
+
+	if *statusFile != "" {
+		status, err := os.ReadFile(*statusFile)
+		if err != nil {
+			logger.Fatal("Failed To Read Status File", "error", err)
+		}
+		cfg.Status = string(status)
+	}
+
+	server := mockgateway.New(cfg)
+	server.SetFailure(mockgateway.Failure(*failure))
+
+	ts, err := server.Listen(*addr, *useTLS)
+	if err != nil {
+		logger.Fatal("Failed To Start Mock Gateway", "error", err)
+	}
+	defer ts.Close()
+
+	logger.Info("Mock Gateway Listening", "url", ts.URL, "mode", cfg.Mode, "fail", *failure)
+	fmt.Fprintf(os.Stderr, "\nTry: %s\n\n", tryCommand(cfg, ts.Listener.Addr().String()))
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+
+	logger.Info("Shutting Down", "logins", server.Logins(), "reboots", server.Reboots())
+}
+
+// tryCommand is a client invocation that logs in to this mock. The client
+// has no built-in secrets, so it passes the mock's through the environment,
+// and a username other than the client's default has to be stored first.
+func tryCommand(cfg mockgateway.Config, addr string) string {
+	client := fmt.Sprintf("fastmile-go -gateway %s -gateway-type %s", addr, cfg.Mode)
+	if cfg.Mode == mockgateway.ModeIDU {
+		payload := cfg.IDUPayload
+		if payload == "" {
+			payload = "encrypted=1"
+		}
+		return fmt.Sprintf("FASTMILE_BROWSER_PAYLOAD='%s' %s", payload, client)
+	}
+	if cfg.Username != "admin" {
+		return fmt.Sprintf("%s -cmd credentials set   (username %s, password %s), then %s", client, cfg.Username, cfg.Password, client)
+	}
+	return fmt.Sprintf("FASTMILE_PASSWORD='%s' %s", cfg.Password, client)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"gateway-common/credstore"
+)
+
+const (
+	KEYRING_SERVICE = "fastmile-go"
+	PASSPHRASE_ENV  = "FASTMILE_PASSPHRASE"
+
+	// Gateway secrets from the environment, overriding stored ones
+	PASSWORD_ENV        = "FASTMILE_PASSWORD"
+	BROWSER_PAYLOAD_ENV = "FASTMILE_BROWSER_PAYLOAD"
+)
+
+// ErrNoPassword is returned by a login attempted without the gateway's
+// password or browser payload; the client has no built-in ones.
+var ErrNoPassword = errors.New("no gateway password")
+
+// OpenCredentialStore opens the keyring entry or encrypted file that holds
+// this tool's gateway credentials.
+func OpenCredentialStore(backend, path string, passphrase credstore.PassphraseFunc) (credstore.Store, error) {
+	return credstore.Open(backend, &credstore.KeyringStore{Service: KEYRING_SERVICE}, &credstore.FileStore{Path: path, Passphrase: passphrase})
+}
+
+// ResolveCredentials loads the stored credentials for this gateway and lets
+// $FASTMILE_PASSWORD and $FASTMILE_BROWSER_PAYLOAD override them. It reports
+// whether stored credentials were used and fails when the gateway type's
+// secret is in neither place.
+func (c *Client) ResolveCredentials(store credstore.Store) (bool, error) {
+	used := false
+	creds, storeErr := store.Get(c.GatewayIP)
+	if storeErr == nil {
+		used = true
+		if creds.Username != "" {
+			c.Username = creds.Username
+		}
+		c.Password = creds.Password
+		c.BrowserPayload = creds.BrowserPayload
+	}
+
+	if password := os.Getenv(PASSWORD_ENV); password != "" {
+		c.Password = password
+	}
+	if payload := os.Getenv(BROWSER_PAYLOAD_ENV); payload != "" {
+		c.BrowserPayload = payload
+	}
+
+	if c.missingSecret() == nil {
+		return used, nil
+	}
+	if storeErr != nil && !errors.Is(storeErr, credstore.ErrNoCredentials) {
+		return false, storeErr
+	}
+	return used, c.missingSecret()
+}
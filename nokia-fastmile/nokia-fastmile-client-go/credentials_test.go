@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/credstore"
+)
+
+func staticPassphrase(passphrase string) credstore.PassphraseFunc {
+	return func(bool) ([]byte, error) { return []byte(passphrase), nil }
+}
+
+func TestResolveCredentialsLogsInWithStoredPassword(t *testing.T) {
+	t.Setenv(PASSWORD_ENV, "")
+	cfg := oduConfig()
+	cfg.Password = "changed-from-default"
+	_, client := newMockClient(t, cfg)
+
+	if err := client.Login(); err == nil {
+		t.Fatal("login with a password the gateway does not accept should fail")
+	}
+
+	store := &credstore.FileStore{Path: filepath.Join(t.TempDir(), credstore.CREDENTIALS_FILE), Passphrase: staticPassphrase("pw")}
+	if err := store.Set(client.GatewayIP, credstore.Credentials{Username: ODU_USERNAME, Password: cfg.Password}); err != nil {
+		t.Fatal(err)
+	}
+
+	used, err := client.ResolveCredentials(store)
+	if err != nil || !used {
+		t.Fatalf("ResolveCredentials = %v, %v", used, err)
+	}
+	if err := client.Login(); err != nil {
+		t.Fatalf("login with stored credentials failed: %v", err)
+	}
+}
+
+func TestResolveCredentialsRequiresSecret(t *testing.T) {
+	t.Setenv(PASSWORD_ENV, "")
+	t.Setenv(BROWSER_PAYLOAD_ENV, "")
+	store := &credstore.FileStore{Path: filepath.Join(t.TempDir(), credstore.CREDENTIALS_FILE), Passphrase: staticPassphrase("pw")}
+
+	for _, cfg := range []mockgateway.Config{oduConfig(), iduConfig()} {
+		_, client := newMockClient(t, cfg)
+		client.Password, client.BrowserPayload = "", ""
+
+		if _, err := client.ResolveCredentials(store); !errors.Is(err, ErrNoPassword) {
+			t.Fatalf("%s: ResolveCredentials without a secret = %v", cfg.Mode, err)
+		}
+		if err := client.Login(); !errors.Is(err, ErrNoPassword) {
+			t.Fatalf("%s: login without a secret = %v", cfg.Mode, err)
+		}
+
+		t.Setenv(PASSWORD_ENV, TEST_ODU_PASSWORD)
+		t.Setenv(BROWSER_PAYLOAD_ENV, TEST_IDU_PAYLOAD)
+		if used, err := client.ResolveCredentials(store); err != nil || used {
+			t.Fatalf("%s: ResolveCredentials from the environment = %v, %v", cfg.Mode, used, err)
+		}
+		if err := client.Login(); err != nil {
+			t.Fatalf("%s: login with secrets from the environment failed: %v", cfg.Mode, err)
+		}
+		client.Logout()
+		t.Setenv(PASSWORD_ENV, "")
+		t.Setenv(BROWSER_PAYLOAD_ENV, "")
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	DAEMON_SOCKET = "fastmile.sock"
+
+	// Long enough for the daemon to log in again before answering
+	DAEMON_REQUEST_TIMEOUT = 2 * time.Minute
+	DAEMON_PROBE_TIMEOUT   = time.Second
+)
+
+// DefaultDaemonSocketPath is in XDG_RUNTIME_DIR, which only the user can
+// reach, or else in a per-user directory under the temp directory that the
+// daemon creates 0700 and refuses to use if someone else owns it.
+func DefaultDaemonSocketPath() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, DAEMON_SOCKET)
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("fastmile-%d", os.Getuid()), DAEMON_SOCKET)
+}
+
+// DaemonStatus is the daemon's answer to a status request.
+type DaemonStatus struct {
+	Gateway     string        `json:"gateway"`
+	GatewayType string        `json:"gateway_type"`
+	Status      *DeviceStatus `json:"status"`
+}
+
+// DaemonDevices is the daemon's answer to a devices request.
+type DaemonDevices struct {
+	Gateway     string      `json:"gateway"`
+	GatewayType string      `json:"gateway_type"`
+	Devices     []LANDevice `json:"devices"`
+}
+
+type daemonHealth struct {
+	Status   string   `json:"status"`
+	Gateways []string `json:"gateways"`
+}
+
+type daemonError struct {
+	Error string `json:"error"`
+}
+
+// Daemon holds one authenticated session per gateway and serves requests
+// for all local scripts over a Unix socket, so they stop logging each
+// other out. Requests to the same gateway are serialized.
+type Daemon struct {
+	NewClient ClientFactory
+	Logger    *log.Logger
+
+	mu       sync.Mutex
+	gateways map[string]*daemonGateway
+}
+
+type daemonGateway struct {
+	mu     sync.Mutex
+	client *Client
+}
+
+func NewDaemon(newClient ClientFactory, logger *log.Logger) *Daemon {
+	return &Daemon{
+		NewClient: newClient,
+		Logger:    logger,
+		gateways:  make(map[string]*daemonGateway),
+	}
+}
+
+// Handler serves the JSON API:
+//
+//	GET  /v1/health
+//	GET  /v1/gateways/{gateway}/status
+//	GET  /v1/gateways/{gateway}/devices
+//	POST /v1/gateways/{gateway}/reboot
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/health", d.handleHealth)
+	mux.HandleFunc("GET /v1/gateways/{gateway}/status", d.handleStatus)
+	mux.HandleFunc("GET /v1/gateways/{gateway}/devices", d.handleDevices)
+	mux.HandleFunc("POST /v1/gateways/{gateway}/reboot", d.handleReboot)
+	return mux
+}
+
+// Open logs into each gateway up front. Failures are logged and retried on
+// the first request for that gateway.
+func (d *Daemon) Open(gateways []string) {
+	for _, gateway := range gateways {
+		if err := d.withSession(gateway, func(*Client) error { return nil }); err != nil {
+			d.Logger.Warn("Gateway Login Failed", "gateway", gateway, "error", err)
+		}
+	}
+}
+
+// Serve listens on socketPath until ctx is cancelled, then logs out of
+// every gateway.
+func (d *Daemon) Serve(ctx context.Context, socketPath string) error {
+	ln, err := listenUnix(socketPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socketPath)
+
+	server := &http.Server{Handler: d.Handler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	d.Logger.Info("Daemon Listening", "socket", socketPath)
+	err = server.Serve(ln)
+	d.Close()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Close logs out of every gateway the daemon holds a session for.
+func (d *Daemon) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for gateway, g := range d.gateways {
+		g.mu.Lock()
+		if err := g.client.Logout(); err != nil {
+			d.Logger.Error("Logout Failed", "gateway", gateway, "error", err)
+		}
+		g.mu.Unlock()
+	}
+}
+
+func listenUnix(socketPath string) (net.Listener, error) {
+	// A socket left by a crashed daemon is replaced; a live one is not
+	if conn, err := net.DialTimeout("unix", socketPath, DAEMON_PROBE_TIMEOUT); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already listening on %s", socketPath)
+	}
+	if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	// Anyone who can write the directory could swap the socket for their own
+	if err := checkSocketDir(filepath.Dir(socketPath)); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	return ln, nil
+}
+
+func checkSocketDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check socket directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("socket directory %s is not a directory", dir)
+	}
+	uid, ok := fileOwner(info)
+	if !ok {
+		return nil
+	}
+	if uid != os.Getuid() {
+		return fmt.Errorf("socket directory %s is owned by uid %d, not %d", dir, uid, os.Getuid())
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("socket directory %s is writable by other users (%v)", dir, info.Mode().Perm())
+	}
+	return nil
+}
+
+func (d *Daemon) gateway(address string) *daemonGateway {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	g, ok := d.gateways[address]
+	if !ok {
+		g = &daemonGateway{client: d.NewClient(address)}
+		d.gateways[address] = g
+	}
+	return g
+}
+
+// withSession runs fn with a logged-in client, logging in again once if
+// the gateway has dropped the session.
+func (d *Daemon) withSession(address string, fn func(*Client) error) error {
+	g := d.gateway(address)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		if !g.client.LoggedIn {
+			if err := g.client.Login(); err != nil {
+				return fmt.Errorf("login failed: %w", err)
+			}
+			d.Logger.Info("Gateway Session Opened", "gateway", address, "gateway-type", g.client.GatewayType)
+		}
+
+		err := fn(g.client)
+		if errors.Is(err, ErrSessionExpired) && attempt == 1 {
+			d.Logger.Info("Gateway Session Expired", "gateway", address)
+			g.client.LoggedIn = false
+			continue
+		}
+		return err
+	}
+}
+
+func (d *Daemon) handleHealth(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	health := daemonHealth{Status: "ok", Gateways: make([]string, 0, len(d.gateways))}
+	for gateway := range d.gateways {
+		health.Gateways = append(health.Gateways, gateway)
+	}
+	d.mu.Unlock()
+
+	sort.Strings(health.Gateways)
+	writeDaemonJSON(w, http.StatusOK, health)
+}
+
+func (d *Daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	resp, err := d.status(r.PathValue("gateway"))
+	if err != nil {
+		writeDaemonError(w, err)
+		return
+	}
+	writeDaemonJSON(w, http.StatusOK, resp)
+}
+
+func (d *Daemon) handleDevices(w http.ResponseWriter, r *http.Request) {
+	resp, err := d.devices(r.PathValue("gateway"))
+	if err != nil {
+		writeDaemonError(w, err)
+		return
+	}
+	writeDaemonJSON(w, http.StatusOK, resp)
+}
+
+func (d *Daemon) handleReboot(w http.ResponseWriter, r *http.Request) {
+	gateway := r.PathValue("gateway")
+	if err := d.reboot(gateway); err != nil {
+		writeDaemonError(w, err)
+		return
+	}
+	writeDaemonJSON(w, http.StatusOK, map[string]string{"gateway": gateway, "result": "rebooting"})
+}
+
+func (d *Daemon) status(gateway string) (DaemonStatus, error) {
+	resp := DaemonStatus{Gateway: gateway}
+	err := d.withSession(gateway, func(c *Client) error {
+		status, err := c.GetDeviceStatus()
+		if err != nil {
+			return err
+		}
+		reportFirmwareChange(c.GatewayType, c.GatewayIP, status, false, d.Logger)
+		resp.GatewayType, resp.Status = c.GatewayType, status
+		return nil
+	})
+	return resp, err
+}
+
+func (d *Daemon) devices(gateway string) (DaemonDevices, error) {
+	resp := DaemonDevices{Gateway: gateway}
+	err := d.withSession(gateway, func(c *Client) error {
+		devices, err := c.GetDevices()
+		resp.GatewayType, resp.Devices = c.GatewayType, devices
+		return err
+	})
+	return resp, err
+}
+
+func (d *Daemon) reboot(gateway string) error {
+	err := d.withSession(gateway, func(c *Client) error {
+		return c.Reboot()
+	})
+	if err == nil {
+		d.Logger.Info("Reboot Sent", "gateway", gateway)
+	}
+	return err
+}
+
+// gatewayType reports the type of gateway without logging in.
+func (d *Daemon) gatewayType(gateway string) string {
+	return d.gateway(gateway).client.GatewayType
+}
+
+func writeDaemonJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Gateway failures are reported as 502, since the daemon itself is fine.
+func writeDaemonError(w http.ResponseWriter, err error) {
+	writeDaemonJSON(w, http.StatusBadGateway, daemonError{Error: err.Error()})
+}
+
+// DaemonClient talks to a running daemon over its socket.
+type DaemonClient struct {
+	SocketPath string
+	HTTPClient *http.Client
+}
+
+func NewDaemonClient(socketPath string) *DaemonClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &DaemonClient{
+		SocketPath: socketPath,
+		HTTPClient: &http.Client{Transport: transport, Timeout: DAEMON_REQUEST_TIMEOUT},
+	}
+}
+
+// DialDaemon returns a client for the daemon on socketPath, or nil if no
+// daemon answers there. A socket owned by another user is never used, since
+// whoever listens on it would see every request and could answer anything.
+func DialDaemon(socketPath string) *DaemonClient {
+	info, err := os.Lstat(socketPath)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	if uid, ok := fileOwner(info); ok && uid != os.Getuid() {
+		return nil
+	}
+
+	d := NewDaemonClient(socketPath)
+	ctx, cancel := context.WithTimeout(context.Background(), DAEMON_PROBE_TIMEOUT)
+	defer cancel()
+
+	var health daemonHealth
+	if err := d.do(ctx, http.MethodGet, "/v1/health", &health); err != nil || health.Status != "ok" {
+		return nil
+	}
+	return d
+}
+
+func (d *DaemonClient) Status(gateway string) (*DeviceStatus, error) {
+	var resp DaemonStatus
+	if err := d.do(context.Background(), http.MethodGet, gatewayPath(gateway, "status"), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Status, nil
+}
+
+func (d *DaemonClient) Devices(gateway string) ([]LANDevice, error) {
+	var resp DaemonDevices
+	if err := d.do(context.Background(), http.MethodGet, gatewayPath(gateway, "devices"), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Devices, nil
+}
+
+func (d *DaemonClient) Reboot(gateway string) error {
+	return d.do(context.Background(), http.MethodPost, gatewayPath(gateway, "reboot"), nil)
+}
+
+func gatewayPath(gateway, action string) string {
+	return "/v1/gateways/" + url.PathEscape(gateway) + "/" + action
+}
+
+func (d *DaemonClient) do(ctx context.Context, method, path string, v any) error {
+	// The host is ignored; every connection goes to the socket
+	req, err := http.NewRequestWithContext(ctx, method, "http://fastmile"+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create daemon request: %w", err)
+	}
+
+	resp, err := d.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("daemon request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr daemonError
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("daemon: %s", apiErr.Error)
+		}
+		return fmt.Errorf("daemon request failed with status: %d", resp.StatusCode)
+	}
+
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid daemon response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/transport"
+)
+
+// startDaemon serves ODU and IDU mock gateways through a daemon and returns
+// the servers keyed by the address scripts use for them.
+func startDaemon(t *testing.T) (string, map[string]*mockgateway.Server) {
+	t.Helper()
+
+	servers := make(map[string]*mockgateway.Server)
+	urls := make(map[string]string)
+	modes := make(map[string]string)
+	for _, cfg := range []mockgateway.Config{oduConfig(), iduConfig()} {
+		server, ts := mockgateway.NewTLSServer(cfg)
+		t.Cleanup(ts.Close)
+		address := ts.Listener.Addr().String()
+		servers[address], urls[address], modes[address] = server, ts.URL, string(cfg.Mode)
+	}
+
+	known := &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}
+	return serveDaemon(t, NewDaemon(func(address string) *Client {
+		client := newTestClient(urls[address], address, modes[address])
+		client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: known})
+		return client
+	}, log.New(io.Discard))), servers
+}
+
+// serveDaemon runs d until the test ends and returns its socket.
+func serveDaemon(t *testing.T, d *Daemon) string {
+	t.Helper()
+
+	// Socket paths are limited to about 100 bytes, too short for t.TempDir
+	dir, err := os.MkdirTemp("", "fmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, DAEMON_SOCKET)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Serve(ctx, socket) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("daemon: %v", err)
+		}
+	})
+
+	for deadline := time.Now().Add(2 * time.Second); DialDaemon(socket) == nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("daemon did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return socket
+}
+
+func TestDaemonSharesOneSessionPerGateway(t *testing.T) {
+	socket, servers := startDaemon(t)
+
+	// Scripts running side by side, each with its own CLI client
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		for address := range servers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				client := NewClient(address, true)
+				client.Daemon = DialDaemon(socket)
+				if err := client.Login(); err != nil {
+					errs <- err
+					return
+				}
+				defer client.Logout()
+				if status, err := client.GetDeviceStatus(); err != nil || status.SerialNumber == "" {
+					errs <- err
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("status through daemon failed: %v", err)
+	}
+
+	for address, server := range servers {
+		if server.Logins() != 1 {
+			t.Errorf("%s: expected one shared login, got %d", address, server.Logins())
+		}
+	}
+}
+
+func TestDaemonLogsInAgainWhenSessionExpires(t *testing.T) {
+	socket, servers := startDaemon(t)
+	daemon := DialDaemon(socket)
+
+	for address, server := range servers {
+		if _, err := daemon.Status(address); err != nil {
+			t.Fatal(err)
+		}
+		server.ExpireSessions()
+		devices, err := daemon.Devices(address)
+		if err != nil {
+			t.Fatalf("devices after expiry failed: %v", err)
+		}
+		if len(devices) == 0 || server.Logins() != 2 {
+			t.Fatalf("expected devices after a second login, got %d devices and %d logins", len(devices), server.Logins())
+		}
+	}
+}
+
+func TestDaemonReboot(t *testing.T) {
+	socket, servers := startDaemon(t)
+
+	for address, server := range servers {
+		client := NewClient(address, true)
+		client.Daemon = DialDaemon(socket)
+		if err := client.Login(); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Reboot(); err != nil {
+			t.Fatalf("reboot through daemon failed: %v", err)
+		}
+		if server.Reboots() != 1 || client.LoggedIn {
+			t.Fatalf("expected one reboot, got %d", server.Reboots())
+		}
+	}
+}
+
+func TestDialDaemonWithoutDaemon(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), DAEMON_SOCKET)
+	if DialDaemon(socket) != nil {
+		t.Fatal("found a daemon where none is running")
+	}
+
+	// A socket file left behind by a crashed daemon
+	if err := os.WriteFile(socket, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if DialDaemon(socket) != nil {
+		t.Fatal("stale socket file was taken for a running daemon")
+	}
+}
+
+func TestDefaultDaemonSocketPathIsPrivate(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	path := DefaultDaemonSocketPath()
+	if dir := filepath.Dir(path); dir == os.TempDir() {
+		t.Fatalf("socket %s is directly in the shared temp directory", path)
+	}
+}
+
+func TestDaemonRefusesSharedSocketDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := listenUnix(filepath.Join(dir, DAEMON_SOCKET))
+	if err == nil {
+		ln.Close()
+		t.Fatal("daemon listened in a directory every user can write")
+	}
+}
+
+func TestDialDaemonRefusesForeignSocket(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing a socket's owner needs root")
+	}
+	socket, _ := startDaemon(t)
+	if err := os.Lchown(socket, 65534, 65534); err != nil {
+		t.Fatal(err)
+	}
+	if DialDaemon(socket) != nil {
+		t.Fatal("used a daemon socket owned by another user")
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/charmbracelet/lipgloss/table"
 )
 
+// VERSION_WIDTH fits the version column of the status box
+const VERSION_WIDTH = 46
+
 type MemoryInfo struct {
 	TotalMB     float64
 	UsedMB      float64
@@ -40,10 +43,8 @@ func RenderStatusBoxLipglossWithType(status *DeviceStatus, gatewayType, gatewayI
 	title := titleStyle.Render(fmt.Sprintf("Nokia FastMile 5G Gateway (%s)", gatewayType))
 	subtitle := titleStyle.Render(fmt.Sprintf("IP: %s", gatewayIP))
 
-	version := status.SoftwareVersion
-	if len(version) > 40 {
-		version = version[:37] + "..."
-	}
+	// Show the whole version so firmware updates can be told apart
+	version := strings.Join(wrapVersion(status.SoftwareVersion, VERSION_WIDTH), "\n")
 
 	t := table.New().
 		Border(lipgloss.HiddenBorder()).
@@ -108,10 +109,8 @@ func RenderStatusBoxLipgloss(status *DeviceStatus) string {
 
 	title := titleStyle.Render("Nokia FastMile 5G Gateway")
 
-	version := status.SoftwareVersion
-	if len(version) > 40 {
-		version = version[:37] + "..."
-	}
+	// Show the whole version so firmware updates can be told apart
+	version := strings.Join(wrapVersion(status.SoftwareVersion, VERSION_WIDTH), "\n")
 
 	t := table.New().
 		Border(lipgloss.HiddenBorder()).
@@ -327,3 +326,18 @@ func FormatMemory(totalKB, freeKB int) MemoryInfo {
 		UsedPercent: usedPercent,
 	}
 }
+
+// wrapVersion splits a firmware version into lines of at most width
+// characters, preferring to break after separators.
+func wrapVersion(version string, width int) []string {
+	var lines []string
+	for len(version) > width {
+		cut := strings.LastIndexAny(version[:width], "._-") + 1
+		if cut <= 0 {
+			cut = width
+		}
+		lines = append(lines, version[:cut])
+		version = version[cut:]
+	}
+	return append(lines, version)
+}
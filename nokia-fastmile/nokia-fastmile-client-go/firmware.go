@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/charmbracelet/log"
+)
+
+const FIRMWARE_FILE = "firmware.json"
+
+// FirmwareChange is one observed upgrade (or downgrade) of a gateway.
+type FirmwareChange struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	At   time.Time `json:"at"`
+}
+
+// FirmwareRecord is what is known about one gateway, keyed by serial number
+// so a gateway that moves to another address keeps its history.
+type FirmwareRecord struct {
+	Serial      string           `json:"serial"`
+	Model       string           `json:"model"`
+	Gateway     string           `json:"gateway"`
+	GatewayType string           `json:"gateway_type"`
+	Version     string           `json:"version"`
+	FirstSeen   time.Time        `json:"first_seen"`
+	LastSeen    time.Time        `json:"last_seen"`
+	Changes     []FirmwareChange `json:"changes,omitempty"`
+}
+
+// LastChange returns the most recent version change, if one was observed.
+func (r FirmwareRecord) LastChange() (FirmwareChange, bool) {
+	if len(r.Changes) == 0 {
+		return FirmwareChange{}, false
+	}
+	return r.Changes[len(r.Changes)-1], true
+}
+
+// FirmwareHistory is a small JSON file of the firmware last seen on every
+// gateway, read and rewritten on each access.
+type FirmwareHistory struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func DefaultFirmwareHistoryPath() string {
+	return filepath.Join(filepath.Dir(DefaultSessionCachePath()), FIRMWARE_FILE)
+}
+
+func NewFirmwareHistory(path string) *FirmwareHistory {
+	return &FirmwareHistory{Path: path}
+}
+
+// Record notes the version a gateway reports and returns the change when it
+// differs from the version last seen for that serial number. The first
+// sighting of a gateway is not a change.
+func (h *FirmwareHistory) Record(gateway, gatewayType string, status *DeviceStatus, now time.Time) (*FirmwareChange, error) {
+	if status.SerialNumber == "" {
+		return nil, fmt.Errorf("gateway %s did not report a serial number", gateway)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	records, err := h.load()
+	if err != nil {
+		return nil, err
+	}
+
+	record, seen := records[status.SerialNumber]
+	if !seen {
+		record = FirmwareRecord{Serial: status.SerialNumber, Version: status.SoftwareVersion, FirstSeen: now}
+	}
+	record.Model = status.ModelName
+	record.Gateway = gateway
+	record.GatewayType = gatewayType
+	record.LastSeen = now
+
+	var change *FirmwareChange
+	if seen && record.Version != status.SoftwareVersion {
+		change = &FirmwareChange{From: record.Version, To: status.SoftwareVersion, At: now}
+		record.Changes = append(record.Changes, *change)
+		record.Version = status.SoftwareVersion
+	}
+
+	records[status.SerialNumber] = record
+	return change, h.save(records)
+}
+
+// List returns every recorded gateway ordered by address.
+func (h *FirmwareHistory) List() ([]FirmwareRecord, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	records, err := h.load()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]FirmwareRecord, 0, len(records))
+	for _, record := range records {
+		list = append(list, record)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Gateway != list[j].Gateway {
+			return list[i].Gateway < list[j].Gateway
+		}
+		return list[i].Serial < list[j].Serial
+	})
+	return list, nil
+}
+
+func (h *FirmwareHistory) load() (map[string]FirmwareRecord, error) {
+	records := make(map[string]FirmwareRecord)
+
+	data, err := os.ReadFile(h.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read firmware history: %w", err)
+	}
+	// Unlike the session cache the history cannot be rebuilt, so refuse to
+	// overwrite a file that does not parse
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse firmware history %s: %w", h.Path, err)
+	}
+	return records, nil
+}
+
+func (h *FirmwareHistory) save(records map[string]FirmwareRecord) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(h.Path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create firmware history directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".firmware-*")
+	if err != nil {
+		return fmt.Errorf("failed to write firmware history: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write firmware history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write firmware history: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), h.Path); err != nil {
+		return fmt.Errorf("failed to replace firmware history: %w", err)
+	}
+	return nil
+}
+
+// RenderFirmwareTable renders one row per recorded gateway.
+func RenderFirmwareTable(records []FirmwareRecord) string {
+	changedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("208")).Bold(true)
+
+	rows := make([][]string, 0, len(records))
+	for _, record := range records {
+		changed := "never seen changing"
+		if change, ok := record.LastChange(); ok {
+			changed = changedStyle.Render(fmt.Sprintf("%s (was %s)", change.At.Local().Format("2006-01-02 15:04"), change.From))
+		}
+		rows = append(rows, []string{
+			record.Gateway,
+			record.GatewayType,
+			record.Serial,
+			record.Version,
+			record.LastSeen.Local().Format("2006-01-02 15:04"),
+			changed,
+		})
+	}
+
+	t := table.New().
+		Border(lipgloss.RoundedBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("6"))).
+		Headers("Gateway", "Type", "Serial", "Version", "Last Seen", "Last Changed").
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if row == table.HeaderRow {
+				return lipgloss.NewStyle().Foreground(lipgloss.Color("12")).Bold(true).Padding(0, 1)
+			}
+			return lipgloss.NewStyle().Padding(0, 1)
+		}).
+		Rows(rows...)
+
+	return t.Render() + "\n"
+}
+
+// recordFirmware notes the firmware in status in the client's history and
+// keeps the change, or why it could not be recorded, on status. Clients
+// without a history record nothing.
+func (c *Client) recordFirmware(status *DeviceStatus) {
+	if c.Firmware == nil {
+		return
+	}
+	change, err := c.Firmware.Record(c.GatewayIP, c.GatewayType, status, time.Now())
+	if err != nil {
+		status.FirmwareError = err.Error()
+		return
+	}
+	status.FirmwareChange = change
+}
+
+// reportFirmwareChange announces the change GetDeviceStatus recorded,
+// without judging it; carriers roll firmware back as well as forward.
+// History failures are logged, never fatal.
+func reportFirmwareChange(gatewayType, gateway string, status *DeviceStatus, usePrettyOutput bool, logger *log.Logger) {
+	if status.FirmwareError != "" {
+		logger.Warn("Failed To Record Firmware", "gateway", gateway, "error", status.FirmwareError)
+		return
+	}
+	change, serial := status.FirmwareChange, status.SerialNumber
+	if change == nil {
+		return
+	}
+	if usePrettyOutput {
+		fmt.Printf("%s\n", RenderTokenLipgloss(fmt.Sprintf("Firmware changed on %s %s: %s → %s", gatewayType, gateway, change.From, change.To)))
+	} else {
+		logger.Warn("Firmware Changed", "gateway-type", gatewayType, "ip", gateway, "serial", serial, "from", change.From, "to", change.To)
+	}
+}
+
+// handleFirmwareCommand refreshes the history from every reachable gateway
+// and lists everything recorded, including gateways that are down now.
+func handleFirmwareCommand(gateways []string, newClient ClientFactory, history *FirmwareHistory, usePrettyOutput bool, logger *log.Logger) {
+	for _, gatewayIP := range gateways {
+		client := newClient(gatewayIP)
+		if err := client.Login(); err != nil {
+			logger.Error("Authentication Failed", "gateway-type", client.GatewayType, "ip", gatewayIP, "error", err)
+			continue
+		}
+		status, err := client.GetDeviceStatus()
+		client.Logout()
+		if err != nil {
+			logger.Error("Failed To Retrieve Device Status", "gateway-type", client.GatewayType, "ip", gatewayIP, "error", err)
+			continue
+		}
+		reportFirmwareChange(client.GatewayType, gatewayIP, status, usePrettyOutput, logger)
+	}
+
+	records, err := history.List()
+	if err != nil {
+		logger.Fatal("Failed To Read Firmware History", "error", err)
+	}
+	if len(records) == 0 {
+		logger.Warn("No Firmware Recorded Yet", "file", history.Path)
+		return
+	}
+
+	if usePrettyOutput {
+		fmt.Print(RenderFirmwareTable(records))
+		return
+	}
+	for _, record := range records {
+		fields := []interface{}{"gateway", record.Gateway, "gateway-type", record.GatewayType, "serial", record.Serial,
+			"model", record.Model, "version", record.Version, "last-seen", record.LastSeen.Format(time.RFC3339)}
+		if change, ok := record.LastChange(); ok {
+			fields = append(fields, "changed-at", change.At.Format(time.RFC3339), "previous", change.From)
+		}
+		logger.Info("Firmware", fields...)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/fleet"
+	"gateway-common/transport"
+)
+
+func TestFirmwareHistoryReportsChanges(t *testing.T) {
+	history := NewFirmwareHistory(filepath.Join(t.TempDir(), "state", FIRMWARE_FILE))
+	start := time.Date(2026, 3, 1, 4, 0, 0, 0, time.UTC)
+
+	odu := &DeviceStatus{ModelName: "FastMile 5G Receiver", SerialNumber: "ALCLB1234567", SoftwareVersion: "3FE49010AAAA01"}
+	if change, err := history.Record("192.168.0.1", "ODU", odu, start); err != nil || change != nil {
+		t.Fatalf("first sighting: change %+v, err %v", change, err)
+	}
+	if change, err := history.Record("192.168.0.1", "ODU", odu, start.Add(time.Hour)); err != nil || change != nil {
+		t.Fatalf("same version: change %+v, err %v", change, err)
+	}
+
+	// A carrier push, seen after the gateway moved to another address
+	odu.SoftwareVersion = "3FE49010AAAB02"
+	pushed := start.Add(48 * time.Hour)
+	change, err := NewFirmwareHistory(history.Path).Record("192.168.0.2", "ODU", odu, pushed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change == nil || change.From != "3FE49010AAAA01" || change.To != "3FE49010AAAB02" || !change.At.Equal(pushed) {
+		t.Fatalf("unexpected change: %+v", change)
+	}
+
+	idu := &DeviceStatus{SerialNumber: "ALCLB7654321", SoftwareVersion: "3FE49568HJIJ86"}
+	if _, err := history.Record("192.168.1.1", "IDU", idu, pushed); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := history.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Serial != "ALCLB1234567" || records[0].Gateway != "192.168.0.2" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	if last, ok := records[0].LastChange(); !ok || last.From != "3FE49010AAAA01" || !records[0].FirstSeen.Equal(start) {
+		t.Fatalf("history lost: %+v", records[0])
+	}
+	if _, ok := records[1].LastChange(); ok {
+		t.Fatalf("unchanged gateway reports a change: %+v", records[1])
+	}
+
+	table := RenderFirmwareTable(records)
+	for _, want := range []string{"192.168.0.2", "3FE49010AAAB02", "was 3FE49010AAAA01", "never seen changing"} {
+		if !strings.Contains(table, want) {
+			t.Errorf("table is missing %q:\n%s", want, table)
+		}
+	}
+
+	if _, err := history.Record("192.168.0.1", "ODU", &DeviceStatus{SoftwareVersion: "x"}, pushed); err == nil {
+		t.Fatal("expected a status without a serial number to be rejected")
+	}
+}
+
+func TestFirmwareHistoryKeepsCorruptFile(t *testing.T) {
+	history := NewFirmwareHistory(filepath.Join(t.TempDir(), FIRMWARE_FILE))
+	if err := os.WriteFile(history.Path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := history.Record("192.168.0.1", "ODU", &DeviceStatus{SerialNumber: "ALCLB1234567"}, time.Now()); err == nil {
+		t.Fatal("expected a corrupt history to be reported")
+	}
+	if data, _ := os.ReadFile(history.Path); string(data) != "{not json" {
+		t.Fatalf("corrupt history was overwritten: %q", data)
+	}
+}
+
+func TestStatusBoxShowsWholeVersion(t *testing.T) {
+	version := "3FE49010AAAB02_ODU_NOKIA_5G_RECEIVER_FASTMILE_RELEASE_2026.03.1-hotfix7"
+	box := RenderStatusBoxLipglossWithType(&DeviceStatus{SerialNumber: "ALCLB1234567", SoftwareVersion: version}, "ODU", "192.168.0.1")
+
+	if strings.Contains(box, "...") {
+		t.Fatalf("version was truncated:\n%s", box)
+	}
+	lines := wrapVersion(version, VERSION_WIDTH)
+	if len(lines) < 2 || strings.Join(lines, "") != version {
+		t.Fatalf("wrapVersion(%q) = %q", version, lines)
+	}
+	for _, line := range lines {
+		if len(line) > VERSION_WIDTH || !strings.Contains(box, line) {
+			t.Errorf("box is missing version line %q:\n%s", line, box)
+		}
+	}
+}
+
+func TestStatusPathsRecordFirmware(t *testing.T) {
+	_, ts := mockgateway.NewTLSServer(oduConfig())
+	t.Cleanup(ts.Close)
+	address := ts.Listener.Addr().String()
+	known := &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}
+
+	// Each path starts from a history that last saw an older version
+	seeded := func(t *testing.T) *FirmwareHistory {
+		history := NewFirmwareHistory(filepath.Join(t.TempDir(), FIRMWARE_FILE))
+		old := &DeviceStatus{SerialNumber: "ALCLB1234567", SoftwareVersion: "R22.07.03.013"}
+		if _, err := history.Record(address, "ODU", old, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		return history
+	}
+	factory := func(history *FirmwareHistory) ClientFactory {
+		return func(string) *Client {
+			client := newTestClient(ts.URL, address, string(mockgateway.ModeODU))
+			client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: known})
+			client.Firmware = history
+			return client
+		}
+	}
+	changed := func(t *testing.T, history *FirmwareHistory) {
+		t.Helper()
+		records, err := history.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last, ok := records[0].LastChange(); !ok || last.From != "R22.07.03.013" || last.To != "R22.07.03.014-mock" {
+			t.Fatalf("change not recorded: %+v", records[0])
+		}
+	}
+
+	t.Run("daemon", func(t *testing.T) {
+		history := seeded(t)
+		var logs bytes.Buffer
+		if _, err := NewDaemon(factory(history), log.New(&logs)).status(address); err != nil {
+			t.Fatal(err)
+		}
+		changed(t, history)
+		if !strings.Contains(logs.String(), "Firmware Changed") {
+			t.Fatalf("change not logged:\n%s", logs.String())
+		}
+	})
+
+	t.Run("fleet", func(t *testing.T) {
+		history := seeded(t)
+		newClient := factory(history)
+		results := PollFleet([]fleet.Site{{Name: "home", Gateways: []fleet.Gateway{{Address: address, Type: "odu"}}}}, 1, func(fleet.Gateway) *Client { return newClient(address) })
+		changed(t, history)
+		if results[0].Status == nil || results[0].Status.FirmwareChange == nil {
+			t.Fatalf("change not reported: %+v", results[0])
+		}
+	})
+
+	// The daemon records the change, so a client reading status through it
+	// must be told rather than record again and see nothing new
+	t.Run("through daemon", func(t *testing.T) {
+		history := seeded(t)
+		socket := serveDaemon(t, NewDaemon(factory(history), log.New(io.Discard)))
+		viaDaemon := func(string) *Client {
+			client := factory(history)(address)
+			client.Daemon = DialDaemon(socket)
+			return client
+		}
+
+		result := RunCheck([]string{address}, viaDaemon, defaultThresholds())
+		changed(t, history)
+		if !strings.Contains(result.String(), "firmware changed from R22.07.03.013 to R22.07.03.014-mock") {
+			t.Fatalf("change not passed back through the daemon: %s", result)
+		}
+		if records, _ := history.List(); len(records[0].Changes) != 1 {
+			t.Fatalf("change recorded more than once: %+v", records[0].Changes)
+		}
+	})
+
+	t.Run("check", func(t *testing.T) {
+		history := seeded(t)
+		result := RunCheck([]string{address}, factory(history), defaultThresholds())
+		changed(t, history)
+		if result.State != CHECK_OK || !strings.Contains(result.String(), "firmware changed from R22.07.03.013 to R22.07.03.014-mock") {
+			t.Fatalf("unexpected check result: %s", result)
+		}
+	})
+
+	t.Run("status", func(t *testing.T) {
+		history := seeded(t)
+		handleStatusCommand([]string{address}, factory(history), false, log.New(io.Discard))
+		changed(t, history)
+	})
+}
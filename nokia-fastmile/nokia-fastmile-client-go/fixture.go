@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const REDACTED = "REDACTED"
+
+// Form fields and headers that carry credentials or session secrets.
+var (
+	sensitiveFormFields = []string{
+		"userhash", "RandomKeyhash", "response", "nonce", "enckey", "enciv",
+		"ct", "ck", "csrf_token", "password",
+	}
+	sensitiveHeaders = []string{"Cookie", "Set-Cookie", "Authorization"}
+
+	// JSON string values whose key looks secret. The replacement is textual so
+	// that malformed gateway payloads are captured exactly as received.
+	sensitiveJSONValue = regexp.MustCompile(
+		`("(?i:token|sid|nonce|randomKey|alati|csrf_token|[^"]*pass[^"]*|[^"]*psk[^"]*|[^"]*secret[^"]*)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+)
+
+type Fixture struct {
+	Request  FixtureRequest  `json:"request"`
+	Response FixtureResponse `json:"response"`
+}
+
+type FixtureRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type FixtureResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 string      `json:"body_base64,omitempty"`
+}
+
+func (f *Fixture) key() string {
+	return fixtureKey(f.Request.Method, f.Request.URL)
+}
+
+func fixtureKey(method, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return method + " " + rawURL
+	}
+	return fmt.Sprintf("%s %s%s?%s", method, u.Host, u.Path, u.RawQuery)
+}
+
+func redactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range sensitiveHeaders {
+		if values := redacted.Values(name); len(values) > 0 {
+			for i := range values {
+				values[i] = REDACTED
+			}
+		}
+	}
+	return redacted
+}
+
+func redactForm(body string) string {
+	values, err := url.ParseQuery(body)
+	if err != nil {
+		return REDACTED
+	}
+
+	changed := false
+	for _, field := range sensitiveFormFields {
+		if values.Has(field) {
+			values.Set(field, REDACTED)
+			changed = true
+		}
+	}
+	if !changed {
+		return body
+	}
+	return values.Encode()
+}
+
+func redactJSON(body string) string {
+	return sensitiveJSONValue.ReplaceAllString(body, `$1"`+REDACTED+`"`)
+}
+
+// Recorder writes every exchange made through its transports to a fixture
+// directory, one numbered JSON file per request.
+type Recorder struct {
+	dir string
+
+	mu  sync.Mutex
+	seq int
+}
+
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	return &Recorder{dir: dir}, nil
+}
+
+func (r *Recorder) Wrap(next http.RoundTripper) http.RoundTripper {
+	return &recordingTransport{next: next, recorder: r}
+}
+
+func (r *Recorder) save(fixture *Fixture) error {
+	r.mu.Lock()
+	r.seq++
+	name := fmt.Sprintf("%04d.json", r.seq)
+	r.mu.Unlock()
+
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.dir, name), data, 0644)
+}
+
+type recordingTransport struct {
+	next     http.RoundTripper
+	recorder *Recorder
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	fixture := &Fixture{
+		Request: FixtureRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: redactHeader(req.Header),
+			Body:   redactForm(string(reqBody)),
+		},
+		Response: FixtureResponse{
+			StatusCode: resp.StatusCode,
+			Header:     redactHeader(resp.Header),
+		},
+	}
+	switch {
+	// An export holds every setting, Wi-Fi keys included. Its status and
+	// headers are what confirm the endpoint, so only those are kept
+	case isConfigExport(req) && !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html"):
+		fixture.Response.Body = fmt.Sprintf("%s (%d bytes)", REDACTED, len(respBody))
+	case utf8.Valid(respBody):
+		fixture.Response.Body = redactJSON(string(respBody))
+	default:
+		fixture.Response.BodyBase64 = base64.StdEncoding.EncodeToString(respBody)
+	}
+
+	if err := t.recorder.save(fixture); err != nil {
+		return nil, fmt.Errorf("failed to record fixture: %w", err)
+	}
+
+	return resp, nil
+}
+
+func isConfigExport(req *http.Request) bool {
+	return req.URL.Path+"?"+req.URL.RawQuery == BACKUP_EXPORT_PATH
+}
+
+// Replayer serves recorded fixtures back in order, matching on method, host,
+// path and query. It never touches the network.
+type Replayer struct {
+	mu     sync.Mutex
+	queues map[string][]*Fixture
+}
+
+func LoadReplayer(dir string) (*Replayer, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no fixtures found in %s", dir)
+	}
+	sort.Strings(paths)
+
+	r := &Replayer{queues: make(map[string][]*Fixture)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture: %w", err)
+		}
+		var fixture Fixture
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+		}
+		r.queues[fixture.key()] = append(r.queues[fixture.key()], &fixture)
+	}
+
+	return r, nil
+}
+
+func (r *Replayer) Wrap(http.RoundTripper) http.RoundTripper {
+	return r
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	key := fixtureKey(req.Method, req.URL.String())
+
+	r.mu.Lock()
+	queue := r.queues[key]
+	if len(queue) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("replay: no recorded response for %s", strings.TrimSuffix(key, "?"))
+	}
+	fixture := queue[0]
+	// The last response for a request keeps being served once the queue drains
+	if len(queue) > 1 {
+		r.queues[key] = queue[1:]
+	}
+	r.mu.Unlock()
+
+	body := []byte(fixture.Response.Body)
+	if fixture.Response.BodyBase64 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(fixture.Response.BodyBase64)
+		if err != nil {
+			return nil, fmt.Errorf("replay: corrupt fixture body: %w", err)
+		}
+		body = decoded
+	}
+
+	header := fixture.Response.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Response.StatusCode, http.StatusText(fixture.Response.StatusCode)),
+		StatusCode:    fixture.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
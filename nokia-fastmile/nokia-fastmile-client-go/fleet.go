@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/charmbracelet/log"
+
+	"gateway-common/fleet"
+)
+
+// FleetResult is the outcome of polling one FastMile gateway.
+type FleetResult struct {
+	Site     string
+	Gateway  fleet.Gateway
+	Status   *DeviceStatus
+	Err      error
+	PolledAt time.Time
+}
+
+// PollFleet logs in to every FastMile gateway of the sites, at most
+// concurrency at a time, and returns the results in fleet order. The Orbi
+// routers are left to netgear-orbi-go.
+func PollFleet(sites []fleet.Site, concurrency int, newClient func(fleet.Gateway) *Client) []FleetResult {
+	var results []FleetResult
+	for _, site := range sites {
+		for _, gw := range site.Gateways {
+			if !strings.EqualFold(gw.Type, fleet.TYPE_ORBI) {
+				results = append(results, FleetResult{Site: site.Name, Gateway: gw})
+			}
+		}
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(result *FleetResult) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			defer func() { result.PolledAt = time.Now() }()
+
+			client := newClient(result.Gateway)
+			if err := client.Login(); err != nil {
+				result.Err = err
+				return
+			}
+			defer client.Logout()
+			result.Status, result.Err = client.GetDeviceStatus()
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// Summary is the result as saved to the fleet status for netgear-orbi-go.
+func (r FleetResult) Summary() fleet.Result {
+	summary := fleet.Result{
+		Address:  r.Gateway.Address,
+		Type:     strings.ToLower(r.Gateway.Type),
+		Up:       r.Err == nil,
+		PolledBy: fleet.Poller(r.Gateway.Type),
+		PolledAt: r.PolledAt,
+	}
+	if r.Err != nil {
+		summary.Detail = r.Err.Error()
+	} else {
+		summary.Detail = fmt.Sprintf("%s, up %s, CPU %d%%, %d active",
+			r.Status.ModelName, FormatUptime(r.Status.UpTime), r.Status.CPUUsageInfo.CPUUsage, activeDevices(r.Status))
+	}
+	return summary
+}
+
+func activeDevices(status *DeviceStatus) int {
+	active := 0
+	for _, device := range status.Devices {
+		if device.Active {
+			active++
+		}
+	}
+	return active
+}
+
+// RenderFleetSummary renders one table row per gateway, grouped by site with
+// the site's health on its first row.
+func RenderFleetSummary(results []fleet.Result, now time.Time) string {
+	healthStyles := map[string]lipgloss.Style{
+		fleet.HEALTH_HEALTHY:  lipgloss.NewStyle().Foreground(lipgloss.Color("40")).Bold(true),
+		fleet.HEALTH_DEGRADED: lipgloss.NewStyle().Foreground(lipgloss.Color("208")).Bold(true),
+		fleet.HEALTH_DOWN:     lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true),
+		fleet.HEALTH_UNKNOWN:  lipgloss.NewStyle().Foreground(lipgloss.Color("245")),
+	}
+	notPolledStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
+	siteStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("14")).Bold(true)
+	errStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+
+	var rows [][]string
+	order, bySite := fleet.GroupBySite(results)
+	for _, site := range order {
+		health := fleet.SiteHealth(bySite[site])
+		for i, result := range bySite[site] {
+			row := []string{"", "", result.Address, strings.ToUpper(result.Type)}
+			if i == 0 {
+				row[0] = siteStyle.Render(site)
+				row[1] = healthStyles[health].Render(health)
+			}
+			switch {
+			case !result.Polled():
+				row = append(row, notPolledStyle.Render(result.Detail), "")
+			case !result.Up:
+				row = append(row, errStyle.Render(truncate(result.Detail, 40)), result.Source(now))
+			default:
+				row = append(row, result.Detail, result.Source(now))
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	t := table.New().
+		Border(lipgloss.RoundedBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("6"))).
+		Headers("Site", "Health", "Gateway", "Type", "Status", "Polled").
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if row == table.HeaderRow {
+				return lipgloss.NewStyle().Foreground(lipgloss.Color("12")).Bold(true).Padding(0, 1)
+			}
+			return lipgloss.NewStyle().Padding(0, 1)
+		}).
+		Rows(rows...)
+
+	return t.Render() + "\n"
+}
+
+func truncate(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen-3] + "..."
+}
+
+// handleFleetCommand polls the FastMile gateways of the sites and reports
+// each site's health together with the Orbi results netgear-orbi-go saved
+// beside the fleet file.
+func handleFleetCommand(fleetPath string, sites []fleet.Site, concurrency int, newClient func(fleet.Gateway) *Client, usePrettyOutput bool, logger *log.Logger) {
+	if usePrettyOutput {
+		fmt.Print(RenderHeader())
+	}
+	if len(sites) == 0 {
+		logger.Fatal("No Sites Selected", "hint", "check -fleet, -site and -tag")
+	}
+
+	results := PollFleet(sites, concurrency, newClient)
+	var polled []fleet.Result
+	for _, result := range results {
+		if result.Status != nil {
+			reportFirmwareChange(strings.ToUpper(result.Gateway.Type), result.Gateway.Address, result.Status, usePrettyOutput, logger)
+		}
+		polled = append(polled, result.Summary())
+	}
+
+	now := time.Now()
+	merged, err := fleet.Record(fleet.StatusPath(fleetPath), sites, polled, now)
+	if err != nil {
+		logger.Warn("Fleet Status Unavailable", "error", err, "hint", "Orbi routers are shown without results")
+	}
+
+	if usePrettyOutput {
+		fmt.Printf("\n%s\n", lipgloss.NewStyle().Bold(true).Render("📊 Fleet Summary"))
+		fmt.Print(RenderFleetSummary(merged, now))
+		return
+	}
+
+	order, bySite := fleet.GroupBySite(merged)
+	for _, site := range order {
+		for _, result := range bySite[site] {
+			gatewayType := strings.ToUpper(result.Type)
+			switch {
+			case !result.Polled():
+				logger.Warn("Gateway Not Polled", "site", site, "gateway-type", gatewayType, "ip", result.Address, "hint", result.Detail)
+			case !result.Up:
+				logger.Error("Gateway Unavailable", "site", site, "gateway-type", gatewayType, "ip", result.Address, "error", result.Detail, "polled-by", result.PolledBy, "polled-at", result.PolledAt)
+			default:
+				logger.Info("Gateway Status", "site", site, "gateway-type", gatewayType, "ip", result.Address, "status", result.Detail, "polled-by", result.PolledBy, "polled-at", result.PolledAt)
+			}
+		}
+		up, _ := fleet.CountUp(bySite[site])
+		logger.Info("Site Summary", "site", site, "health", fleet.SiteHealth(bySite[site]), "successful", fmt.Sprintf("%d/%d", up, len(bySite[site])))
+	}
+}
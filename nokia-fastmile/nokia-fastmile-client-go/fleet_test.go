@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/fleet"
+	"gateway-common/transport"
+)
+
+func TestPollFleetGroupsHealthBySite(t *testing.T) {
+	urls := make(map[string]string)
+	start := func(cfg mockgateway.Config) string {
+		_, ts := mockgateway.NewTLSServer(cfg)
+		t.Cleanup(ts.Close)
+		address := ts.Listener.Addr().String()
+		urls[address] = ts.URL
+		return address
+	}
+	odu, idu, branch := start(oduConfig()), start(iduConfig()), start(oduConfig())
+
+	_, gone := mockgateway.NewTLSServer(iduConfig())
+	down := gone.Listener.Addr().String()
+	urls[down] = gone.URL
+	gone.Close()
+
+	sites := []fleet.Site{
+		{Name: "home", Gateways: []fleet.Gateway{{Address: odu, Type: "odu"}, {Address: idu, Type: "idu"}, {Address: "192.168.1.254", Type: "orbi"}}},
+		{Name: "branch", Gateways: []fleet.Gateway{{Address: branch, Type: "odu"}, {Address: down, Type: "idu"}}},
+		{Name: "cabin", Gateways: []fleet.Gateway{{Address: down, Type: "idu"}}},
+	}
+
+	known := &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}
+	results := PollFleet(sites, 2, func(gw fleet.Gateway) *Client {
+		client := newTestClient(urls[gw.Address], gw.Address, strings.ToUpper(gw.Type))
+		client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: known})
+		client.SetTimeouts(transport.Timeouts{Connect: time.Second, Overall: 2 * time.Second})
+		return client
+	})
+	if len(results) != 5 || results[2].Gateway.Address != branch {
+		t.Fatalf("expected only the FastMile gateways to be polled, got %+v", results)
+	}
+	if results[0].Status == nil || results[0].Status.SerialNumber == "" {
+		t.Fatalf("no status for %s: %+v", odu, results[0])
+	}
+
+	// netgear-orbi-go saved the home Orbi a minute ago
+	statusPath := fleet.StatusPath(filepath.Join(t.TempDir(), fleet.FILE))
+	now := time.Now()
+	orbi := fleet.Result{Address: "192.168.1.254", Type: "orbi", Up: true, Detail: "3 devices, 2 active, 1 inactive", PolledBy: "netgear-orbi-go", PolledAt: now.Add(-time.Minute)}
+	if err := fleet.SaveStatus(statusPath, []fleet.Result{orbi}); err != nil {
+		t.Fatal(err)
+	}
+
+	var polled []fleet.Result
+	for _, result := range results {
+		polled = append(polled, result.Summary())
+	}
+	merged, err := fleet.Record(statusPath, sites, polled, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, bySite := fleet.GroupBySite(merged)
+	if len(bySite["home"]) != 3 || bySite["home"][2].Detail != orbi.Detail {
+		t.Fatalf("orbi result not merged into home: %+v", bySite["home"])
+	}
+	for site, want := range map[string]string{"home": fleet.HEALTH_HEALTHY, "branch": fleet.HEALTH_DEGRADED, "cabin": fleet.HEALTH_DOWN} {
+		if got := fleet.SiteHealth(bySite[site]); got != want {
+			t.Errorf("%s health = %s, want %s", site, got, want)
+		}
+	}
+
+	summary := RenderFleetSummary(merged, now)
+	for _, want := range []string{"home", "branch", "cabin", fleet.HEALTH_HEALTHY, fleet.HEALTH_DEGRADED, fleet.HEALTH_DOWN, odu, "netgear-orbi-go, 1m0s ago"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary is missing %q:\n%s", want, summary)
+		}
+	}
+}
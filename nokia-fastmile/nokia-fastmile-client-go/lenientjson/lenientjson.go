@@ -0,0 +1,302 @@
+// Package lenientjson accepts the almost-JSON emitted by FastMile firmware
+// and rewrites it as strict JSON for encoding/json.
+//
+// Tolerated defects are trailing commas, empty array slots and repeated
+// commas, unquoted object keys, and raw control characters or invalid
+// escapes inside strings. String contents are never altered beyond the
+// escaping needed to make them valid.
+package lenientjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxDepth = 1000
+
+type SyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("lenientjson: %s at offset %d", e.Msg, e.Offset)
+}
+
+// Unmarshal normalizes data and decodes it into v.
+func Unmarshal(data []byte, v any) error {
+	normalized, err := Normalize(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(normalized, v)
+}
+
+// Normalize rewrites a single lenient JSON value as strict JSON.
+func Normalize(data []byte) ([]byte, error) {
+	p := &parser{data: data}
+	p.out.Grow(len(data))
+
+	p.skipSpace()
+	if err := p.value(0); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.data) {
+		return nil, p.errorf("unexpected %q after top-level value", p.data[p.pos])
+	}
+
+	return []byte(p.out.String()), nil
+}
+
+type parser struct {
+	data []byte
+	pos  int
+	out  strings.Builder
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &SyntaxError{Offset: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// skipSeparators skips whitespace and any number of stray commas.
+func (p *parser) skipSeparators() {
+	for {
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		return
+	}
+}
+
+func (p *parser) value(depth int) error {
+	if depth > maxDepth {
+		return p.errorf("nesting deeper than %d", maxDepth)
+	}
+	if p.pos >= len(p.data) {
+		return p.errorf("unexpected end of input")
+	}
+
+	switch p.data[p.pos] {
+	case '{':
+		return p.object(depth)
+	case '[':
+		return p.array(depth)
+	case '"':
+		return p.str()
+	default:
+		return p.literal()
+	}
+}
+
+func (p *parser) object(depth int) error {
+	p.pos++ // '{'
+	p.out.WriteByte('{')
+
+	first := true
+	for {
+		p.skipSeparators()
+		if p.pos >= len(p.data) {
+			return p.errorf("unterminated object")
+		}
+		if p.data[p.pos] == '}' {
+			p.pos++
+			p.out.WriteByte('}')
+			return nil
+		}
+
+		if !first {
+			p.out.WriteByte(',')
+		}
+		first = false
+
+		if p.data[p.pos] == '"' {
+			if err := p.str(); err != nil {
+				return err
+			}
+		} else if err := p.bareKey(); err != nil {
+			return err
+		}
+
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+			return p.errorf("expected ':' after object key")
+		}
+		p.pos++
+		p.out.WriteByte(':')
+
+		p.skipSpace()
+		if err := p.value(depth + 1); err != nil {
+			return err
+		}
+
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] != ',' && p.data[p.pos] != '}' {
+			return p.errorf("expected ',' or '}' in object, got %q", p.data[p.pos])
+		}
+	}
+}
+
+func (p *parser) array(depth int) error {
+	p.pos++ // '['
+	p.out.WriteByte('[')
+
+	first := true
+	for {
+		// Stray commas are empty slots and are dropped
+		p.skipSeparators()
+		if p.pos >= len(p.data) {
+			return p.errorf("unterminated array")
+		}
+		if p.data[p.pos] == ']' {
+			p.pos++
+			p.out.WriteByte(']')
+			return nil
+		}
+
+		if !first {
+			p.out.WriteByte(',')
+		}
+		first = false
+
+		if err := p.value(depth + 1); err != nil {
+			return err
+		}
+
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] != ',' && p.data[p.pos] != ']' {
+			return p.errorf("expected ',' or ']' in array, got %q", p.data[p.pos])
+		}
+	}
+}
+
+func isKeyByte(c byte) bool {
+	return c == '_' || c == '$' || c == '-' || c == '.' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// bareKey quotes an unquoted identifier-like object key.
+func (p *parser) bareKey() error {
+	start := p.pos
+	for p.pos < len(p.data) && isKeyByte(p.data[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return p.errorf("expected object key, got %q", p.data[p.pos])
+	}
+
+	key, _ := json.Marshal(string(p.data[start:p.pos]))
+	p.out.Write(key)
+	return nil
+}
+
+// str copies a string, escaping raw control characters and neutralizing
+// escapes that strict JSON would reject.
+func (p *parser) str() error {
+	p.pos++ // opening quote
+	p.out.WriteByte('"')
+
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			p.out.WriteByte('"')
+			return nil
+		case c == '\\':
+			p.escape()
+		case c < 0x20:
+			fmt.Fprintf(&p.out, `\u%04x`, c)
+			p.pos++
+		case c < utf8.RuneSelf:
+			p.out.WriteByte(c)
+			p.pos++
+		default:
+			r, size := utf8.DecodeRune(p.data[p.pos:])
+			if r == utf8.RuneError && size == 1 {
+				p.out.WriteRune(utf8.RuneError)
+			} else {
+				p.out.Write(p.data[p.pos : p.pos+size])
+			}
+			p.pos += size
+		}
+	}
+
+	return p.errorf("unterminated string")
+}
+
+func (p *parser) escape() {
+	if p.pos+1 >= len(p.data) {
+		// A lone trailing backslash is kept as a literal backslash
+		p.out.WriteString(`\\`)
+		p.pos++
+		return
+	}
+
+	next := p.data[p.pos+1]
+	switch next {
+	case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+		p.out.WriteByte('\\')
+		p.out.WriteByte(next)
+		p.pos += 2
+		return
+	case 'u':
+		if p.pos+6 <= len(p.data) && isHex(p.data[p.pos+2:p.pos+6]) {
+			p.out.Write(p.data[p.pos : p.pos+6])
+			p.pos += 6
+			return
+		}
+	}
+
+	// Invalid escape: keep the backslash as a literal character
+	p.out.WriteString(`\\`)
+	p.pos++
+}
+
+func isHex(b []byte) bool {
+	for _, c := range b {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+			return false
+		}
+	}
+	return true
+}
+
+// literal copies a number, true, false or null.
+func (p *parser) literal() error {
+	start := p.pos
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == ',' || c == ']' || c == '}' || c == ':' || c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			break
+		}
+		p.pos++
+	}
+
+	token := p.data[start:p.pos]
+	if len(token) == 0 {
+		return p.errorf("unexpected %q", p.data[start])
+	}
+	if !json.Valid(token) || token[0] == '"' || token[0] == '{' || token[0] == '[' {
+		p.pos = start
+		return p.errorf("invalid literal %q", token)
+	}
+
+	p.out.Write(token)
+	return nil
+}
@@ -0,0 +1,112 @@
+package lenientjson
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"strict passes through", `{"a": [1, 2], "b": "x"}`, `{"a":[1,2],"b":"x"}`},
+		{"trailing comma in object", `{"a": 1,}`, `{"a":1}`},
+		{"trailing comma in array", `[1, 2,]`, `[1,2]`},
+		{"empty array slots", `[, 1, , 2, ,]`, `[1,2]`},
+		{"repeated commas in object", `{"a": 1,, "b": 2}`, `{"a":1,"b":2}`},
+		{"unquoted keys", `{ModelName: "x", cpu_usageinfo: {CPUUsage: 3}}`, `{"ModelName":"x","cpu_usageinfo":{"CPUUsage":3}}`},
+		{"commas inside strings untouched", `{"v": "a,]b,}c, ,d[,e"}`, `{"v":"a,]b,}c, ,d[,e"}`},
+		{"raw control characters", "{\"v\": \"line1\nline2\ttab\"}", `{"v":"line1\u000aline2\u0009tab"}`},
+		{"invalid escape kept literally", `{"path": "C:\data\x"}`, `{"path":"C:\\data\\x"}`},
+		{"valid escapes kept", `{"v": "q\"\u00e9\\"}`, `{"v":"q\"\u00e9\\"}`},
+		{"nested mess", `{"device_cfg": [,{"HostName": "a",},], "x": [[1,],],}`, `{"device_cfg":[{"HostName":"a"}],"x":[[1]]}`},
+		{"literals", `[true, false, null, -1.5e3,]`, `[true,false,null,-1.5e3]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("Normalize(%q) failed: %v", tt.in, err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("Normalize(%q)\n got %s\nwant %s", tt.in, got, tt.want)
+			}
+			if !json.Valid(got) {
+				t.Fatalf("output is not valid JSON: %s", got)
+			}
+		})
+	}
+}
+
+func TestNormalizeRejects(t *testing.T) {
+	for _, in := range []string{
+		``,
+		`{"a": 1`,
+		`{"a" 1}`,
+		`{"a": }`,
+		`[1 2]`,
+		`{"a": "unterminated}`,
+		`{"a": tru}`,
+		`{"a": 1} trailing`,
+		`<html>login</html>`,
+	} {
+		if out, err := Normalize([]byte(in)); err == nil {
+			t.Errorf("Normalize(%q) = %s, want error", in, out)
+		}
+	}
+}
+
+func TestUnmarshalDeviceStatus(t *testing.T) {
+	var status struct {
+		ModelName       string `json:"ModelName"`
+		SoftwareVersion string `json:"SoftwareVersion"`
+		Devices         []struct {
+			HostName string `json:"HostName"`
+		} `json:"device_cfg"`
+	}
+
+	body := `{ModelName: "FastMile", "SoftwareVersion": "R22,]", "device_cfg": [,{"HostName": "nas",},,],}`
+	if err := Unmarshal([]byte(body), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.ModelName != "FastMile" || status.SoftwareVersion != "R22,]" || len(status.Devices) != 1 {
+		t.Fatalf("unexpected result: %+v", status)
+	}
+}
+
+func FuzzNormalize(f *testing.F) {
+	for _, seed := range []string{
+		`{"a": [1, 2,], b: "x,]",}`,
+		`[,,]`,
+		"{\"v\": \"\x01\"}",
+		`{"v": "\q\u12"}`,
+		`{"UpTime": 1, "mem_info": {"Total": 2, "Free": 1,},}`,
+		`{"a": {"b": {"c": [[[]]]}}}`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		out, err := Normalize(data)
+		if err != nil {
+			return
+		}
+		if !json.Valid(out) {
+			t.Fatalf("Normalize(%q) produced invalid JSON %q", data, out)
+		}
+
+		// Strict JSON must decode to the same value either way
+		var strict, lenient any
+		if json.Unmarshal(data, &strict) != nil {
+			return
+		}
+		if err := json.Unmarshal(out, &lenient); err != nil {
+			t.Fatalf("normalized strict input failed to decode: %v", err)
+		}
+		if !reflect.DeepEqual(strict, lenient) {
+			t.Fatalf("Normalize changed strict JSON %q: %#v != %#v", data, strict, lenient)
+		}
+	})
+}
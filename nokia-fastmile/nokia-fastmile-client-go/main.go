@@ -1,27 +1,103 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/x/term"
+
+	"gateway-common/credstore"
+	"gateway-common/fleet"
+	"gateway-common/logtarget"
+	"gateway-common/redact"
+	"gateway-common/transport"
 )
 
 func main() {
 	var (
-		useHTTPS = flag.Bool("https", true, "Use HTTPS (default: true)")
-		pretty   = flag.Bool("pretty", false, "Enable pretty output with styling")
-		verbose  = flag.Bool("verbose", false, "Enable verbose logging")
+		useHTTPS  = flag.Bool("https", true, "Use HTTPS (default: true)")
+		pretty    = flag.Bool("pretty", false, "Enable pretty output with styling")
+		verbose   = flag.Bool("verbose", false, "Enable verbose logging")
+		logTarget = flag.String("log-target", logtarget.LOG_TARGET_STDERR, "Where logs go: stderr, syslog, journald, file")
+		logFormat = flag.String("log-format", logtarget.LOG_FORMAT_TEXT, "Log format for stderr and file, and of syslog messages: text, json, logfmt")
+		logFile   = flag.String("log-file", "", "Log file for -log-target file")
+		showSecr  = flag.Bool("show-secrets", false, "Print tokens, session IDs, nonces and salts instead of masking them")
+		cmd       = flag.String("cmd", "status", "Command to execute: status, schedule-reboot, daemon, api, mqtt, metrics, fleet, check, firmware, backup, credentials set|get|delete")
+		gateway   = flag.String("gateway", "", "Only act on the gateway with this IP or host:port (default: all)")
+		gwType    = flag.String("gateway-type", "", "Override gateway type detection: odu, idu")
+		fleetFile = flag.String("fleet", fleet.DefaultPath(), "Fleet file of named sites and their gateways, shared with netgear-orbi-go; site health includes the Orbi results it saved")
+		site      = flag.String("site", "", "Only poll these comma-separated fleet sites (default: all)")
+		tag       = flag.String("tag", "", "Only poll fleet sites carrying all of these comma-separated tags")
+		parallel  = flag.Int("concurrency", fleet.CONCURRENCY, "Gateways the fleet command polls at once")
+		record    = flag.String("record", "", "Record redacted HTTP exchanges as fixtures in this directory")
+		replay    = flag.String("replay", "", "Replay HTTP exchanges from a fixture directory instead of the network")
+		tlsMode   = flag.String("tls", transport.TLS_TOFU, "Certificate verification: tofu (pin on first use), ca, verify")
+		caFile    = flag.String("ca-file", "", "PEM bundle of CAs trusted with -tls ca")
+		known     = flag.String("known-gateways", transport.DefaultKnownGatewaysPath(CONFIG_DIR), "File of pinned gateway certificate fingerprints for -tls tofu")
+		credStore = flag.String("credential-store", credstore.STORE_AUTO, "Where credentials are kept: auto (keyring if available), keyring, file; $"+PASSWORD_ENV+" and $"+BROWSER_PAYLOAD_ENV+" override them")
+		credFile  = flag.String("credentials-file", credstore.DefaultPath(CONFIG_DIR), "Encrypted credentials file used when the keyring is unavailable")
+		sessCache = flag.Bool("session-cache", false, "Reuse gateway sessions across runs instead of logging in and out every time")
+		sessFile  = flag.String("session-file", DefaultSessionCachePath(), "File holding cached sessions for -session-cache")
+		backupDir = flag.String("backup-dir", ".", "Directory the backup command saves configuration exports in")
+		fwFile    = flag.String("firmware-file", DefaultFirmwareHistoryPath(), "File recording the firmware version last seen on each gateway (empty disables tracking)")
+		socket    = flag.String("socket", DefaultDaemonSocketPath(), "Unix socket of the daemon, used automatically when it is running")
+		noDaemon  = flag.Bool("no-daemon", false, "Talk to the gateways directly even when a daemon is running")
+		listen    = flag.String("listen", API_LISTEN, "Address the api command listens on, plain HTTP; Orbi routers are served by netgear-orbi-go -cmd api")
+		tokenFile = flag.String("api-token-file", "", "File holding the api bearer token (default: $"+API_TOKEN_ENV+")")
+
+		mqttBroker    = flag.String("mqtt-broker", MQTT_BROKER, "MQTT broker URL for the mqtt command, e.g. tcp://host:1883 or ssl://host:8883")
+		mqttUser      = flag.String("mqtt-username", "", "MQTT username (password from $"+MQTT_PASSWORD_ENV+")")
+		mqttClientID  = flag.String("mqtt-client-id", MQTT_CLIENT_ID, "MQTT client ID")
+		mqttPrefix    = flag.String("mqtt-topic-prefix", MQTT_TOPIC_PREFIX, "Prefix of the state and command topics")
+		mqttDiscovery = flag.String("mqtt-discovery-prefix", MQTT_DISCOVERY_PREFIX, "Home Assistant discovery prefix (empty disables discovery)")
+		mqttInterval  = flag.Duration("mqtt-interval", MQTT_INTERVAL, "How often the mqtt command polls and publishes")
+
+		metricsSink     = flag.String("metrics-sink", SINK_INFLUX, "Comma-separated sinks for the metrics command: influx, otlp")
+		metricsInterval = flag.Duration("metrics-interval", METRICS_INTERVAL, "How often the metrics command exports (0 exports once and exits)")
+		influxURL       = flag.String("influx-url", "", "InfluxDB write URL, e.g. http://influx:8086/api/v2/write?org=home&bucket=gateways (default: line protocol on stdout; token from $"+INFLUX_TOKEN_ENV+")")
+		otlpEndpoint    = flag.String("otlp-endpoint", os.Getenv(OTLP_ENDPOINT_ENV), "OTLP/HTTP metrics endpoint, e.g. http://collector:4318/v1/metrics (headers from $"+OTLP_HEADERS_ENV+")")
+
+		retries      = flag.Int("retries", transport.RETRY_ATTEMPTS, "Attempts per request for transient failures (1 disables retries)")
+		retryBackoff = flag.Duration("retry-backoff", transport.RETRY_BASE_DELAY, "Delay before the first retry, doubled on each further retry")
+		retryMax     = flag.Duration("retry-max-backoff", transport.RETRY_MAX_DELAY, "Upper bound for the retry delay")
+		retryJitter  = flag.Float64("retry-jitter", transport.RETRY_JITTER, "Fraction of each retry delay that is randomized (0-1)")
+		retryStatus  = flag.String("retry-statuses", "429,502,503,504", "Comma-separated HTTP statuses that are retried")
+
+		timeoutSpec = flag.String("timeouts", transport.DefaultTimeouts().String(), "Per-phase deadlines: connect, tls, header (response headers) and overall")
+
+		schedule  = flag.String("schedule", "", "Cron expression for scheduled reboots, e.g. \"0 4 * * *\"")
+		maxActive = flag.Int("max-active", -1, "Skip scheduled reboots when more devices than this are active (-1 disables)")
+		skipIfMAC = flag.String("skip-if-present", "", "Comma-separated MACs that block a scheduled reboot while connected")
+		dryRun    = flag.Bool("dry-run", false, "Log scheduled reboot decisions without rebooting")
+
+		warnCPU    = flag.Float64("warning-cpu", CHECK_WARNING_CPU, "check: CPU percent above which the result is WARNING (0 disables)")
+		critCPU    = flag.Float64("critical-cpu", CHECK_CRITICAL_CPU, "check: CPU percent above which the result is CRITICAL (0 disables)")
+		warnMemory = flag.Float64("warning-memory", CHECK_WARNING_MEMORY, "check: memory percent above which the result is WARNING (0 disables)")
+		critMemory = flag.Float64("critical-memory", CHECK_CRITICAL_MEMORY, "check: memory percent above which the result is CRITICAL (0 disables)")
+		warnUptime = flag.Duration("warning-uptime", 0, "check: uptime below which the result is WARNING, e.g. 1h to catch unexpected reboots (0 disables)")
+		critUptime = flag.Duration("critical-uptime", 0, "check: uptime below which the result is CRITICAL (0 disables)")
 	)
+	gatewayTimeouts := transport.GatewayTimeouts{}
+	flag.Var(gatewayTimeouts, "gateway-timeouts", "Per-gateway overrides as GATEWAY/phase=duration,... (repeatable)")
 	flag.Parse()
 
 	isInTerminal := !ShouldUsePlainOutput()
 	usePrettyOutput := *pretty && isInTerminal
 
-	logger := log.New(os.Stderr)
+	redact.SetShowSecrets(*showSecr)
+
+	logger := log.New(redact.Writer{W: os.Stderr})
 	if *verbose {
 		logger.SetLevel(log.DebugLevel)
 	} else if usePrettyOutput {
@@ -50,19 +126,239 @@ func main() {
 
 	logger.SetStyles(styles)
 
+	logOutput, err := logtarget.Configure(logger, *logTarget, *logFormat, *logFile, LOG_IDENTIFIER)
+	if err != nil {
+		logger.Fatal("Invalid Log Target", "error", err)
+	}
+	defer logOutput.Close()
+
+	gateways := []string{ODU_GATEWAY_IP, IDU_GATEWAY_IP}
+	if *gateway != "" {
+		gateways = []string{*gateway}
+	}
+
+	tlsPolicy, err := transport.NewTLSPolicy(*tlsMode, *caFile, *known)
+	if err != nil {
+		logger.Fatal("Invalid TLS Configuration", "error", err)
+	}
+	if tlsPolicy.Known != nil {
+		tlsPolicy.Known.OnTrust = func(host, fingerprint string) {
+			logger.Warn("Pinned New Gateway Certificate", "host", host, "fingerprint", fingerprint, "file", tlsPolicy.Known.Path)
+		}
+	}
+
+	store, err := OpenCredentialStore(*credStore, *credFile, promptPassphrase)
+	if err != nil {
+		logger.Fatal("Invalid Credential Store", "error", err)
+	}
+
+	var sessions *SessionCache
+	if *sessCache {
+		sessions = NewSessionCache(*sessFile)
+	}
+
+	var firmware *FirmwareHistory
+	if *fwFile != "" {
+		firmware = NewFirmwareHistory(*fwFile)
+	}
+
+	// The replayer answers before the recorder sees a response, so recording
+	// a replay would silently write nothing
+	if *record != "" && *replay != "" {
+		logger.Fatal("Invalid Fixture Options", "error", "-record and -replay cannot be used together")
+	}
+
+	var wrappers []func(http.RoundTripper) http.RoundTripper
+	if *record != "" {
+		recorder, err := NewRecorder(*record)
+		if err != nil {
+			logger.Fatal("Failed To Start Recording", "error", err)
+		}
+		wrappers = append(wrappers, recorder.Wrap)
+	}
+	if *replay != "" {
+		replayer, err := LoadReplayer(*replay)
+		if err != nil {
+			logger.Fatal("Failed To Load Fixtures", "error", err)
+		}
+		wrappers = append(wrappers, replayer.Wrap)
+	}
+
+	retryStatuses, err := transport.ParseStatusList(*retryStatus)
+	if err != nil {
+		logger.Fatal("Invalid Retry Configuration", "error", err)
+	}
+	retryPolicy := transport.RetryPolicy{
+		Attempts:          *retries,
+		BaseDelay:         *retryBackoff,
+		MaxDelay:          *retryMax,
+		Jitter:            *retryJitter,
+		RetryableStatuses: retryStatuses,
+		OnRetry: func(req *http.Request, attempt int, delay time.Duration, reason string) {
+			logger.Warn("Retrying Request", "host", req.URL.Host, "path", req.URL.Path, "attempt", attempt, "delay", delay.Round(time.Millisecond), "reason", reason)
+		},
+	}
+	// Timed per attempt, so retries show up separately in the breakdown
+	if *verbose {
+		wrappers = append(wrappers, transport.TimingTransport{Logger: logger}.Wrap)
+	}
+	// Outermost, so recorded fixtures contain every attempt
+	wrappers = append(wrappers, retryPolicy.Wrap)
+
+	timeouts, err := transport.ParseTimeouts(*timeoutSpec, transport.DefaultTimeouts())
+	if err != nil {
+		logger.Fatal("Invalid Timeouts", "error", err)
+	}
+
+	command := strings.ToLower(*cmd)
+
+	// Recording and replaying need the traffic in this process
+	var daemon *DaemonClient
+	if command != "daemon" && command != "api" && command != "mqtt" && command != "metrics" && command != "fleet" && command != "backup" && !*noDaemon && *record == "" && *replay == "" {
+		if daemon = DialDaemon(*socket); daemon != nil {
+			logger.Debug("Using Running Daemon", "socket", *socket)
+		}
+	}
+
+	newTypedClient := func(gatewayIP, gatewayType string) *Client {
+		client := NewClientWithType(gatewayIP, gatewayType, *useHTTPS)
+		client.SetTLSPolicy(tlsPolicy)
+		client.SetTimeouts(gatewayTimeouts.For(gatewayIP, timeouts))
+		client.Sessions = sessions
+		// A missing password is reported by Login, which a running daemon
+		// or a cached session can make unnecessary
+		if used, err := client.ResolveCredentials(store); err != nil && !errors.Is(err, ErrNoPassword) {
+			logger.Error("Stored Credentials Unavailable", "gateway", gatewayIP, "error", err)
+		} else if used {
+			logger.Debug("Using Stored Credentials", "gateway", gatewayIP, "store", store.Name())
+		}
+		for _, wrap := range wrappers {
+			client.WrapTransport(wrap)
+		}
+		client.Daemon = daemon
+		client.Firmware = firmware
+		return client
+	}
+	newClient := func(gatewayIP string) *Client {
+		return newTypedClient(gatewayIP, *gwType)
+	}
+
+	switch command {
+	case "status":
+		handleStatusCommand(gateways, newClient, usePrettyOutput, logger)
+	case "schedule-reboot":
+		if *schedule == "" {
+			logger.Fatal("schedule-reboot requires -schedule with a cron expression")
+		}
+		guard := RebootGuard{
+			MaxActiveDevices: *maxActive,
+			BlockingMACs:     ParseMACList(*skipIfMAC),
+		}
+		if err := RunRebootSchedule(*schedule, gateways, newClient, guard, *dryRun, logger); err != nil {
+			logger.Fatal("Scheduled Reboots Stopped", "error", err)
+		}
+	case "daemon":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		d := NewDaemon(newClient, logger)
+		d.Open(gateways)
+		if err := d.Serve(ctx, *socket); err != nil {
+			logger.Fatal("Daemon Stopped", "error", err)
+		}
+	case "api":
+		token, err := LoadAPIToken(*tokenFile)
+		if err != nil {
+			logger.Fatal("API Not Started", "error", err)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if err := NewAPIServer(gateways, newClient, token, logger).ListenAndServe(ctx, *listen); err != nil {
+			logger.Fatal("API Stopped", "error", err)
+		}
+	case "mqtt":
+		cfg := DefaultMQTTConfig()
+		cfg.Broker = *mqttBroker
+		cfg.Username = *mqttUser
+		cfg.ClientID = *mqttClientID
+		cfg.TopicPrefix = *mqttPrefix
+		cfg.DiscoveryPrefix = *mqttDiscovery
+		cfg.Interval = *mqttInterval
+		redact.Register(cfg.Password)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if err := NewMQTTPublisher(cfg, gateways, newClient, logger).Run(ctx); err != nil {
+			logger.Fatal("MQTT Publisher Stopped", "error", err)
+		}
+	case "metrics":
+		sinks, err := NewMetricSinks(*metricsSink, *influxURL, *otlpEndpoint)
+		if err != nil {
+			logger.Fatal("Invalid Metrics Configuration", "error", err)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if err := NewMetricsExporter(sinks, gateways, *metricsInterval, newClient, logger).Run(ctx); err != nil {
+			logger.Fatal("Metrics Export Failed", "error", err)
+		}
+	case "fleet":
+		fleetConfig, err := fleet.Load(*fleetFile)
+		if err != nil {
+			logger.Fatal("Invalid Fleet", "error", err)
+		}
+		handleFleetCommand(*fleetFile, fleetConfig.Select(*site, *tag), *parallel, func(gw fleet.Gateway) *Client {
+			return newTypedClient(gw.Address, gw.Type)
+		}, usePrettyOutput, logger)
+	case "check":
+		thresholds := CheckThresholds{
+			WarningCPU:     *warnCPU,
+			CriticalCPU:    *critCPU,
+			WarningMemory:  *warnMemory,
+			CriticalMemory: *critMemory,
+			WarningUptime:  *warnUptime,
+			CriticalUptime: *critUptime,
+		}
+		if err := thresholds.Validate(); err != nil {
+			fmt.Printf("FASTMILE %s - %s\n", checkStateNames[CHECK_UNKNOWN], err)
+			os.Exit(CHECK_UNKNOWN)
+		}
+		result := RunCheck(gateways, newClient, thresholds)
+		fmt.Println(result)
+		os.Exit(result.State)
+	case "firmware":
+		if firmware == nil {
+			logger.Fatal("firmware requires -firmware-file")
+		}
+		handleFirmwareCommand(gateways, newClient, firmware, usePrettyOutput, logger)
+	case "backup":
+		handleBackupCommand(gateways, newClient, *backupDir, usePrettyOutput, logger)
+	case "credentials":
+		if *gateway == "" {
+			logger.Fatal("credentials requires -gateway to select the gateway")
+		}
+		if err := handleCredentialsCommand(flag.Arg(0), NewClientWithType(*gateway, *gwType, *useHTTPS), store); err != nil {
+			logger.Fatal("Credentials Command Failed", "error", err)
+		}
+	default:
+		logger.Fatal("Unknown Command", "cmd", command, "available", "status, schedule-reboot, daemon, api, mqtt, metrics, fleet, check, firmware, backup, credentials")
+	}
+}
+
+func handleStatusCommand(gateways []string, newClient ClientFactory, usePrettyOutput bool, logger *log.Logger) {
 	if usePrettyOutput {
 		fmt.Print(RenderHeader())
 	}
 
-	// Try both gateways
-	gateways := []string{ODU_GATEWAY_IP, IDU_GATEWAY_IP}
 	var successfulResults []struct {
 		client *Client
 		status *DeviceStatus
 	}
 
 	for _, gatewayIP := range gateways {
-		client := NewClient(gatewayIP, *useHTTPS)
+		client := newClient(gatewayIP)
 
 		if usePrettyOutput {
 			fmt.Printf("\n🔍 Connecting to %s Gateway at %s...\n", client.GatewayType, gatewayIP)
@@ -80,7 +376,13 @@ func main() {
 				errStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("196")).MarginLeft(3)
 				warnStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("220")).MarginLeft(3)
 
-				if strings.Contains(errorMsg, "HTTP error") {
+				var pinErr *transport.PinMismatchError
+				if errors.As(err, &pinErr) {
+					fmt.Println(errStyle.Render("Gateway certificate has CHANGED since it was first pinned"))
+					fmt.Println(errStyle.Render("Expected " + pinErr.Expected))
+					fmt.Println(errStyle.Render("Received " + pinErr.Got))
+					fmt.Println(warnStyle.Render("💡 Hint: If the gateway was reset or replaced, remove its line from " + pinErr.Path))
+				} else if strings.Contains(errorMsg, "HTTP error") {
 					fmt.Println(errStyle.Render("HTTP status: " + strings.TrimPrefix(errorMsg, "HTTP error ")))
 				} else if strings.Contains(errorMsg, "gateway error code") {
 					code := strings.TrimPrefix(errorMsg, "gateway error code ")
@@ -102,19 +404,19 @@ func main() {
 		if usePrettyOutput {
 			fmt.Printf("\n%s\n", RenderSuccessLipgloss(fmt.Sprintf("%s Authentication Successful!", client.GatewayType)))
 			if client.SID != "" {
-				fmt.Printf("%s\n", RenderInfoLipgloss(client.SID))
+				fmt.Printf("%s\n", RenderInfoLipgloss(redact.Mask(client.SID)))
 			}
 			if client.Token != "" {
-				fmt.Printf("%s\n", RenderTokenLipgloss(client.Token))
+				fmt.Printf("%s\n", RenderTokenLipgloss(redact.Mask(client.Token)))
 			}
 			fmt.Println() // Add spacing before the table
 		} else {
 			logger.Info("Authentication Successful", "gateway-type", client.GatewayType)
 			if client.SID != "" {
-				logger.Info("Session ID Received", "session-id", client.SID)
+				logger.Info("Session ID Received", "session-id", redact.Mask(client.SID))
 			}
 			if client.Token != "" {
-				logger.Info("Token Received", "token", client.Token)
+				logger.Info("Token Received", "token", redact.Mask(client.Token))
 			}
 		}
 
@@ -138,6 +440,8 @@ func main() {
 			status *DeviceStatus
 		}{client, status})
 
+		reportFirmwareChange(client.GatewayType, gatewayIP, status, usePrettyOutput, logger)
+
 		if usePrettyOutput {
 			fmt.Print(RenderStatusBoxLipglossWithType(status, client.GatewayType, gatewayIP))
 		} else {
@@ -166,15 +470,15 @@ func main() {
 		if len(successfulResults) > 0 {
 			// Success count - green like Python
 			successStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("40")) // Green like our success messages
-			fmt.Printf("%s\n", successStyle.Render(fmt.Sprintf("✅ Successful: %d/2", len(successfulResults))))
+			fmt.Printf("%s\n", successStyle.Render(fmt.Sprintf("✅ Successful: %d/%d", len(successfulResults), len(gateways))))
 
 			// Connection details
 			for _, result := range successfulResults {
-				token := result.client.Token
+				token := redact.Mask(result.client.Token)
 				if token == "" {
 					token = "N/A"
 				}
-				sid := result.client.SID
+				sid := redact.Mask(result.client.SID)
 				if sid == "" {
 					sid = "N/A"
 				}
@@ -208,3 +512,105 @@ func main() {
 		}
 	}
 }
+
+func handleCredentialsCommand(action string, client *Client, store credstore.Store) error {
+	gateway := client.GatewayIP
+
+	switch strings.ToLower(action) {
+	case "set":
+		creds := credstore.Credentials{
+			Username: promptLine(fmt.Sprintf("Username [%s]: ", client.Username), client.Username),
+		}
+		password, err := promptSecret("Password: ")
+		if err != nil {
+			return err
+		}
+		if len(password) == 0 {
+			return fmt.Errorf("empty password")
+		}
+		creds.Password = string(password)
+		if client.GatewayType == "IDU" {
+			creds.BrowserPayload = promptLine("Browser payload: ", "")
+			if creds.BrowserPayload == "" {
+				return fmt.Errorf("IDU gateways log in with the browser payload; capture it from the web interface's login request")
+			}
+		}
+
+		if err := store.Set(gateway, creds); err != nil {
+			return err
+		}
+		fmt.Printf("Stored credentials for %s in %s\n", gateway, store.Name())
+	case "get":
+		creds, err := store.Get(gateway)
+		if err != nil {
+			return fmt.Errorf("%s: %w", gateway, err)
+		}
+		fmt.Printf("Gateway:  %s\n", gateway)
+		fmt.Printf("Store:    %s\n", store.Name())
+		fmt.Printf("Username: %s\n", creds.Username)
+		redact.Register(creds.Password)
+		fmt.Printf("Password: %s\n", redact.Mask(creds.Password))
+		if creds.BrowserPayload != "" {
+			fmt.Printf("Payload:  %s\n", redact.Mask(creds.BrowserPayload))
+		}
+	case "delete":
+		if err := store.Delete(gateway); err != nil {
+			return fmt.Errorf("%s: %w", gateway, err)
+		}
+		fmt.Printf("Deleted credentials for %s from %s\n", gateway, store.Name())
+	default:
+		return fmt.Errorf("unknown credentials action %q (expected set, get or delete)", action)
+	}
+
+	return nil
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+func promptLine(prompt, fallback string) string {
+	fmt.Fprint(os.Stderr, prompt)
+	line, _ := stdinReader.ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return fallback
+}
+
+// promptSecret reads without echo on a terminal and a plain line otherwise,
+// so secrets can be piped in.
+func promptSecret(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		line, err := stdinReader.ReadString('\n')
+		if err != nil && line == "" {
+			return nil, fmt.Errorf("failed to read %s: %w", strings.TrimSuffix(prompt, ": "), err)
+		}
+		return []byte(strings.TrimRight(line, "\r\n")), nil
+	}
+
+	secret, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	return secret, err
+}
+
+func promptPassphrase(confirm bool) ([]byte, error) {
+	if passphrase := os.Getenv(PASSPHRASE_ENV); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return nil, fmt.Errorf("credentials file is encrypted; set %s or run interactively", PASSPHRASE_ENV)
+	}
+
+	passphrase, err := promptSecret("Credentials passphrase: ")
+	if err != nil || !confirm {
+		return passphrase, err
+	}
+	again, err := promptSecret("Repeat passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if string(again) != string(passphrase) {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"gateway-common/redact"
+)
+
+const (
+	METRICS_INTERVAL     = time.Minute
+	METRICS_TIMEOUT      = 10 * time.Second
+	METRICS_SERVICE_NAME = "fastmile-go"
+	INFLUX_TOKEN_ENV     = "FASTMILE_INFLUX_TOKEN"
+	OTLP_ENDPOINT_ENV    = "OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"
+	OTLP_HEADERS_ENV     = "OTEL_EXPORTER_OTLP_HEADERS"
+
+	SINK_INFLUX = "influx"
+	SINK_OTLP   = "otlp"
+)
+
+// Metric is one sample. Names and labels follow Prometheus conventions
+// (snake_case, base units in the name) so every sink, and a Prometheus
+// exporter, can be fed from the same samples.
+type Metric struct {
+	Name   string
+	Help   string
+	Unit   string // UCUM unit, as used by OTLP
+	Labels map[string]string
+	Value  float64
+	Time   time.Time
+}
+
+// MetricSink delivers a batch of samples somewhere.
+type MetricSink interface {
+	Name() string
+	Write(ctx context.Context, metrics []Metric) error
+}
+
+// DeviceStatusMetrics turns a gateway's status into samples. A nil status
+// yields only fastmile_up 0, so a gateway that cannot be reached still shows
+// up in dashboards.
+func DeviceStatusMetrics(gateway, gatewayType string, status *DeviceStatus, now time.Time) []Metric {
+	labels := map[string]string{"gateway": gateway, "gateway_type": gatewayType}
+	metric := func(name, help, unit string, value float64, extra ...string) Metric {
+		l := make(map[string]string, len(labels)+len(extra)/2)
+		for k, v := range labels {
+			l[k] = v
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			l[extra[i]] = extra[i+1]
+		}
+		return Metric{Name: name, Help: help, Unit: unit, Labels: l, Value: value, Time: now}
+	}
+
+	if status == nil {
+		return []Metric{metric("fastmile_up", "Whether the gateway answered the last poll", "1", 0)}
+	}
+
+	var active, inactive float64
+	for _, device := range status.Devices {
+		if device.Active {
+			active++
+		} else {
+			inactive++
+		}
+	}
+
+	return []Metric{
+		metric("fastmile_up", "Whether the gateway answered the last poll", "1", 1),
+		metric("fastmile_info", "Gateway model and firmware, always 1", "1", 1,
+			"model", status.ModelName, "serial", status.SerialNumber, "software_version", status.SoftwareVersion),
+		metric("fastmile_uptime_seconds", "Seconds since the gateway booted", "s", float64(status.UpTime)),
+		metric("fastmile_cpu_usage_percent", "Gateway CPU usage", "%", float64(status.CPUUsageInfo.CPUUsage)),
+		metric("fastmile_memory_total_bytes", "Gateway memory", "By", float64(status.MemInfo.Total)*1024),
+		metric("fastmile_memory_free_bytes", "Free gateway memory", "By", float64(status.MemInfo.Free)*1024),
+		metric("fastmile_devices", "LAN hosts known to the gateway", "{device}", active, "state", "active"),
+		metric("fastmile_devices", "LAN hosts known to the gateway", "{device}", inactive, "state", "inactive"),
+	}
+}
+
+// sortedLabels returns the label names in a stable order.
+func sortedLabels(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// InfluxSink writes InfluxDB line protocol, one line per sample with the
+// metric name as measurement and the sample in the "value" field. With no
+// URL the lines go to Output, for piping into Telegraf or influx write.
+type InfluxSink struct {
+	URL        string // full write URL, e.g. http://influx:8086/api/v2/write?org=home&bucket=gateways
+	Token      string
+	Output     io.Writer
+	HTTPClient *http.Client
+}
+
+func NewInfluxSink(url, token string) *InfluxSink {
+	return &InfluxSink{
+		URL:        url,
+		Token:      token,
+		Output:     os.Stdout,
+		HTTPClient: &http.Client{Timeout: METRICS_TIMEOUT},
+	}
+}
+
+func (s *InfluxSink) Name() string { return SINK_INFLUX }
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// EncodeLineProtocol renders samples as line protocol with nanosecond
+// timestamps. Empty label values are dropped, as InfluxDB rejects them.
+func EncodeLineProtocol(metrics []Metric) []byte {
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		buf.WriteString(influxMeasurementEscaper.Replace(m.Name))
+		for _, k := range sortedLabels(m.Labels) {
+			if m.Labels[k] == "" {
+				continue
+			}
+			fmt.Fprintf(&buf, ",%s=%s", influxTagEscaper.Replace(k), influxTagEscaper.Replace(m.Labels[k]))
+		}
+		fmt.Fprintf(&buf, " value=%s %d\n", strconv.FormatFloat(m.Value, 'g', -1, 64), m.Time.UnixNano())
+	}
+	return buf.Bytes()
+}
+
+func (s *InfluxSink) Write(ctx context.Context, metrics []Metric) error {
+	body := EncodeLineProtocol(metrics)
+	if s.URL == "" {
+		_, err := s.Output.Write(body)
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	}
+	return sendMetrics(s.HTTPClient, req)
+}
+
+// OTLPSink pushes samples to an OpenTelemetry collector using OTLP/HTTP
+// with JSON encoding. Every sample is exported as a gauge.
+type OTLPSink struct {
+	Endpoint   string // e.g. http://collector:4318/v1/metrics
+	Headers    map[string]string
+	HTTPClient *http.Client
+}
+
+func NewOTLPSink(endpoint string, headers map[string]string) *OTLPSink {
+	return &OTLPSink{
+		Endpoint:   endpoint,
+		Headers:    headers,
+		HTTPClient: &http.Client{Timeout: METRICS_TIMEOUT},
+	}
+}
+
+func (s *OTLPSink) Name() string { return SINK_OTLP }
+
+// ParseOTLPHeaders parses the OTEL_EXPORTER_OTLP_HEADERS format,
+// key1=value1,key2=value2.
+func ParseOTLPHeaders(spec string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected key=value", pair)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+type otlpMetric struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Gauge       struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+type otlpScopeMetrics struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Metrics []*otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+// EncodeOTLP renders samples as an OTLP ExportMetricsServiceRequest,
+// grouping samples of the same name into one metric.
+func EncodeOTLP(metrics []Metric) ([]byte, error) {
+	var order []*otlpMetric
+	byName := make(map[string]*otlpMetric)
+	for _, m := range metrics {
+		om, ok := byName[m.Name]
+		if !ok {
+			om = &otlpMetric{Name: m.Name, Description: m.Help, Unit: m.Unit}
+			byName[m.Name] = om
+			order = append(order, om)
+		}
+		point := otlpDataPoint{
+			Attributes:   []otlpAttribute{},
+			TimeUnixNano: strconv.FormatInt(m.Time.UnixNano(), 10),
+			AsDouble:     m.Value,
+		}
+		for _, k := range sortedLabels(m.Labels) {
+			point.Attributes = append(point.Attributes, otlpAttribute{Key: k, Value: otlpValue{StringValue: m.Labels[k]}})
+		}
+		om.Gauge.DataPoints = append(om.Gauge.DataPoints, point)
+	}
+
+	var scope otlpScopeMetrics
+	scope.Scope.Name = METRICS_SERVICE_NAME
+	scope.Metrics = order
+
+	var resource otlpResourceMetrics
+	resource.Resource.Attributes = []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: METRICS_SERVICE_NAME}}}
+	resource.ScopeMetrics = []otlpScopeMetrics{scope}
+
+	req := otlpRequest{ResourceMetrics: []otlpResourceMetrics{resource}}
+	return json.Marshal(req)
+}
+
+func (s *OTLPSink) Write(ctx context.Context, metrics []Metric) error {
+	body, err := EncodeOTLP(metrics)
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	return sendMetrics(s.HTTPClient, req)
+}
+
+func sendMetrics(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("metrics rejected with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// MetricsExporter polls the gateways on an interval and hands the samples
+// to every sink. Sessions are kept open between polls.
+type MetricsExporter struct {
+	Sinks    []MetricSink
+	Gateways []string
+	Interval time.Duration // zero collects once
+	Logger   *log.Logger
+
+	sessions *Daemon
+}
+
+func NewMetricsExporter(sinks []MetricSink, gateways []string, interval time.Duration, newClient ClientFactory, logger *log.Logger) *MetricsExporter {
+	return &MetricsExporter{
+		Sinks:    sinks,
+		Gateways: gateways,
+		Interval: interval,
+		Logger:   logger,
+		sessions: NewDaemon(newClient, logger),
+	}
+}
+
+// Collect polls every gateway once.
+func (e *MetricsExporter) Collect() []Metric {
+	var metrics []Metric
+	for _, gateway := range e.Gateways {
+		resp, err := e.sessions.status(gateway)
+		if err != nil {
+			e.Logger.Warn("Gateway Poll Failed", "gateway", gateway, "error", err)
+			metrics = append(metrics, DeviceStatusMetrics(gateway, e.sessions.gatewayType(gateway), nil, time.Now())...)
+			continue
+		}
+		metrics = append(metrics, DeviceStatusMetrics(gateway, resp.GatewayType, resp.Status, time.Now())...)
+	}
+	return metrics
+}
+
+// ExportOnce collects and writes to every sink, returning the first sink
+// error after trying them all.
+func (e *MetricsExporter) ExportOnce(ctx context.Context) error {
+	metrics := e.Collect()
+
+	var firstErr error
+	for _, sink := range e.Sinks {
+		if err := sink.Write(ctx, metrics); err != nil {
+			e.Logger.Warn("Metrics Sink Failed", "sink", sink.Name(), "error", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", sink.Name(), err)
+			}
+			continue
+		}
+		e.Logger.Debug("Exported Metrics", "sink", sink.Name(), "samples", len(metrics))
+	}
+	return firstErr
+}
+
+// Run exports immediately and then on every interval until ctx is
+// cancelled. Sink failures are logged and retried on the next interval.
+func (e *MetricsExporter) Run(ctx context.Context) error {
+	defer e.sessions.Close()
+
+	if e.Interval <= 0 {
+		return e.ExportOnce(ctx)
+	}
+
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	for {
+		e.ExportOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NewMetricSinks builds the sinks named in a comma-separated list.
+func NewMetricSinks(spec, influxURL, otlpEndpoint string) ([]MetricSink, error) {
+	var sinks []MetricSink
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case SINK_INFLUX:
+			token := os.Getenv(INFLUX_TOKEN_ENV)
+			redact.Register(token)
+			sinks = append(sinks, NewInfluxSink(influxURL, token))
+		case SINK_OTLP:
+			if otlpEndpoint == "" {
+				return nil, fmt.Errorf("the otlp sink needs -otlp-endpoint or $%s", OTLP_ENDPOINT_ENV)
+			}
+			headers, err := ParseOTLPHeaders(os.Getenv(OTLP_HEADERS_ENV))
+			if err != nil {
+				return nil, fmt.Errorf("invalid $%s: %w", OTLP_HEADERS_ENV, err)
+			}
+			for _, v := range headers {
+				redact.Register(v)
+			}
+			sinks = append(sinks, NewOTLPSink(otlpEndpoint, headers))
+		default:
+			return nil, fmt.Errorf("unknown metrics sink %q, expected %s or %s", name, SINK_INFLUX, SINK_OTLP)
+		}
+	}
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("no metrics sink selected")
+	}
+	return sinks, nil
+}
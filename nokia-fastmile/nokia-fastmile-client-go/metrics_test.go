@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/transport"
+)
+
+func TestEncodeLineProtocol(t *testing.T) {
+	at := time.Unix(1700000000, 5)
+	got := string(EncodeLineProtocol([]Metric{
+		{Name: "fastmile_info", Labels: map[string]string{"model": "FastMile 5G", "serial": "", "gateway": "a=b,c"}, Value: 1, Time: at},
+		{Name: "fastmile_cpu_usage_percent", Labels: map[string]string{"gateway": "192.168.0.1"}, Value: 12.5, Time: at},
+	}))
+
+	want := "fastmile_info,gateway=a\\=b\\,c,model=FastMile\\ 5G value=1 1700000000000000005\n" +
+		"fastmile_cpu_usage_percent,gateway=192.168.0.1 value=12.5 1700000000000000005\n"
+	if got != want {
+		t.Fatalf("line protocol mismatch\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestMetricsExporterWritesInfluxAndOTLP(t *testing.T) {
+	_, gw := mockgateway.NewTLSServer(oduConfig())
+	t.Cleanup(gw.Close)
+	up := gw.Listener.Addr().String()
+
+	// A gateway that has gone away must still be reported, as down
+	_, gone := mockgateway.NewTLSServer(iduConfig())
+	down := gone.Listener.Addr().String()
+	urls := map[string]string{up: gw.URL, down: gone.URL}
+	gone.Close()
+
+	var mu sync.Mutex
+	bodies := make(map[string]string)
+	headers := make(map[string]http.Header)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies[r.URL.Path], headers[r.URL.Path] = string(body), r.Header
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(collector.Close)
+
+	known := &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}
+	sinks := []MetricSink{
+		NewInfluxSink(collector.URL+"/api/v2/write?org=home&bucket=gateways", "influx-token"),
+		NewOTLPSink(collector.URL+"/v1/metrics", map[string]string{"X-Scope-OrgID": "home"}),
+	}
+	exporter := NewMetricsExporter(sinks, []string{up, down}, 0, func(address string) *Client {
+		client := newTestClient(urls[address], address, string(mockgateway.ModeODU))
+		client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: known})
+		client.SetTimeouts(transport.Timeouts{Connect: time.Second, Overall: 2 * time.Second})
+		return client
+	}, log.New(io.Discard))
+
+	if err := exporter.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	influx := bodies["/api/v2/write"]
+	if headers["/api/v2/write"].Get("Authorization") != "Token influx-token" {
+		t.Fatalf("influx request not authenticated: %v", headers["/api/v2/write"])
+	}
+	for _, line := range []string{
+		"fastmile_up,gateway=" + up + ",gateway_type=ODU value=1 ",
+		"fastmile_up,gateway=" + down + ",gateway_type=ODU value=0 ",
+		"fastmile_devices,gateway=" + up + ",gateway_type=ODU,state=active value=",
+	} {
+		if !strings.Contains(influx, line) {
+			t.Errorf("line protocol is missing %q:\n%s", line, influx)
+		}
+	}
+
+	if headers["/v1/metrics"].Get("X-Scope-OrgID") != "home" {
+		t.Fatalf("OTLP headers not sent: %v", headers["/v1/metrics"])
+	}
+	var req otlpRequest
+	if err := json.Unmarshal([]byte(bodies["/v1/metrics"]), &req); err != nil || len(req.ResourceMetrics) != 1 {
+		t.Fatalf("invalid OTLP request: %v\n%s", err, bodies["/v1/metrics"])
+	}
+	points := make(map[string]int)
+	for _, m := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		points[m.Name] = len(m.Gauge.DataPoints)
+	}
+	if points["fastmile_up"] != 2 || points["fastmile_devices"] != 2 || points["fastmile_cpu_usage_percent"] != 1 {
+		t.Fatalf("unexpected OTLP data points: %v", points)
+	}
+}
@@ -0,0 +1,418 @@
+// Package mockgateway implements a fake Nokia FastMile web interface that is
+// good enough to drive the client's ODU and IDU login flows, the getroot
+// status call, reboots and configuration export without a real gateway.
+package mockgateway
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"fastmile-go/oduauth"
+)
+
+type Mode string
+
+const (
+	ModeODU Mode = "ODU" // nonce/salt challenge-response login
+	ModeIDU Mode = "IDU" // browser-captured encrypted payload login
+)
+
+// Failure selects a scripted misbehaviour. It stays in effect until changed.
+type Failure string
+
+const (
+	FailNone           Failure = ""
+	FailBadCredentials Failure = "bad-credentials" // reject every login
+	FailResultCode     Failure = "result-code"     // answer logins with Config.ResultCode
+	FailMalformedJSON  Failure = "malformed-json"  // return unparseable JSON everywhere
+	FailSessionExpiry  Failure = "session-expiry"  // treat every session as expired
+)
+
+// Result codes returned in the "result" field of login responses.
+const (
+	ResultOK             = 0
+	ResultBadCredentials = 1
+)
+
+const SESSION_COOKIE = "sid"
+
+type Config struct {
+	Mode       Mode
+	Username   string
+	Password   string
+	Iterations int
+
+	// IDUPayload is the exact login body accepted in IDU mode; empty accepts
+	// any body with encrypted=1.
+	IDUPayload string
+
+	// ResultCode is returned by logins while FailResultCode is active.
+	ResultCode int
+
+	// SessionTTL expires sessions after this long; zero never expires them.
+	SessionTTL time.Duration
+
+	// Status is served verbatim by getroot; empty serves DefaultStatus.
+	Status string
+
+	// Backup is the configuration export; empty serves DefaultBackup.
+	Backup []byte
+}
+
+type session struct {
+	token   string
+	created time.Time
+}
+
+type Server struct {
+	cfg Config
+
+	mu         sync.Mutex
+	failure    Failure
+	challenges map[string]*oduauth.Challenge
+	sessions   map[string]session
+	reboots    int
+	logins     int
+}
+
+func New(cfg Config) *Server {
+	if cfg.Mode == "" {
+		cfg.Mode = ModeODU
+	}
+	return &Server{
+		cfg:        cfg,
+		challenges: make(map[string]*oduauth.Challenge),
+		sessions:   make(map[string]session),
+	}
+}
+
+// NewTLSServer starts s on a loopback httptest TLS server.
+func NewTLSServer(cfg Config) (*Server, *httptest.Server) {
+	s := New(cfg)
+	return s, httptest.NewTLSServer(s)
+}
+
+// Listen starts s on addr, reusing httptest for its self-signed certificate.
+func (s *Server) Listen(addr string, useTLS bool) (*httptest.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	ts := httptest.NewUnstartedServer(s)
+	ts.Listener.Close()
+	ts.Listener = ln
+	if useTLS {
+		ts.StartTLS()
+	} else {
+		ts.Start()
+	}
+
+	return ts, nil
+}
+
+func (s *Server) SetFailure(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failure = f
+}
+
+// ExpireSessions drops every active session, as a gateway restart would.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]session)
+}
+
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+func (s *Server) Reboots() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reboots
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.RawQuery
+
+	switch {
+	case r.URL.Path == "/":
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>Nokia WebGUI</title></head></html>")
+	case r.URL.Path == "/login_web_app.cgi" && query == "out":
+		s.handleLogout(w, r)
+	case r.URL.Path == "/login_web_app.cgi" && query == "nonce":
+		s.handleNonce(w, r)
+	case r.URL.Path == "/login_web_app.cgi" && query == "salt":
+		s.handleSalt(w, r)
+	case r.URL.Path == "/login_web_app.cgi" && r.Method == http.MethodPost:
+		s.handleLogin(w, r)
+	case r.URL.Path == "/device_status_web_app.cgi" && query == "getroot":
+		s.handleGetRoot(w, r)
+	case r.URL.Path == "/reboot_web_app.cgi" && r.Method == http.MethodPost:
+		s.handleReboot(w, r)
+	case r.URL.Path == "/backup_restore_web_app.cgi" && query == "export" && r.Method == http.MethodPost:
+		s.handleExport(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) currentFailure() Failure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failure
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.currentFailure() == FailMalformedJSON {
+		fmt.Fprint(w, `{"result": 0, "token": "`)
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SESSION_COOKIE); err == nil {
+		s.mu.Lock()
+		delete(s.sessions, cookie.Value)
+		s.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: SESSION_COOKIE, Value: "", Path: "/", MaxAge: -1})
+	s.writeJSON(w, map[string]int{"result": ResultOK})
+}
+
+func (s *Server) handleNonce(w http.ResponseWriter, r *http.Request) {
+	ch, err := oduauth.NewChallenge(s.cfg.Iterations)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	s.challenges[ch.Nonce] = ch
+	s.mu.Unlock()
+
+	s.writeJSON(w, map[string]any{
+		"nonce":      ch.Nonce,
+		"randomKey":  ch.RandomKey,
+		"iterations": ch.Iterations,
+		"pubkey":     "",
+	})
+}
+
+func (s *Server) lookupChallenge(escapedNonce string) (*oduauth.Challenge, bool) {
+	nonce := oduauth.UnescapeBase64URL(escapedNonce)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch, ok := s.challenges[nonce]
+	return ch, ok
+}
+
+func (s *Server) handleSalt(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+		return
+	}
+
+	ch, ok := s.lookupChallenge(r.PostForm.Get("nonce"))
+	if !ok || !ch.VerifyUserHash(s.cfg.Username, r.PostForm.Get("userhash")) {
+		s.writeJSON(w, map[string]int{"result": ResultBadCredentials})
+		return
+	}
+
+	s.writeJSON(w, map[string]string{"alati": ch.Salt})
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+		return
+	}
+
+	switch s.currentFailure() {
+	case FailBadCredentials:
+		s.writeJSON(w, map[string]int{"result": ResultBadCredentials})
+		return
+	case FailResultCode:
+		s.writeJSON(w, map[string]int{"result": s.cfg.ResultCode})
+		return
+	}
+
+	var valid bool
+	if s.cfg.Mode == ModeIDU {
+		valid = s.verifyIDU(r)
+	} else {
+		valid = s.verifyODU(r)
+	}
+	if !valid {
+		s.writeJSON(w, map[string]int{"result": ResultBadCredentials})
+		return
+	}
+
+	sid := randomString(16)
+	token := randomString(24)
+
+	s.mu.Lock()
+	s.sessions[sid] = session{token: token, created: time.Now()}
+	s.logins++
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: SESSION_COOKIE, Value: sid, Path: "/", HttpOnly: true})
+	s.writeJSON(w, map[string]any{"result": ResultOK, "token": token, "sid": sid})
+}
+
+func (s *Server) verifyIDU(r *http.Request) bool {
+	if s.cfg.IDUPayload != "" {
+		return r.PostForm.Encode() == mustParseForm(s.cfg.IDUPayload)
+	}
+	return r.PostForm.Get("encrypted") == "1"
+}
+
+func (s *Server) verifyODU(r *http.Request) bool {
+	ch, ok := s.lookupChallenge(r.PostForm.Get("nonce"))
+	if !ok {
+		return false
+	}
+
+	// Each nonce is single use
+	s.mu.Lock()
+	delete(s.challenges, ch.Nonce)
+	s.mu.Unlock()
+
+	return ch.Verify(s.cfg.Username, s.cfg.Password,
+		r.PostForm.Get("userhash"), r.PostForm.Get("RandomKeyhash"), r.PostForm.Get("response"))
+}
+
+// authenticated returns the session for the request's cookie, if still valid.
+func (s *Server) authenticated(r *http.Request) (session, bool) {
+	if s.currentFailure() == FailSessionExpiry {
+		return session{}, false
+	}
+
+	cookie, err := r.Cookie(SESSION_COOKIE)
+	if err != nil {
+		return session{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[cookie.Value]
+	if ok && s.cfg.SessionTTL > 0 && time.Since(sess.created) > s.cfg.SessionTTL {
+		delete(s.sessions, cookie.Value)
+		return session{}, false
+	}
+	return sess, ok
+}
+
+func (s *Server) handleGetRoot(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authenticated(r); !ok {
+		http.Error(w, "session expired", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case s.currentFailure() == FailMalformedJSON:
+		fmt.Fprint(w, `{"ModelName": "FastMile", "UpTime": `)
+	case s.cfg.Status != "":
+		fmt.Fprint(w, s.cfg.Status)
+	default:
+		fmt.Fprint(w, DefaultStatus(s.cfg.Mode))
+	}
+}
+
+func (s *Server) handleReboot(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.authenticated(r)
+	if !ok {
+		http.Error(w, "session expired", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("csrf_token") != sess.token {
+		http.Error(w, "invalid csrf token", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	s.reboots++
+	s.sessions = make(map[string]session)
+	s.mu.Unlock()
+
+	s.writeJSON(w, map[string]int{"result": ResultOK})
+}
+
+// handleExport serves the export where the client asks for it; real
+// firmware has not been confirmed to offer it there.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.authenticated(r)
+	if !ok {
+		http.Error(w, "session expired", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("csrf_token") != sess.token {
+		http.Error(w, "invalid csrf token", http.StatusForbidden)
+		return
+	}
+
+	backup := s.cfg.Backup
+	if len(backup) == 0 {
+		backup = DefaultBackup()
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="config.cfg"`)
+	w.Write(backup)
+}
+
+// DefaultBackup stands in for the gateway's opaque configuration export.
+func DefaultBackup() []byte {
+	return []byte("<?xml version=\"1.0\"?>\n<Config><PortMapping Enable=\"1\" ExternalPort=\"8443\" InternalClient=\"192.168.1.5\"/></Config>\n")
+}
+
+// DefaultStatus is a trimmed getroot payload in the shape real firmware uses.
+func DefaultStatus(mode Mode) string {
+	model := "FastMile 5G Receiver 5G14-B"
+	if mode == ModeIDU {
+		model = "FastMile 5G Gateway 3.2"
+	}
+
+	return fmt.Sprintf(`{
+  "ModelName": %q,
+  "SerialNumber": "ALCLB1234567",
+  "SoftwareVersion": "R22.07.03.014-mock",
+  "UpTime": 273845,
+  "cpu_usageinfo": {"CPUUsage": 17},
+  "mem_info": {"Total": 493440, "Free": 182512},
+  "device_cfg": [
+    {"HostName": "living-room-tv", "MACAddress": "3c:22:fb:10:20:30", "IPAddress": "192.168.1.20", "InterfaceType": "802.11", "Active": 1},
+    {"HostName": "nas", "MACAddress": "b8:27:eb:aa:bb:cc", "IPAddress": "192.168.1.5", "InterfaceType": "Ethernet", "Active": 1},
+    {"HostName": "old-phone", "MACAddress": "da:a1:19:00:00:01", "IPAddress": "192.168.1.40", "InterfaceType": "802.11", "Active": 0}
+  ]
+}`, model)
+}
+
+func randomString(numBytes int) string {
+	b := make([]byte, numBytes)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func mustParseForm(body string) string {
+	req, _ := http.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.ParseForm()
+	return req.PostForm.Encode()
+}
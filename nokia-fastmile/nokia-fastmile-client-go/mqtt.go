@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	MQTT_BROKER           = "tcp://127.0.0.1:1883"
+	MQTT_CLIENT_ID        = "fastmile-go"
+	MQTT_TOPIC_PREFIX     = "fastmile"
+	MQTT_DISCOVERY_PREFIX = "homeassistant"
+	MQTT_INTERVAL         = time.Minute
+	MQTT_TIMEOUT          = 10 * time.Second
+	MQTT_PASSWORD_ENV     = "FASTMILE_MQTT_PASSWORD"
+
+	MQTT_ONLINE  = "online"
+	MQTT_OFFLINE = "offline"
+	MQTT_PRESS   = "PRESS"
+)
+
+type MQTTConfig struct {
+	Broker          string
+	ClientID        string
+	Username        string
+	Password        string
+	TopicPrefix     string
+	DiscoveryPrefix string // empty disables Home Assistant discovery
+	Interval        time.Duration
+}
+
+func DefaultMQTTConfig() MQTTConfig {
+	return MQTTConfig{
+		Broker:          MQTT_BROKER,
+		ClientID:        MQTT_CLIENT_ID,
+		Password:        os.Getenv(MQTT_PASSWORD_ENV),
+		TopicPrefix:     MQTT_TOPIC_PREFIX,
+		DiscoveryPrefix: MQTT_DISCOVERY_PREFIX,
+		Interval:        MQTT_INTERVAL,
+	}
+}
+
+// MQTTState is the retained JSON published for each gateway on every poll.
+type MQTTState struct {
+	Gateway         string  `json:"gateway"`
+	GatewayType     string  `json:"gateway_type"`
+	Model           string  `json:"model"`
+	Serial          string  `json:"serial"`
+	SoftwareVersion string  `json:"software_version"`
+	Uptime          int     `json:"uptime"`
+	CPU             int     `json:"cpu"`
+	MemoryPercent   float64 `json:"memory_percent"`
+	MemoryUsedMB    float64 `json:"memory_used_mb"`
+	MemoryTotalMB   float64 `json:"memory_total_mb"`
+	ActiveDevices   int     `json:"active_devices"`
+}
+
+// MQTTPublisher polls the gateways on an interval and publishes their
+// status, with Home Assistant discovery so each gateway shows up as a
+// device with CPU, memory, uptime and online sensors and a reboot button.
+//
+// Topics, with <node> the gateway address made topic-safe:
+//
+//	<prefix>/bridge/availability  online/offline (last will)
+//	<prefix>/<node>/state         MQTTState JSON, retained
+//	<prefix>/<node>/online        ON/OFF, retained
+//	<prefix>/<node>/reboot        PRESS reboots the gateway
+type MQTTPublisher struct {
+	Config   MQTTConfig
+	Gateways []string
+	Logger   *log.Logger
+
+	sessions *Daemon
+	client   mqtt.Client
+
+	mu         sync.Mutex
+	discovered map[string]*DeviceStatus
+}
+
+func NewMQTTPublisher(cfg MQTTConfig, gateways []string, newClient ClientFactory, logger *log.Logger) *MQTTPublisher {
+	return &MQTTPublisher{
+		Config:     cfg,
+		Gateways:   gateways,
+		Logger:     logger,
+		sessions:   NewDaemon(newClient, logger),
+		discovered: make(map[string]*DeviceStatus),
+	}
+}
+
+// mqttNode turns a gateway address into a topic and ID segment.
+func mqttNode(gateway string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, gateway)
+}
+
+func (p *MQTTPublisher) topic(parts ...string) string {
+	return p.Config.TopicPrefix + "/" + strings.Join(parts, "/")
+}
+
+// Connect connects to the broker. Subscriptions and the online message are
+// (re)established on every connect, so broker restarts are survived.
+func (p *MQTTPublisher) Connect() error {
+	availability := p.topic("bridge", "availability")
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(p.Config.Broker).
+		SetClientID(p.Config.ClientID).
+		SetUsername(p.Config.Username).
+		SetPassword(p.Config.Password).
+		SetWill(availability, MQTT_OFFLINE, 1, true).
+		SetAutoReconnect(true).
+		SetConnectTimeout(MQTT_TIMEOUT).
+		SetOnConnectHandler(func(client mqtt.Client) {
+			p.publish(availability, MQTT_ONLINE)
+			client.Subscribe(p.topic("+", "reboot"), 0, p.handleReboot)
+			if p.Config.DiscoveryPrefix != "" {
+				client.Subscribe(p.Config.DiscoveryPrefix+"/status", 0, p.handleHomeAssistantStatus)
+			}
+			p.Logger.Info("Connected To MQTT Broker", "broker", p.Config.Broker)
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			p.Logger.Warn("MQTT Connection Lost", "broker", p.Config.Broker, "error", err)
+		})
+
+	p.client = mqtt.NewClient(opts)
+	token := p.client.Connect()
+	if !token.WaitTimeout(MQTT_TIMEOUT) {
+		return fmt.Errorf("timed out connecting to %s", p.Config.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", p.Config.Broker, err)
+	}
+	return nil
+}
+
+// Run publishes immediately and then on every interval until ctx is
+// cancelled.
+func (p *MQTTPublisher) Run(ctx context.Context) error {
+	if err := p.Connect(); err != nil {
+		return err
+	}
+	defer p.Close()
+
+	ticker := time.NewTicker(p.Config.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.PublishOnce()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close marks the bridge offline, disconnects and logs out of the gateways.
+func (p *MQTTPublisher) Close() {
+	if p.client != nil && p.client.IsConnected() {
+		p.publish(p.topic("bridge", "availability"), MQTT_OFFLINE)
+		p.client.Disconnect(250)
+	}
+	p.sessions.Close()
+}
+
+// PublishOnce polls every gateway and publishes what it found.
+func (p *MQTTPublisher) PublishOnce() {
+	for _, gateway := range p.Gateways {
+		node := mqttNode(gateway)
+
+		resp, err := p.sessions.status(gateway)
+		if err != nil {
+			p.Logger.Warn("Gateway Poll Failed", "gateway", gateway, "error", err)
+			p.publish(p.topic(node, "online"), "OFF")
+			continue
+		}
+
+		p.publishDiscovery(gateway, resp.GatewayType, resp.Status, false)
+		p.publish(p.topic(node, "state"), newMQTTState(gateway, resp.GatewayType, resp.Status))
+		p.publish(p.topic(node, "online"), "ON")
+		p.Logger.Debug("Published Gateway Status", "gateway", gateway, "topic", p.topic(node, "state"))
+	}
+}
+
+func newMQTTState(gateway, gatewayType string, status *DeviceStatus) MQTTState {
+	state := MQTTState{
+		Gateway:         gateway,
+		GatewayType:     gatewayType,
+		Model:           status.ModelName,
+		Serial:          status.SerialNumber,
+		SoftwareVersion: status.SoftwareVersion,
+		Uptime:          status.UpTime,
+		CPU:             status.CPUUsageInfo.CPUUsage,
+	}
+	if status.MemInfo.Total > 0 {
+		memory := FormatMemory(status.MemInfo.Total, status.MemInfo.Free)
+		state.MemoryPercent = memory.UsedPercent
+		state.MemoryUsedMB = memory.UsedMB
+		state.MemoryTotalMB = memory.TotalMB
+	}
+	for _, device := range status.Devices {
+		if device.Active {
+			state.ActiveDevices++
+		}
+	}
+	return state
+}
+
+// publishDiscovery sends the Home Assistant configs for a gateway once, or
+// again when force is set because Home Assistant restarted.
+func (p *MQTTPublisher) publishDiscovery(gateway, gatewayType string, status *DeviceStatus, force bool) {
+	if p.Config.DiscoveryPrefix == "" {
+		return
+	}
+
+	p.mu.Lock()
+	_, done := p.discovered[gateway]
+	p.discovered[gateway] = status
+	p.mu.Unlock()
+	if done && !force {
+		return
+	}
+
+	node := mqttNode(gateway)
+	id := "fastmile_" + node
+	if status.SerialNumber != "" {
+		id = "fastmile_" + mqttNode(status.SerialNumber)
+	}
+
+	device := map[string]any{
+		"identifiers":   []string{id},
+		"name":          fmt.Sprintf("Nokia FastMile %s (%s)", gatewayType, gateway),
+		"manufacturer":  "Nokia",
+		"model":         status.ModelName,
+		"sw_version":    status.SoftwareVersion,
+		"serial_number": status.SerialNumber,
+	}
+	availability := p.topic("bridge", "availability")
+	stateTopic := p.topic(node, "state")
+
+	sensor := func(key, name, template string, extra map[string]any) map[string]any {
+		config := map[string]any{
+			"name":               name,
+			"unique_id":          id + "_" + key,
+			"object_id":          id + "_" + key,
+			"state_topic":        stateTopic,
+			"value_template":     template,
+			"availability_topic": availability,
+			"device":             device,
+		}
+		for k, v := range extra {
+			config[k] = v
+		}
+		return config
+	}
+
+	configs := map[string]map[string]any{
+		"sensor/" + id + "/cpu": sensor("cpu", "CPU", "{{ value_json.cpu }}", map[string]any{
+			"unit_of_measurement": "%", "state_class": "measurement", "icon": "mdi:cpu-64-bit",
+		}),
+		"sensor/" + id + "/memory": sensor("memory", "Memory", "{{ value_json.memory_percent | round(0) }}", map[string]any{
+			"unit_of_measurement": "%", "state_class": "measurement", "icon": "mdi:memory",
+		}),
+		"sensor/" + id + "/uptime": sensor("uptime", "Uptime", "{{ value_json.uptime }}", map[string]any{
+			"unit_of_measurement": "s", "device_class": "duration", "state_class": "total_increasing", "entity_category": "diagnostic",
+		}),
+		"sensor/" + id + "/active_devices": sensor("active_devices", "Active Devices", "{{ value_json.active_devices }}", map[string]any{
+			"state_class": "measurement", "icon": "mdi:lan-connect",
+		}),
+		"binary_sensor/" + id + "/online": {
+			"name":               "Online",
+			"unique_id":          id + "_online",
+			"object_id":          id + "_online",
+			"state_topic":        p.topic(node, "online"),
+			"device_class":       "connectivity",
+			"availability_topic": availability,
+			"device":             device,
+		},
+		"button/" + id + "/reboot": {
+			"name":               "Reboot",
+			"unique_id":          id + "_reboot",
+			"object_id":          id + "_reboot",
+			"command_topic":      p.topic(node, "reboot"),
+			"payload_press":      MQTT_PRESS,
+			"device_class":       "restart",
+			"availability_topic": availability,
+			"device":             device,
+		},
+	}
+
+	for path, config := range configs {
+		p.publish(p.Config.DiscoveryPrefix+"/"+path+"/config", config)
+	}
+	p.Logger.Info("Published Home Assistant Discovery", "gateway", gateway, "device", id)
+}
+
+// publish sends a retained message, encoding anything but strings as JSON.
+func (p *MQTTPublisher) publish(topic string, payload any) {
+	var data []byte
+	switch v := payload.(type) {
+	case string:
+		data = []byte(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			p.Logger.Error("MQTT Encode Failed", "topic", topic, "error", err)
+			return
+		}
+		data = encoded
+	}
+
+	token := p.client.Publish(topic, 1, true, data)
+	if !token.WaitTimeout(MQTT_TIMEOUT) {
+		p.Logger.Warn("MQTT Publish Timed Out", "topic", topic)
+		return
+	}
+	if err := token.Error(); err != nil {
+		p.Logger.Warn("MQTT Publish Failed", "topic", topic, "error", err)
+	}
+}
+
+// handleReboot runs when the reboot button is pressed. Retained commands
+// are ignored so that a stale message cannot reboot a gateway on connect.
+func (p *MQTTPublisher) handleReboot(_ mqtt.Client, msg mqtt.Message) {
+	if msg.Retained() || strings.TrimSpace(string(msg.Payload())) != MQTT_PRESS {
+		return
+	}
+
+	node := strings.TrimSuffix(strings.TrimPrefix(msg.Topic(), p.Config.TopicPrefix+"/"), "/reboot")
+	for _, gateway := range p.Gateways {
+		if mqttNode(gateway) != node {
+			continue
+		}
+		p.Logger.Info("Reboot Requested Over MQTT", "gateway", gateway)
+		go func() {
+			if err := p.sessions.reboot(gateway); err != nil {
+				p.Logger.Error("Reboot Failed", "gateway", gateway, "error", err)
+				return
+			}
+			p.publish(p.topic(node, "online"), "OFF")
+		}()
+		return
+	}
+	p.Logger.Warn("Reboot Requested For Unknown Gateway", "topic", msg.Topic())
+}
+
+// handleHomeAssistantStatus republishes discovery when Home Assistant comes
+// back online, in case it lost the retained configs.
+func (p *MQTTPublisher) handleHomeAssistantStatus(_ mqtt.Client, msg mqtt.Message) {
+	if string(msg.Payload()) != MQTT_ONLINE {
+		return
+	}
+
+	p.mu.Lock()
+	discovered := make(map[string]*DeviceStatus, len(p.discovered))
+	for gateway, status := range p.discovered {
+		discovered[gateway] = status
+	}
+	p.mu.Unlock()
+
+	for gateway, status := range discovered {
+		go p.publishDiscovery(gateway, p.sessions.gatewayType(gateway), status, true)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	broker "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/transport"
+)
+
+// testBroker is an embedded MQTT broker that remembers the last payload
+// seen on every topic.
+type testBroker struct {
+	*broker.Server
+	URL string
+
+	mu       sync.Mutex
+	messages map[string][]byte
+}
+
+func startTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	b := &testBroker{
+		Server: broker.New(&broker.Options{
+			InlineClient: true,
+			Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		}),
+		URL:      "tcp://" + addr,
+		messages: make(map[string][]byte),
+	}
+	b.AddHook(new(auth.AllowHook), nil)
+	if err := b.AddListener(listeners.NewTCP(listeners.Config{ID: "test", Address: addr})); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	b.Subscribe("#", 1, func(_ *broker.Client, _ packets.Subscription, pk packets.Packet) {
+		b.mu.Lock()
+		b.messages[pk.TopicName] = append([]byte{}, pk.Payload...)
+		b.mu.Unlock()
+	})
+	return b
+}
+
+func (b *testBroker) message(topic string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	payload, ok := b.messages[topic]
+	return payload, ok
+}
+
+func waitFor(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(3 * time.Second); !ok(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestMQTTPublishesStatusAndDiscovery(t *testing.T) {
+	b := startTestBroker(t)
+
+	servers := make(map[string]*mockgateway.Server)
+	urls := make(map[string]string)
+	modes := make(map[string]string)
+	var gateways []string
+	for _, cfg := range []mockgateway.Config{oduConfig(), iduConfig()} {
+		server, ts := mockgateway.NewTLSServer(cfg)
+		t.Cleanup(ts.Close)
+		address := ts.Listener.Addr().String()
+		servers[address], urls[address], modes[address] = server, ts.URL, string(cfg.Mode)
+		gateways = append(gateways, address)
+	}
+	odu, idu := gateways[0], gateways[1]
+
+	// A stale retained press must never reboot a gateway
+	b.Publish("fastmile/"+mqttNode(idu)+"/reboot", []byte(MQTT_PRESS), true, 0)
+
+	known := &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}
+	cfg := DefaultMQTTConfig()
+	cfg.Broker = b.URL
+	publisher := NewMQTTPublisher(cfg, gateways, func(address string) *Client {
+		client := newTestClient(urls[address], address, modes[address])
+		client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: known})
+		return client
+	}, log.New(io.Discard))
+
+	if err := publisher.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	publisher.PublishOnce()
+
+	for _, gateway := range gateways {
+		node := mqttNode(gateway)
+
+		var state MQTTState
+		payload, _ := b.message("fastmile/" + node + "/state")
+		if err := json.Unmarshal(payload, &state); err != nil || state.Serial == "" || state.GatewayType != modes[gateway] {
+			t.Fatalf("%s: bad state %q: %v", gateway, payload, err)
+		}
+		if online, _ := b.message("fastmile/" + node + "/online"); string(online) != "ON" {
+			t.Fatalf("%s: online = %q", gateway, online)
+		}
+
+		id := "fastmile_" + mqttNode(state.Serial)
+		for _, path := range []string{"sensor/" + id + "/cpu", "sensor/" + id + "/memory", "sensor/" + id + "/uptime", "binary_sensor/" + id + "/online", "button/" + id + "/reboot"} {
+			var config map[string]any
+			payload, ok := b.message("homeassistant/" + path + "/config")
+			if !ok || json.Unmarshal(payload, &config) != nil || config["unique_id"] == nil || config["device"] == nil {
+				t.Fatalf("%s: missing or invalid discovery config for %s: %s", gateway, path, payload)
+			}
+		}
+	}
+	if availability, _ := b.message("fastmile/bridge/availability"); string(availability) != MQTT_ONLINE {
+		t.Fatalf("bridge availability = %q", availability)
+	}
+
+	// Pressing the button in Home Assistant
+	b.Publish("fastmile/"+mqttNode(odu)+"/reboot", []byte(MQTT_PRESS), false, 0)
+	waitFor(t, "the ODU reboot", func() bool { return servers[odu].Reboots() == 1 })
+	if servers[idu].Reboots() != 0 {
+		t.Fatal("retained reboot command was acted on")
+	}
+
+	publisher.Close()
+	waitFor(t, "the bridge to go offline", func() bool {
+		availability, _ := b.message("fastmile/bridge/availability")
+		return string(availability) == MQTT_OFFLINE
+	})
+}
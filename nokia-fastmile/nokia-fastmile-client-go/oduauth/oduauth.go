@@ -0,0 +1,138 @@
+// Package oduauth implements both sides of the FastMile ODU web login
+// challenge-response, as performed by the gateway's CryptoJS login page.
+//
+// The exchange is:
+//
+//	GET  ?nonce  -> nonce, randomKey, iterations
+//	POST ?salt   userhash=H(username, nonce)                -> alati (salt)
+//	POST         userhash, RandomKeyhash=H(randomKey, nonce),
+//	             response=H(H(username, lower(pass)), nonce)
+//
+// where H is SHA-256 over "a:b" rendered as URL-escaped base64, and pass is
+// salt+password, itself hex SHA-256 hashed when iterations >= 1.
+package oduauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+var (
+	escaper   = strings.NewReplacer("=", ".", "/", "_", "+", "-")
+	unescaper = strings.NewReplacer(".", "=", "_", "/", "-", "+")
+)
+
+// EscapeBase64URL maps standard base64 to the gateway's URL-safe alphabet.
+func EscapeBase64URL(b64 string) string {
+	return escaper.Replace(b64)
+}
+
+// UnescapeBase64URL reverses EscapeBase64URL.
+func UnescapeBase64URL(escaped string) string {
+	return unescaper.Replace(escaped)
+}
+
+// Hash is CryptoJS SHA256(val1 + ":" + val2) as standard base64.
+func Hash(val1, val2 string) string {
+	h := sha256.Sum256([]byte(val1 + ":" + val2))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// HashURL is Hash rendered with EscapeBase64URL.
+func HashURL(val1, val2 string) string {
+	return EscapeBase64URL(Hash(val1, val2))
+}
+
+// HashHex is SHA256(val) as lowercase hex.
+func HashHex(val string) string {
+	h := sha256.Sum256([]byte(val))
+	return hex.EncodeToString(h[:])
+}
+
+// RandomWords returns numWords 32-bit random words as standard base64, like
+// CryptoJS.lib.WordArray.random.
+func RandomWords(numWords int) string {
+	b := make([]byte, numWords*4)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func UserHash(username, nonce string) string {
+	return HashURL(username, nonce)
+}
+
+func RandomKeyHash(randomKey, nonce string) string {
+	return HashURL(randomKey, nonce)
+}
+
+// PasswordHash combines the salt and password the way the login page does.
+func PasswordHash(salt, password string, iterations int) string {
+	passHash := salt + password
+	if iterations >= 1 {
+		passHash = HashHex(passHash)
+	}
+	return passHash
+}
+
+// Response is the proof of password knowledge submitted with the login.
+func Response(username, password, salt, nonce string, iterations int) string {
+	loginHash := Hash(username, strings.ToLower(PasswordHash(salt, password, iterations)))
+	return HashURL(loginHash, nonce)
+}
+
+// Challenge is the server-side state of one login attempt.
+type Challenge struct {
+	Nonce      string
+	RandomKey  string
+	Salt       string
+	Iterations int
+}
+
+// NewChallenge generates a fresh nonce, random key and salt.
+func NewChallenge(iterations int) (*Challenge, error) {
+	words := make([]string, 3)
+	for i, n := range []int{8, 4, 3} {
+		b := make([]byte, n*4)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate challenge: %w", err)
+		}
+		words[i] = base64.StdEncoding.EncodeToString(b)
+	}
+
+	return &Challenge{
+		Nonce:      words[0],
+		RandomKey:  words[1],
+		Salt:       words[2],
+		Iterations: iterations,
+	}, nil
+}
+
+func (c *Challenge) VerifyUserHash(username, userhash string) bool {
+	return equal(userhash, UserHash(username, c.Nonce))
+}
+
+func (c *Challenge) VerifyRandomKeyHash(randomKeyHash string) bool {
+	return equal(randomKeyHash, RandomKeyHash(c.RandomKey, c.Nonce))
+}
+
+func (c *Challenge) VerifyResponse(username, password, response string) bool {
+	return equal(response, Response(username, password, c.Salt, c.Nonce, c.Iterations))
+}
+
+// Verify checks every field of a submitted login form.
+func (c *Challenge) Verify(username, password, userhash, randomKeyHash, response string) bool {
+	// Evaluate all three so timing does not reveal which one failed
+	userOK := c.VerifyUserHash(username, userhash)
+	keyOK := c.VerifyRandomKeyHash(randomKeyHash)
+	responseOK := c.VerifyResponse(username, password, response)
+	return userOK && keyOK && responseOK
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
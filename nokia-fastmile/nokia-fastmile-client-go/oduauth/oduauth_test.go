@@ -0,0 +1,124 @@
+package oduauth
+
+import "testing"
+
+// Golden vectors generated with the CryptoJS class in nokia_fastmile_client.py.
+var goldenVectors = []struct {
+	username, password, salt, nonce, randomKey string
+	iterations                                 int
+
+	escapedNonce, userhash, randomKeyHash, response string
+}{
+	{
+		"admin", "Secret-Pass1", "sTqlvGw8W1yM3Qm0", "IBFxX0LLH6Nvj8WCg9kHwJ4rFe3uM2l7wzgw9f9eY1Q=", "c2VjcmV0LXJhbmRvbS1rZXk=", 1,
+		"IBFxX0LLH6Nvj8WCg9kHwJ4rFe3uM2l7wzgw9f9eY1Q.",
+		"OUF2eGzbLphkelFiCdXYX8yNBlNaEPy5nEKbSej2jkE.",
+		"09yo04qvSweL05qxpca1OrATiwVSePlG2WNcbTFXhIM.",
+		"BIPvZaWsR7lWh9EUhN5ZOW48E0_Ez7FOm_nCRSEwx_8.",
+	},
+	{
+		"admin", "Secret-Pass1", "sTqlvGw8W1yM3Qm0", "IBFxX0LLH6Nvj8WCg9kHwJ4rFe3uM2l7wzgw9f9eY1Q=", "c2VjcmV0LXJhbmRvbS1rZXk=", 0,
+		"IBFxX0LLH6Nvj8WCg9kHwJ4rFe3uM2l7wzgw9f9eY1Q.",
+		"OUF2eGzbLphkelFiCdXYX8yNBlNaEPy5nEKbSej2jkE.",
+		"09yo04qvSweL05qxpca1OrATiwVSePlG2WNcbTFXhIM.",
+		"VwCN_fBKpPoXw6aeZ6d20wZXCVBCIfxDz3jeehfbe8o.",
+	},
+	{
+		"superadmin", "MiXeD+Case/Pw==", "NaCl", "a+b/c==", "rk", 1,
+		"a-b_c..",
+		"CXj4T8k0q4Y9mPt77S64yUUEXlZQLhun7zBBK7-XBM4.",
+		"SeVSHlL8_EmdUyFuxOfZOOM9CriUHXZvM6BJ7aAL3_o.",
+		"iV8otQfLeiLuE4JV9xCxHmjVhuu9QApaW3w56q-QprE.",
+	},
+	{
+		"user", "", "", "", "", 0,
+		"",
+		"CkeM0IGZBynV4t1OzikeIMCcHKTtk9c6nZTVcsEAwwg.",
+		"56wHhmaOD_DwK2K9BPRf9jb9gttjsRBGAcl13ABfOmc.",
+		"-EYIIojHOJSfjqS-2uM0dZt8JAmp3cRMZoANWQ9uhto.",
+	},
+}
+
+func TestGoldenVectors(t *testing.T) {
+	for _, v := range goldenVectors {
+		if got := EscapeBase64URL(v.nonce); got != v.escapedNonce {
+			t.Errorf("EscapeBase64URL(%q) = %q, want %q", v.nonce, got, v.escapedNonce)
+		}
+		if got := UnescapeBase64URL(v.escapedNonce); got != v.nonce {
+			t.Errorf("UnescapeBase64URL(%q) = %q, want %q", v.escapedNonce, got, v.nonce)
+		}
+		if got := UserHash(v.username, v.nonce); got != v.userhash {
+			t.Errorf("UserHash(%q, %q) = %q, want %q", v.username, v.nonce, got, v.userhash)
+		}
+		if got := RandomKeyHash(v.randomKey, v.nonce); got != v.randomKeyHash {
+			t.Errorf("RandomKeyHash(%q, %q) = %q, want %q", v.randomKey, v.nonce, got, v.randomKeyHash)
+		}
+		if got := Response(v.username, v.password, v.salt, v.nonce, v.iterations); got != v.response {
+			t.Errorf("Response(%q, iterations=%d) = %q, want %q", v.username, v.iterations, got, v.response)
+		}
+	}
+}
+
+func TestChallengeVerify(t *testing.T) {
+	for _, v := range goldenVectors {
+		c := &Challenge{Nonce: v.nonce, RandomKey: v.randomKey, Salt: v.salt, Iterations: v.iterations}
+
+		if !c.Verify(v.username, v.password, v.userhash, v.randomKeyHash, v.response) {
+			t.Errorf("golden login for %q (iterations=%d) did not verify", v.username, v.iterations)
+		}
+		if c.Verify(v.username, v.password+"x", v.userhash, v.randomKeyHash, v.response) {
+			t.Errorf("wrong password for %q verified", v.username)
+		}
+		if c.Verify(v.username+"x", v.password, v.userhash, v.randomKeyHash, v.response) {
+			t.Errorf("wrong username for %q verified", v.username)
+		}
+	}
+}
+
+func TestNewChallengeIsFresh(t *testing.T) {
+	a, err := NewChallenge(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewChallenge(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Nonce == b.Nonce || a.Salt == b.Salt || a.RandomKey == b.RandomKey {
+		t.Fatal("challenges should not repeat")
+	}
+	if len(a.Nonce) < 20 {
+		t.Fatalf("nonce too short for the client's preview: %q", a.Nonce)
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	for _, v := range goldenVectors {
+		f.Add(v.username, v.password, v.salt, v.nonce, v.iterations)
+	}
+
+	f.Fuzz(func(t *testing.T, username, password, salt, nonce string, iterations int) {
+		c := &Challenge{Nonce: nonce, RandomKey: "rk", Salt: salt, Iterations: iterations}
+
+		userhash := UserHash(username, nonce)
+		response := Response(username, password, salt, nonce, iterations)
+		if !c.Verify(username, password, userhash, RandomKeyHash("rk", nonce), response) {
+			t.Fatalf("client-side login did not verify on the server side")
+		}
+		if UnescapeBase64URL(EscapeBase64URL(nonce)) != nonce && !containsEscapedAlphabet(nonce) {
+			t.Fatalf("escape round trip changed %q", nonce)
+		}
+	})
+}
+
+// containsEscapedAlphabet reports whether s already uses characters from the
+// escaped alphabet, in which case the escape is not reversible.
+func containsEscapedAlphabet(s string) bool {
+	for _, r := range s {
+		if r == '.' || r == '_' || r == '-' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/charmbracelet/log"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/redact"
+	"gateway-common/transport"
+)
+
+// secretCapture records every secret the gateway hands out, straight off
+// the wire, so the audit knows what must never be printed.
+type secretCapture struct {
+	next http.RoundTripper
+
+	mu      sync.Mutex
+	secrets []string
+}
+
+func (c *secretCapture) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := c.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var fields map[string]any
+	if json.Unmarshal(body, &fields) == nil {
+		c.mu.Lock()
+		for _, key := range []string{"token", "sid", "nonce", "randomKey", "alati"} {
+			if value, ok := fields[key].(string); ok && value != "" {
+				c.secrets = append(c.secrets, value)
+			}
+		}
+		c.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// captureStdout runs fn with os.Stdout redirected and returns what it wrote.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = original }()
+
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+
+	fn()
+	w.Close()
+	return <-done
+}
+
+// runStatusAudit runs the status command against ODU and IDU mock gateways
+// with verbose logging and returns stdout, the log and the secrets issued.
+func runStatusAudit(t *testing.T, pretty bool) (string, string, []string) {
+	t.Helper()
+
+	var gateways []string
+	servers := make(map[string]mockgateway.Config)
+	for _, cfg := range []mockgateway.Config{oduConfig(), iduConfig()} {
+		_, ts := mockgateway.NewTLSServer(cfg)
+		t.Cleanup(ts.Close)
+		gateways = append(gateways, ts.URL)
+		servers[ts.URL] = cfg
+	}
+
+	capture := &secretCapture{}
+	known := &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}
+	newClient := func(baseURL string) *Client {
+		cfg := servers[baseURL]
+		client := newTestClient(baseURL, "127.0.0.1", string(cfg.Mode))
+		client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: known})
+		client.WrapTransport(func(next http.RoundTripper) http.RoundTripper {
+			capture.next = next
+			return capture
+		})
+		return client
+	}
+
+	var logs bytes.Buffer
+	logger := log.New(redact.Writer{W: &logs})
+	logger.SetLevel(log.DebugLevel)
+
+	stdout := captureStdout(t, func() {
+		handleStatusCommand(gateways, newClient, pretty, logger)
+	})
+
+	if len(capture.secrets) == 0 {
+		t.Fatal("no secrets were captured; the audit would prove nothing")
+	}
+	return stdout, logs.String(), capture.secrets
+}
+
+func TestNoSecretsInOutput(t *testing.T) {
+	for _, pretty := range []bool{false, true} {
+		name := "plain"
+		if pretty {
+			name = "pretty"
+		}
+		t.Run(name, func(t *testing.T) {
+			redact.SetShowSecrets(false)
+			stdout, logs, issued := runStatusAudit(t, pretty)
+			output := stdout + logs
+
+			if !strings.Contains(output, REDACTED) {
+				t.Fatalf("expected masked secrets in output:\n%s", output)
+			}
+			if !strings.Contains(output, "Successful: 2/2") && !strings.Contains(logs, "Authentication Successful") {
+				t.Fatalf("status command did not complete:\n%s", output)
+			}
+			for _, secret := range issued {
+				// Previews used to show the first 20 characters
+				for _, leak := range []string{secret, secret[:min(len(secret), 12)]} {
+					if strings.Contains(output, leak) {
+						t.Errorf("secret %q leaked into output", leak)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestShowSecretsOptsBackIn(t *testing.T) {
+	redact.SetShowSecrets(true)
+	t.Cleanup(func() { redact.SetShowSecrets(false) })
+
+	stdout, logs, issued := runStatusAudit(t, false)
+	output := stdout + logs
+
+	var tokenShown bool
+	for _, secret := range issued {
+		if strings.Contains(output, secret) {
+			tokenShown = true
+		}
+	}
+	if !tokenShown {
+		t.Fatalf("-show-secrets should print tokens:\n%s", output)
+	}
+}
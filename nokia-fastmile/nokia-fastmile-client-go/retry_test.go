@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/transport"
+)
+
+func fastRetryPolicy(retries *int32) transport.RetryPolicy {
+	policy := transport.DefaultRetryPolicy()
+	policy.BaseDelay = time.Millisecond
+	policy.MaxDelay = 5 * time.Millisecond
+	policy.OnRetry = func(*http.Request, int, time.Duration, string) {
+		atomic.AddInt32(retries, 1)
+	}
+	return policy
+}
+
+// dropConnection makes the client see a transport error, like a lost packet.
+func dropConnection(w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+func TestRetryRecoversFromTransientFailures(t *testing.T) {
+	server := mockgateway.New(oduConfig())
+	var getroots int32
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first status call drops the connection, the second is a 503
+		if r.URL.RawQuery == "getroot" {
+			switch atomic.AddInt32(&getroots, 1) {
+			case 1:
+				dropConnection(w)
+				return
+			case 2:
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	var retries int32
+	client := newTestClient(ts.URL, "127.0.0.1", "ODU")
+	client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}})
+	client.WrapTransport(fastRetryPolicy(&retries).Wrap)
+
+	if err := client.Login(); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	status, err := client.GetDeviceStatus()
+	if err != nil {
+		t.Fatalf("GetDeviceStatus failed despite retries: %v", err)
+	}
+	// net/http itself may absorb the drop on a reused connection, so only
+	// the 503 is certain to go through the policy
+	if status.SerialNumber == "" || getroots != 3 || retries < 1 {
+		t.Fatalf("expected 3 getroot attempts and at least 1 retry, got %d and %d", getroots, retries)
+	}
+}
+
+func TestRetryResendsSaltPost(t *testing.T) {
+	server := mockgateway.New(oduConfig())
+	var salts int32
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery == "salt" && atomic.AddInt32(&salts, 1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	var retries int32
+	client := newTestClient(ts.URL, "127.0.0.1", "ODU")
+	client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}})
+	client.WrapTransport(fastRetryPolicy(&retries).Wrap)
+
+	if err := client.Login(); err != nil {
+		t.Fatalf("login failed after a salt 503: %v", err)
+	}
+	if salts != 2 || retries != 1 || server.Logins() != 1 {
+		t.Fatalf("expected 2 salt attempts, 1 retry and 1 login, got %d, %d and %d", salts, retries, server.Logins())
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/log"
+	"github.com/robfig/cron/v3"
+)
+
+type RebootGuard struct {
+	MaxActiveDevices int      // skip when more devices than this are active; negative disables
+	BlockingMACs     []string // skip when any of these MACs is connected
+}
+
+func (g RebootGuard) Enabled() bool {
+	return g.MaxActiveDevices >= 0 || len(g.BlockingMACs) > 0
+}
+
+// Evaluate reports whether a reboot may proceed, and why. An empty device
+// list is treated as unavailable, since a gateway that answered with nothing
+// cannot prove the guard conditions hold.
+func (g RebootGuard) Evaluate(devices []LANDevice) (bool, string) {
+	if !g.Enabled() {
+		return true, "no guard conditions configured"
+	}
+	if len(devices) == 0 {
+		return false, "device list unavailable"
+	}
+
+	active := 0
+	for _, device := range devices {
+		if device.Active {
+			active++
+		}
+	}
+
+	if g.MaxActiveDevices >= 0 && active > g.MaxActiveDevices {
+		return false, fmt.Sprintf("%d active devices exceeds limit of %d", active, g.MaxActiveDevices)
+	}
+
+	for _, blocking := range g.BlockingMACs {
+		for _, device := range devices {
+			if bool(device.Active) && normalizeMAC(device.MACAddress) == normalizeMAC(blocking) {
+				return false, fmt.Sprintf("blocking device %s (%s) is connected", device.MACAddress, device.HostName)
+			}
+		}
+	}
+
+	return true, fmt.Sprintf("guards passed (%d active devices)", active)
+}
+
+// ParseMACList splits a comma or space separated list of MACs, written with
+// colons or dashes in either case, into normalized form.
+func ParseMACList(value string) []string {
+	var macs []string
+	for _, mac := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		macs = append(macs, normalizeMAC(mac))
+	}
+	return macs
+}
+
+func normalizeMAC(mac string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(mac)), "-", ":")
+}
+
+// RunRebootSchedule blocks forever, rebooting each gateway at every activation
+// of the cron expression unless a guard condition says otherwise.
+func RunRebootSchedule(expr string, gateways []string, newClient ClientFactory, guard RebootGuard, dryRun bool, logger *log.Logger) error {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+
+	for {
+		next := schedule.Next(time.Now())
+		logger.Info("Next Scheduled Reboot", "at", next.Format(time.RFC3339), "schedule", expr)
+		time.Sleep(time.Until(next))
+
+		for _, gatewayIP := range gateways {
+			runScheduledReboot(newClient(gatewayIP), guard, dryRun, logger)
+		}
+	}
+}
+
+func runScheduledReboot(client *Client, guard RebootGuard, dryRun bool, logger *log.Logger) {
+	logger = logger.With("gateway-type", client.GatewayType, "ip", client.GatewayIP)
+
+	if err := client.Login(); err != nil {
+		logger.Warn("Reboot Skipped", "reason", "login failed", "error", err)
+		return
+	}
+
+	var devices []LANDevice
+	if guard.Enabled() {
+		lanDevices, err := client.GetDevices()
+		if err != nil {
+			logger.Warn("Reboot Skipped", "reason", "could not check guard conditions", "error", err)
+			client.Logout()
+			return
+		}
+		devices = lanDevices
+	}
+
+	proceed, reason := guard.Evaluate(devices)
+	if !proceed {
+		logger.Info("Reboot Skipped", "reason", reason)
+		client.Logout()
+		return
+	}
+
+	if dryRun {
+		logger.Info("Reboot Skipped", "reason", "dry run", "guards", reason)
+		client.Logout()
+		return
+	}
+
+	logger.Info("Reboot Approved", "reason", reason)
+	if err := client.Reboot(); err != nil {
+		logger.Error("Scheduled Reboot Failed", "error", err)
+		client.Logout()
+		return
+	}
+	logger.Info("Scheduled Reboot Sent")
+}
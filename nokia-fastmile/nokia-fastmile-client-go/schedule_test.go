@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/transport"
+)
+
+func TestParseMACList(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{" , ", nil},
+		{"3C:22:FB:10:20:30", []string{"3c:22:fb:10:20:30"}},
+		{"3c-22-fb-10-20-30, B8:27:EB:AA:BB:CC", []string{"3c:22:fb:10:20:30", "b8:27:eb:aa:bb:cc"}},
+		{"3c:22:fb:10:20:30 b8-27-eb-aa-bb-cc,,", []string{"3c:22:fb:10:20:30", "b8:27:eb:aa:bb:cc"}},
+	} {
+		if got := ParseMACList(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseMACList(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRebootGuardEvaluate(t *testing.T) {
+	devices := []LANDevice{
+		{HostName: "living-room-tv", MACAddress: "3c:22:fb:10:20:30", Active: true},
+		{HostName: "nas", MACAddress: "B8:27:EB:AA:BB:CC", Active: true},
+		{HostName: "old-phone", MACAddress: "da:a1:19:00:00:01", Active: false},
+	}
+
+	for _, tt := range []struct {
+		name  string
+		guard RebootGuard
+		want  bool
+	}{
+		{"disabled", RebootGuard{MaxActiveDevices: -1}, true},
+		{"below limit", RebootGuard{MaxActiveDevices: 3}, true},
+		{"at limit", RebootGuard{MaxActiveDevices: 2}, true},
+		{"over limit", RebootGuard{MaxActiveDevices: 1}, false},
+		{"blocking mac with dashes", RebootGuard{MaxActiveDevices: -1, BlockingMACs: ParseMACList("b8-27-eb-aa-bb-cc")}, false},
+		{"blocking mac uppercase", RebootGuard{MaxActiveDevices: -1, BlockingMACs: []string{"3C:22:FB:10:20:30"}}, false},
+		{"inactive mac does not block", RebootGuard{MaxActiveDevices: -1, BlockingMACs: ParseMACList("DA:A1:19:00:00:01")}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, reason := tt.guard.Evaluate(devices); got != tt.want {
+				t.Fatalf("Evaluate = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestRebootGuardFailsClosedWithoutDevices(t *testing.T) {
+	guards := []RebootGuard{
+		{MaxActiveDevices: 5},
+		{MaxActiveDevices: -1, BlockingMACs: ParseMACList("b8:27:eb:aa:bb:cc")},
+	}
+	for _, guard := range guards {
+		for _, devices := range [][]LANDevice{nil, {}} {
+			if proceed, reason := guard.Evaluate(devices); proceed || reason != "device list unavailable" {
+				t.Errorf("%+v with %d devices: Evaluate = %v (%s), want a refusal", guard, len(devices), proceed, reason)
+			}
+		}
+	}
+
+	if proceed, _ := (RebootGuard{MaxActiveDevices: -1}).Evaluate(nil); !proceed {
+		t.Error("a disabled guard should not need the device list")
+	}
+}
+
+func TestScheduledRebootDryRun(t *testing.T) {
+	server, ts := mockgateway.NewTLSServer(oduConfig())
+	t.Cleanup(ts.Close)
+	known := &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}
+	gatewayClient := func() *Client {
+		client := newTestClient(ts.URL, ts.Listener.Addr().String(), string(mockgateway.ModeODU))
+		client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: known})
+		return client
+	}
+
+	var logs bytes.Buffer
+	logger := log.New(&logs)
+
+	runScheduledReboot(gatewayClient(), RebootGuard{MaxActiveDevices: 2}, true, logger)
+	if server.Reboots() != 0 || !strings.Contains(logs.String(), "dry run") {
+		t.Fatalf("dry run rebooted or did not say so (%d reboots):\n%s", server.Reboots(), logs.String())
+	}
+
+	logs.Reset()
+	runScheduledReboot(gatewayClient(), RebootGuard{MaxActiveDevices: 1}, false, logger)
+	if server.Reboots() != 0 || !strings.Contains(logs.String(), "exceeds limit") {
+		t.Fatalf("guard did not block the reboot (%d reboots):\n%s", server.Reboots(), logs.String())
+	}
+
+	runScheduledReboot(gatewayClient(), RebootGuard{MaxActiveDevices: 2}, false, logger)
+	if server.Reboots() != 1 {
+		t.Fatalf("expected the approved reboot to be sent, got %d", server.Reboots())
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gateway-common/redact"
+)
+
+const (
+	SESSION_FILE = "sessions.json"
+
+	// Sessions older than this are not even tried; gateways drop idle
+	// sessions after a few minutes anyway.
+	SESSION_MAX_AGE = 10 * time.Minute
+)
+
+// CachedSession is what is needed to pick up a gateway session in a later
+// run without logging in again.
+type CachedSession struct {
+	GatewayType string         `json:"gateway_type"`
+	Username    string         `json:"username"`
+	Token       string         `json:"token"`
+	SID         string         `json:"sid"`
+	Cookies     []CachedCookie `json:"cookies"`
+	SavedAt     time.Time      `json:"saved_at"`
+}
+
+type CachedCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SessionCache keeps one session per gateway in a JSON file readable only
+// by the owner. The file is re-read on every access so that concurrent
+// invocations see each other's sessions.
+type SessionCache struct {
+	Path   string
+	MaxAge time.Duration
+
+	mu sync.Mutex
+}
+
+// DefaultSessionCachePath follows the XDG base directory spec for state.
+func DefaultSessionCachePath() string {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return SESSION_FILE
+		}
+		stateDir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateDir, "fastmile", SESSION_FILE)
+}
+
+func NewSessionCache(path string) *SessionCache {
+	return &SessionCache{Path: path, MaxAge: SESSION_MAX_AGE}
+}
+
+// Get returns the cached session for gateway if it is recent enough.
+func (s *SessionCache) Get(gateway string) (CachedSession, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions, err := s.load()
+	if err != nil {
+		return CachedSession{}, false, err
+	}
+	session, ok := sessions[gateway]
+	if !ok || (s.MaxAge > 0 && time.Since(session.SavedAt) > s.MaxAge) {
+		return CachedSession{}, false, nil
+	}
+	return session, true, nil
+}
+
+func (s *SessionCache) Set(gateway string, session CachedSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions, err := s.load()
+	if err != nil {
+		return err
+	}
+	sessions[gateway] = session
+	return s.save(sessions)
+}
+
+func (s *SessionCache) Delete(gateway string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := sessions[gateway]; !ok {
+		return nil
+	}
+	delete(sessions, gateway)
+	return s.save(sessions)
+}
+
+func (s *SessionCache) load() (map[string]CachedSession, error) {
+	sessions := make(map[string]CachedSession)
+
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sessions, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session cache: %w", err)
+	}
+	// A corrupt cache only costs a login, so start over rather than fail
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return make(map[string]CachedSession), nil
+	}
+	return sessions, nil
+}
+
+func (s *SessionCache) save(sessions map[string]CachedSession) error {
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.Path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create session cache directory: %w", err)
+	}
+	// CreateTemp uses mode 0600, which the rename keeps
+	tmp, err := os.CreateTemp(dir, ".sessions-*")
+	if err != nil {
+		return fmt.Errorf("failed to write session cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write session cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write session cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.Path); err != nil {
+		return fmt.Errorf("failed to replace session cache: %w", err)
+	}
+	return nil
+}
+
+// resumeSession restores this gateway's cached session, if any, and checks
+// with a single request that the gateway still accepts it. A rejected
+// session is removed from the cache.
+func (c *Client) resumeSession() (bool, error) {
+	cached, ok, err := c.Sessions.Get(c.BaseURL)
+	if err != nil || !ok {
+		return false, err
+	}
+	// Stored credentials may have changed since the session was cached
+	if cached.GatewayType != c.GatewayType || cached.Username != c.Username {
+		return false, c.Sessions.Delete(c.BaseURL)
+	}
+
+	if u, err := url.Parse(c.BaseURL); err == nil {
+		cookies := make([]*http.Cookie, 0, len(cached.Cookies))
+		for _, cookie := range cached.Cookies {
+			cookies = append(cookies, &http.Cookie{Name: cookie.Name, Value: cookie.Value, Path: "/"})
+		}
+		c.HTTPClient.Jar.SetCookies(u, cookies)
+	}
+	c.Token = cached.Token
+	c.SID = cached.SID
+	redact.Register(c.Token)
+	redact.Register(c.SID)
+
+	alive, err := c.sessionAlive()
+	if err != nil || !alive {
+		c.Token = ""
+		c.SID = ""
+		c.clearCookies()
+		if deleteErr := c.Sessions.Delete(c.BaseURL); err == nil {
+			err = deleteErr
+		}
+		return false, err
+	}
+
+	c.LoggedIn = true
+	return true, nil
+}
+
+// sessionAlive asks for the status headers only, which the gateway answers
+// with 401 once the session is gone. Firmware that refuses HEAD gets a GET.
+func (c *Client) sessionAlive() (bool, error) {
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequest(method, c.BaseURL+"/device_status_web_app.cgi?getroot", nil)
+		if err != nil {
+			return false, fmt.Errorf("failed to create session check: %w", err)
+		}
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return false, fmt.Errorf("failed to check cached session: %w", err)
+		}
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return true, nil
+		case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			continue
+		}
+		return false, nil
+	}
+	return false, nil
+}
+
+// saveSession stores the current session and cookies for the next run.
+func (c *Client) saveSession() error {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return err
+	}
+
+	cached := CachedSession{
+		GatewayType: c.GatewayType,
+		Username:    c.Username,
+		Token:       c.Token,
+		SID:         c.SID,
+		SavedAt:     time.Now(),
+	}
+	for _, cookie := range c.HTTPClient.Jar.Cookies(u) {
+		cached.Cookies = append(cached.Cookies, CachedCookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return c.Sessions.Set(c.BaseURL, cached)
+}
+
+func (c *Client) clearCookies() {
+	if u, err := url.Parse(c.BaseURL); err == nil {
+		var expired []*http.Cookie
+		for _, cookie := range c.HTTPClient.Jar.Cookies(u) {
+			expired = append(expired, &http.Cookie{Name: cookie.Name, Path: "/", MaxAge: -1})
+		}
+		c.HTTPClient.Jar.SetCookies(u, expired)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/transport"
+)
+
+// sessionRun builds a fresh client for url, as each CLI invocation would.
+func sessionRun(t *testing.T, url, mode string, sessions *SessionCache, known *transport.KnownGateways) *Client {
+	t.Helper()
+	client := newTestClient(url, "127.0.0.1", mode)
+	client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: known})
+	client.Sessions = sessions
+	return client
+}
+
+func TestSessionCacheReusesSessionAcrossRuns(t *testing.T) {
+	for _, cfg := range []mockgateway.Config{oduConfig(), iduConfig()} {
+		t.Run(string(cfg.Mode), func(t *testing.T) {
+			server, ts := mockgateway.NewTLSServer(cfg)
+			t.Cleanup(ts.Close)
+
+			dir := t.TempDir()
+			sessions := NewSessionCache(filepath.Join(dir, "state", SESSION_FILE))
+			known := &transport.KnownGateways{Path: filepath.Join(dir, transport.KNOWN_GATEWAYS_FILE)}
+
+			for run := 1; run <= 3; run++ {
+				client := sessionRun(t, ts.URL, string(cfg.Mode), sessions, known)
+				if err := client.Login(); err != nil {
+					t.Fatalf("run %d: login failed: %v", run, err)
+				}
+				if _, err := client.GetDeviceStatus(); err != nil {
+					t.Fatalf("run %d: status failed: %v", run, err)
+				}
+				if err := client.Logout(); err != nil {
+					t.Fatalf("run %d: logout failed: %v", run, err)
+				}
+			}
+
+			if server.Logins() != 1 {
+				t.Fatalf("expected one login across three runs, got %d", server.Logins())
+			}
+
+			info, err := os.Stat(sessions.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Fatalf("session cache has mode %v, want 0600", info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestSessionCacheRefreshesStaleSession(t *testing.T) {
+	server, ts := mockgateway.NewTLSServer(oduConfig())
+	t.Cleanup(ts.Close)
+
+	dir := t.TempDir()
+	sessions := NewSessionCache(filepath.Join(dir, SESSION_FILE))
+	known := &transport.KnownGateways{Path: filepath.Join(dir, transport.KNOWN_GATEWAYS_FILE)}
+
+	first := sessionRun(t, ts.URL, "ODU", sessions, known)
+	if err := first.Login(); err != nil {
+		t.Fatal(err)
+	}
+	staleSID := first.SID
+	first.Logout()
+
+	// The gateway restarted between runs
+	server.ExpireSessions()
+
+	second := sessionRun(t, ts.URL, "ODU", sessions, known)
+	if err := second.Login(); err != nil {
+		t.Fatalf("login after expiry failed: %v", err)
+	}
+	if server.Logins() != 2 || second.SID == staleSID {
+		t.Fatalf("stale session was not replaced: %d logins", server.Logins())
+	}
+	if _, err := second.GetDeviceStatus(); err != nil {
+		t.Fatalf("status with refreshed session failed: %v", err)
+	}
+
+	cached, ok, err := sessions.Get(ts.URL)
+	if err != nil || !ok || cached.SID != second.SID {
+		t.Fatalf("cache not refreshed: %+v %v %v", cached, ok, err)
+	}
+}
+
+func TestSessionCacheSkipsOldAndForeignSessions(t *testing.T) {
+	server, ts := mockgateway.NewTLSServer(oduConfig())
+	t.Cleanup(ts.Close)
+
+	dir := t.TempDir()
+	sessions := NewSessionCache(filepath.Join(dir, SESSION_FILE))
+	known := &transport.KnownGateways{Path: filepath.Join(dir, transport.KNOWN_GATEWAYS_FILE)}
+
+	first := sessionRun(t, ts.URL, "ODU", sessions, known)
+	if err := first.Login(); err != nil {
+		t.Fatal(err)
+	}
+	first.Logout()
+
+	// Different stored credentials must not pick up someone else's session
+	other := sessionRun(t, ts.URL, "ODU", sessions, known)
+	other.Username = "operator"
+	if err := other.Login(); err == nil || other.LoggedIn {
+		t.Fatal("session was reused for a different user")
+	}
+
+	second := sessionRun(t, ts.URL, "ODU", sessions, known)
+	if err := second.Login(); err != nil {
+		t.Fatal(err)
+	}
+	second.Logout()
+
+	sessions.MaxAge = time.Nanosecond
+	third := sessionRun(t, ts.URL, "ODU", sessions, known)
+	if err := third.Login(); err != nil {
+		t.Fatal(err)
+	}
+	if server.Logins() != 3 {
+		t.Fatalf("expected a fresh login for each skipped session, got %d logins", server.Logins())
+	}
+}
+
+func TestRebootDropsCachedSession(t *testing.T) {
+	_, ts := mockgateway.NewTLSServer(oduConfig())
+	t.Cleanup(ts.Close)
+
+	dir := t.TempDir()
+	sessions := NewSessionCache(filepath.Join(dir, SESSION_FILE))
+	client := sessionRun(t, ts.URL, "ODU", sessions, &transport.KnownGateways{Path: filepath.Join(dir, transport.KNOWN_GATEWAYS_FILE)})
+
+	if err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Reboot(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := sessions.Get(ts.URL); ok {
+		t.Fatal("session survived the reboot in the cache")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"gateway-common/transport"
+)
+
+func TestResponseHeaderTimeoutFailsFastAndIsTraced(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	t.Cleanup(ts.Close)
+
+	var logs bytes.Buffer
+	logger := log.New(&logs)
+	logger.SetLevel(log.DebugLevel)
+
+	client := newTestClient(ts.URL, "127.0.0.1", "ODU")
+	client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: &transport.KnownGateways{Path: filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)}})
+	client.SetTimeouts(transport.Timeouts{Connect: time.Second, TLSHandshake: time.Second, ResponseHeader: 50 * time.Millisecond, Overall: 10 * time.Second})
+	client.WrapTransport(transport.TimingTransport{Logger: logger}.Wrap)
+
+	start := time.Now()
+	err := client.InitializeSession()
+	if err == nil || !strings.Contains(err.Error(), "timeout awaiting response headers") {
+		t.Fatalf("expected a response header timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Fatalf("header timeout took %v; the overall deadline was used instead", elapsed)
+	}
+
+	out := logs.String()
+	if !strings.Contains(out, "Request Failed") || !strings.Contains(out, "phase=header") || !strings.Contains(out, "tls=") {
+		t.Fatalf("expected a traced failure in the header phase:\n%s", out)
+	}
+}
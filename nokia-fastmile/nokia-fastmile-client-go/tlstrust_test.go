@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/pem"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fastmile-go/mockgateway"
+	"gateway-common/transport"
+)
+
+func TestTOFUPinsOnFirstUse(t *testing.T) {
+	_, ts := mockgateway.NewTLSServer(oduConfig())
+	t.Cleanup(ts.Close)
+	host := hostOf(t, ts)
+
+	known := &transport.KnownGateways{Path: filepath.Join(t.TempDir(), "state", transport.KNOWN_GATEWAYS_FILE)}
+	var trusted []string
+	known.OnTrust = func(host, fingerprint string) { trusted = append(trusted, host) }
+	policy := &transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: known}
+
+	for i := 0; i < 2; i++ {
+		client := newTestClient(ts.URL, "127.0.0.1", "ODU")
+		client.SetTLSPolicy(policy)
+		if err := client.InitializeSession(); err != nil {
+			t.Fatalf("connection %d failed: %v", i+1, err)
+		}
+	}
+
+	if len(trusted) != 1 || trusted[0] != host {
+		t.Fatalf("expected a single pin for %s, got %v", host, trusted)
+	}
+	pinned, ok, err := known.Lookup(host)
+	if err != nil || !ok {
+		t.Fatalf("no pin recorded for %s: %v", host, err)
+	}
+	if want := transport.Fingerprint(ts.Certificate()); pinned != want {
+		t.Fatalf("pinned %s, want %s", pinned, want)
+	}
+
+	info, err := os.Stat(known.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("known gateways file has mode %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestTOFURejectsChangedCertificate(t *testing.T) {
+	_, ts := mockgateway.NewTLSServer(oduConfig())
+	t.Cleanup(ts.Close)
+
+	path := filepath.Join(t.TempDir(), transport.KNOWN_GATEWAYS_FILE)
+	stale := "sha256:" + strings.Repeat("00", 32)
+	if err := os.WriteFile(path, []byte("# pinned earlier\n"+hostOf(t, ts)+" "+stale+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newTestClient(ts.URL, "127.0.0.1", "ODU")
+	client.SetTLSPolicy(&transport.TLSPolicy{Mode: transport.TLS_TOFU, Known: &transport.KnownGateways{Path: path}})
+
+	err := client.Login()
+	var pinErr *transport.PinMismatchError
+	if !errors.As(err, &pinErr) {
+		t.Fatalf("expected PinMismatchError, got %v", err)
+	}
+	if pinErr.Expected != stale || pinErr.Got != transport.Fingerprint(ts.Certificate()) {
+		t.Fatalf("unexpected mismatch details: %+v", pinErr)
+	}
+}
+
+func TestCustomCAAndFullVerification(t *testing.T) {
+	_, ts := mockgateway.NewTLSServer(oduConfig())
+	t.Cleanup(ts.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	caPolicy, err := transport.NewTLSPolicy("ca", caFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient(ts.URL, "127.0.0.1", "ODU")
+	client.SetTLSPolicy(caPolicy)
+	if err := client.InitializeSession(); err != nil {
+		t.Fatalf("custom CA connection failed: %v", err)
+	}
+
+	verifyPolicy, err := transport.NewTLSPolicy("verify", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = newTestClient(ts.URL, "127.0.0.1", "ODU")
+	client.SetTLSPolicy(verifyPolicy)
+	if err := client.InitializeSession(); err == nil {
+		t.Fatal("full verification accepted a self-signed gateway certificate")
+	}
+}
+
+func hostOf(t *testing.T, ts *httptest.Server) string {
+	t.Helper()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}